@@ -1,133 +1,814 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/chop-dbhi/sql-importer"
+	"github.com/chop-dbhi/sql-importer/reader"
 )
 
 func main() {
 	var (
 		dbUrl           string
+		dbCreate        bool
+		owner           string
+		quoting         string
+		tablespace      string
+		indexSpace      string
 		schemaName      string
 		tableName       string
 		compressionType string
 
 		csvType      bool
+		jsonType     bool
+		ldjsonType   bool
+		jsonSep      string
+		jsonDepth    int
 		csvDelimiter string
+		headerDelim  string
+		recordSep    string
+		typeHints    bool
+		directives   bool
 		csvNoHeader  bool
+		csvMaxLine   int
+		skipTrailing int
+		rowOffset    int64
+		rowLimit     int64
+		keepCR       bool
+		snakeCase    bool
+		nullTokens   string
+		copyNull     string
+		sqlFile      string
+		rejectsFile  string
+		resultFile   string
+		sqlFormat    string
+		sqlDelim     string
+		sqlNull      string
+		sqlLevel     int
 
 		useCstore   bool
+		stripeRows  int
+		unlogged    bool
 		appendTable bool
+		appendNew   bool
+		matchCols   bool
+		tempTable   bool
+		singleTx    bool
+		checkCount  bool
+		onExisting  string
+		union       bool
+		partition   string
+		profileOnly bool
+		verify      bool
+		verifyRows  bool
+		identity    string
+		primaryKey  string
+		pkFirst     bool
+		pkValidate  bool
+		rowHash     bool
+		hashAlgo    string
+		hashColumns string
+		floatType   string
+		coerce      string
+		textColumns string
+		allText     bool
+		schemaOnly  bool
+		confidence  float64
+		intDigits   int
+		includeCols string
+		excludeCols string
+		rename      string
+		columnMap   string
+		defaults    string
+		keepEmpty   string
+		normSpace   string
+		notNull     string
+		nullable    string
+
+		analyzeTarget  int
+		stmtTimeout    time.Duration
+		retries        int
+		retryDelay     time.Duration
+		analyzeVerbose bool
+		profileTable   bool
+
+		maxRows    int64
+		maxColumns int
+		maxValues  int
+		maxUnique  int
+		examples   int
+		enums      int
+		enumTypes  bool
+
+		dirOpts dirOptions
 	)
 
 	flag.StringVar(&dbUrl, "db", "", "Database URL.")
+	flag.BoolVar(&dbCreate, "db.create", false, "Create the database if it does not exist.")
+	flag.StringVar(&owner, "owner", "", "Role made the owner of the created schema and table rather than the connecting user.")
+	flag.StringVar(&quoting, "quote", sqlimporter.QuoteAlways, "Quoting of the identifiers of the created objects and SQL output: always, or minimal to lowercase names and only quote those that need it.")
+	flag.StringVar(&tablespace, "tablespace", "", "Tablespace of the created tables.")
+	flag.StringVar(&indexSpace, "tablespace.index", "", "Tablespace of the indexes of the primary keys and unique columns of the created tables.")
 	flag.StringVar(&schemaName, "schema", "public", "Schema name.")
 	flag.StringVar(&tableName, "table", "", "Table name.")
 	flag.BoolVar(&csvType, "csv", true, "CSV file. Required if using stdin.")
+	flag.BoolVar(&jsonType, "json", false, "JSON file containing an array of objects.")
+	flag.BoolVar(&ldjsonType, "ldjson", false, "Newline-delimited JSON file.")
+	flag.StringVar(&jsonSep, "json.sep", "_", "Separator joining the keys of nested JSON objects into column names.")
+	flag.IntVar(&jsonDepth, "json.depth", 0, "Levels of nested JSON objects flattened into columns. Deeper objects are loaded as jsonb. Zero is unlimited.")
 	flag.StringVar(&csvDelimiter, "csv.delim", ",", "CSV delimiter.")
+	flag.StringVar(&headerDelim, "csv.headerdelim", "", "Delimiter of the CSV header if it differs from the delimiter of the rows.")
+	flag.StringVar(&recordSep, "csv.recordsep", "", `Byte terminating the CSV records instead of newlines, with Go escapes such as \x1e or \x00.`)
+	flag.BoolVar(&directives, "directives", false, "The file may start with a directive line, such as #schema=sales #table=orders, naming the schema and table unless -schema or -table are given.")
+	flag.BoolVar(&typeHints, "csv.hints", false, "The header is followed by a line of column types, such as int,string,date.")
 	flag.BoolVar(&csvNoHeader, "csv.noheader", false, "No CSV header present.")
+	flag.IntVar(&csvMaxLine, "csv.maxline", 0, "Maximum line size in bytes. Defaults to 512KB.")
+	flag.IntVar(&skipTrailing, "skip.trailing", 0, "Number of lines at the end of the file that are not loaded, such as a trailer with a record count.")
+	flag.Int64Var(&rowOffset, "offset", 0, "Number of rows after the header that are skipped.")
+	flag.Int64Var(&rowLimit, "limit", 0, "Most rows loaded after the offset. Unlike -limit.rows, the rest of the input is ignored. Zero is unlimited.")
+	flag.BoolVar(&keepCR, "csv.keepcr", false, "Keep carriage returns rather than rewriting them as newlines. Use for files terminated by \\n with carriage returns in quoted values.")
+	flag.BoolVar(&snakeCase, "snake", false, "Convert camelCase and PascalCase column names to snake_case, such as FirstName to first_name.")
 	flag.StringVar(&compressionType, "compression", "", "Compression used.")
+	flag.StringVar(&nullTokens, "null", "", "Comma-separated values treated as nulls in addition to empty strings, such as \\N.")
+	flag.StringVar(&copyNull, "copy.null", "", "Null marker of the COPY statements and the SQL script rather than \\N. Values equal to it fail the load.")
+	flag.StringVar(&sqlFile, "sql", "", "Write a SQL script to this path instead of loading into the database.")
+	flag.StringVar(&sqlFormat, "sql.format", "text", "Format of the COPY data in the SQL script: text or csv.")
+	flag.StringVar(&sqlDelim, "sql.delim", "", "Delimiter of the COPY data in the SQL script. Defaults to a tab for text and a comma for csv.")
+	flag.StringVar(&sqlNull, "sql.null", "", "Null marker of the COPY data in the SQL script. Defaults to \\N for text and an empty string for csv.")
+	flag.IntVar(&sqlLevel, "sql.level", 0, "Gzip level of a compressed SQL script, from 1 for the fastest to 9 for the smallest. Defaults to the gzip default.")
 	flag.BoolVar(&useCstore, "cstore", false, "Use cstore table.")
+	flag.IntVar(&stripeRows, "cstore.stripe", sqlimporter.CStoreStripeRows, "Rows per stripe of a cstore table, which are inserted in batches of that size.")
+	flag.BoolVar(&unlogged, "unlogged", false, "Create an unlogged table. Faster to load, but emptied if the server crashes.")
 	flag.BoolVar(&appendTable, "append", false, "Append to table.")
+	flag.BoolVar(&appendNew, "append.new", false, "Append only rows whose row hash is not in the table. Implies -hash.")
+	flag.BoolVar(&matchCols, "append.match", false, "Append to an existing table with more columns, copying only the columns of the file. The other columns take their defaults.")
+	flag.BoolVar(&tempTable, "temp", false, "Load into a temporary table that is discarded, validating the data without persisting it.")
+	flag.BoolVar(&singleTx, "tx", false, "Create, load, and rename each table within a single transaction so a failed load leaves nothing behind.")
+	flag.BoolVar(&checkCount, "check.count", false, "Count the rows of each loaded table and fail if they are not the rows of the file.")
+	flag.StringVar(&onExisting, "existing", "replace", "Policy if the table exists and is not appended to: replace, fail-if-exists, or skip-if-exists.")
+	flag.BoolVar(&union, "union", false, "Load all files given into one table. The files must have the same columns.")
+	flag.StringVar(&partition, "partition", "", "Regular expression with one group matching the partition key in each file name, such as _(\\d{4}_\\d{2})\\. for events_2023_01.csv. The files of a directory or -union are loaded into one table partitioned by the key.")
+	flag.BoolVar(&rowHash, "hash", false, "Add a _row_hash column containing a hash of the values of each row.")
+	flag.StringVar(&hashAlgo, "hash.algo", "sha256", "Algorithm of the row hash: sha256, sha1, or md5.")
+	flag.StringVar(&hashColumns, "hash.columns", "", "Comma-separated columns included in the row hash. Defaults to all columns.")
+	flag.BoolVar(&profileOnly, "profile", false, "Print the columns and types detected without loading.")
+	flag.BoolVar(&verify, "verify-against", false, "Verify the existing table has the columns and types of the file without loading it. Exits non-zero on a mismatch.")
+	flag.BoolVar(&verifyRows, "verify.rows", false, "Also verify the table has as many rows as the file.")
+	flag.StringVar(&identity, "identity", "", "Name of an auto-incrementing primary key column to add.")
+	flag.StringVar(&primaryKey, "pk", "", "Name of a column made the primary key.")
+	flag.BoolVar(&pkFirst, "pk.first", false, "Make the first column the primary key.")
+	flag.BoolVar(&pkValidate, "pk.validate", false, "Fail before loading if the primary key column has duplicates or nulls while profiling.")
+	flag.StringVar(&floatType, "float", "real", "SQL type of float columns: auto, real, or double precision.")
+	flag.StringVar(&includeCols, "include", "", "Comma-separated glob patterns of the columns to load, such as id,name,dx_*. All columns are loaded if not set.")
+	flag.StringVar(&excludeCols, "exclude", "", "Comma-separated glob patterns of the columns to skip, such as tmp_*,*_internal.")
+	flag.BoolVar(&allText, "all-text", false, "Type every column as text without detecting types, which speeds up profiling large files.")
+	flag.BoolVar(&schemaOnly, "schema-only", false, "Create the empty table from the header and type hints of the CSV file without loading rows.")
+	flag.Float64Var(&confidence, "confidence", 1, "Fraction of the values of a column, such as 0.99, that must match a type for the column to keep it. The other values are loaded as nulls.")
+	flag.IntVar(&intDigits, "int.digits", 9, "Most digits of the values of an integer column. Columns with longer values, such as phone and account numbers, are text. Columns with values of 10 to 18 digits are bigint if allowed. Zero is unlimited.")
+	flag.StringVar(&textColumns, "text", "", "Comma-separated glob patterns of columns typed as text, such as zip,*_code.")
+	flag.StringVar(&coerce, "coerce", "", "Comma-separated column:type pairs. Values not matching the type are loaded as nulls.")
+	flag.StringVar(&keepEmpty, "empty", "", "Comma-separated glob patterns of text columns whose empty strings are loaded as is rather than as nulls.")
+	flag.StringVar(&normSpace, "space", "", "Comma-separated glob patterns of text columns, such as * for all, whose runs of whitespace are collapsed to single spaces and trimmed.")
+	flag.StringVar(&resultFile, "result", "", "Write the number of rows loaded and the time spent in each phase as JSON to this path. Only written for a file or files loaded into one table.")
+	flag.StringVar(&rejectsFile, "rejects", "", "Write rows with values that cannot be loaded to this CSV file with the error rather than failing the load.")
+	flag.StringVar(&notNull, "notnull", "", "Comma-separated columns that are not null. The load fails if they contain nulls.")
+	flag.StringVar(&nullable, "nullable", "", "Comma-separated columns that are nullable even if no nulls are present.")
+	flag.StringVar(&rename, "rename", "", "Comma-separated original:desired column name pairs.")
+	flag.StringVar(&columnMap, "map", "", "Comma-separated source:target column pairs of the only columns loaded, in the order of the table.")
+	flag.StringVar(&defaults, "defaults", "", "Comma-separated column:default pairs, such as status:new or created:now(). Nulls are set to the default.")
+	flag.DurationVar(&stmtTimeout, "timeout.statement", 0, "Abort statements that take longer, such as a copy waiting on a locked table, e.g. 10m. Zero is no timeout.")
+	flag.IntVar(&retries, "profile.retries", 0, "Number of times profiling a file is retried from the start after a transient read error, such as a connection reset.")
+	flag.DurationVar(&retryDelay, "profile.retrydelay", sqlimporter.DefaultRetryDelay, "Wait before the first retry of profiling, doubled for each next one.")
+	flag.IntVar(&analyzeTarget, "analyze.target", 0, "Statistics target of the analyze after loading. Defaults to the server setting.")
+	flag.BoolVar(&analyzeVerbose, "analyze.verbose", false, "Run a verbose analyze after loading.")
+	flag.BoolVar(&profileTable, "profile.table", false, "Write the statistics of the columns into a <table>_profile table after loading.")
+	flag.Int64Var(&maxRows, "limit.rows", 0, "Abort if the input has more rows. Zero is unlimited.")
+	flag.IntVar(&maxColumns, "limit.columns", 0, "Abort if the input has more columns. Zero is unlimited.")
+	flag.IntVar(&maxValues, "limit.values", 0, "Abort if a column has more distinct values held in memory while profiling. Zero is unlimited.")
+	flag.IntVar(&maxUnique, "limit.unique", 0, "Stop tracking the uniqueness of a column past this many distinct values rather than aborting. Its uniqueness is reported as unknown. Zero is unlimited.")
+	flag.IntVar(&examples, "examples", 0, "Number of values logged per column that caused its type to be generalized, such as to text.")
+	flag.IntVar(&enums, "enums", 0, "Log the values of enum-like columns with at most this many distinct values, such as a status. Zero disables detection.")
+	flag.BoolVar(&enumTypes, "enums.create", false, "Create an enum type for each enum-like text column with its values. At most 20 values unless -enums is set.")
+	flag.IntVar(&dirOpts.loadConcurrency, "concurrency", 0, "Maximum number of files loaded concurrently in directory mode. Zero is unlimited.")
+	flag.IntVar(&dirOpts.profileConcurrency, "profile.concurrency", runtime.NumCPU(), "Maximum number of files profiled concurrently in directory mode. Zero is unlimited.")
+	flag.StringVar(&dirOpts.schemaSep, "dir.sep", "_", "Separator joining nested directories into a schema name in directory mode.")
+	flag.IntVar(&dirOpts.schemaDepth, "dir.depth", 0, "Number of directories joined into the schema name in directory mode. Deeper directories are prefixed to the table name. Zero uses all directories.")
+	flag.BoolVar(&dirOpts.ordered, "ordered", false, "Load files in directory mode in order of their paths. Combine with -concurrency 1 to create tables in the same order on every run.")
+	flag.StringVar(&dirOpts.statePath, "state", "", "State file recording loaded files in directory mode. Files recorded and unchanged are skipped.")
 
 	flag.Parse()
 	args := flag.Args()
 
+	if err := applyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		log.Fatal(err)
+	}
+
+	// Unless -csv is given, the format of a file is detected from its
+	// extensions or its content.
+	var csvSet, schemaSet bool
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "csv":
+			csvSet = true
+		case "schema":
+			schemaSet = true
+		}
+	})
+
 	if len(args) == 0 {
-		log.Fatal("file name or directory required")
+		log.Fatal("file name, directory, or - for standard input required")
 	}
 
 	inputName := args[0]
 
+	// Options shared by all files.
+	base := sqlimporter.Request{
+		Database:        dbUrl,
+		CreateDatabase:  dbCreate,
+		Owner:           owner,
+		Quoting:         quoting,
+		Tablespace:      tablespace,
+		IndexTablespace: indexSpace,
+		Schema:          schemaName,
+		Table:           tableName,
+
+		AppendTable:      appendTable,
+		AppendNew:        appendNew,
+		MatchColumns:     matchCols,
+		TempTable:        tempTable,
+		OnExisting:       onExisting,
+		CStore:           useCstore,
+		CStoreStripeRows: stripeRows,
+		Unlogged:         unlogged,
+
+		IdentityColumn: identity,
+
+		PrimaryKey:         primaryKey,
+		PrimaryKeyFirst:    pkFirst,
+		ValidatePrimaryKey: pkValidate,
+
+		CSV:         csvSet && csvType && !jsonType && !ldjsonType,
+		JSON:        jsonType,
+		LDJSON:      ldjsonType,
+		Compression: compressionType,
+
+		JSONSeparator: jsonSep,
+		JSONMaxDepth:  jsonDepth,
+
+		Delimiter:   csvDelimiter,
+		Header:      !csvNoHeader,
+		MaxLineSize: csvMaxLine,
+
+		HeaderDelimiter:   headerDelim,
+		TypeHints:         typeHints,
+		Directives:        directives,
+		AllText:           allText,
+		SchemaOnly:        schemaOnly,
+		TypeConfidence:    confidence,
+		MaxIntDigits:      intDigits,
+		SkipTrailingLines: skipTrailing,
+		Offset:            rowOffset,
+		Limit:             rowLimit,
+		SingleTransaction: singleTx,
+		CheckCount:        checkCount,
+		PartitionPattern:  partition,
+		KeepLineEndings:   keepCR,
+		SnakeCase:         snakeCase,
+		NullSentinel:      copyNull,
+
+		MaxRows:           maxRows,
+		MaxColumns:        maxColumns,
+		MaxDistinctValues: maxValues,
+		MaxUniqueValues:   maxUnique,
+		MaxExamples:       examples,
+		MaxEnumValues:     enums,
+		EnumTypes:         enumTypes,
+
+		StatementTimeout: stmtTimeout,
+
+		ProfileRetries:    retries,
+		ProfileRetryDelay: retryDelay,
+
+		AnalyzeTarget:  analyzeTarget,
+		AnalyzeVerbose: analyzeVerbose,
+		ProfileTable:   profileTable,
+
+		FloatType: floatType,
+
+		SQLFile:      sqlFile,
+		SQLFormat:    sqlFormat,
+		SQLDelimiter: sqlDelim,
+		SQLNull:      sqlNull,
+
+		SQLCompressionLevel: sqlLevel,
+
+		RejectsFile: rejectsFile,
+		VerifyRows:  verifyRows,
+	}
+
+	// The schema of a directive line takes precedence over the default.
+	if directives && !schemaSet {
+		base.Schema = ""
+	}
+
+	if nullTokens != "" {
+		base.NullTokens = strings.Split(nullTokens, ",")
+	}
+
+	if recordSep != "" {
+		sep, err := strconv.Unquote(`"` + recordSep + `"`)
+		if err != nil {
+			log.Fatalf("invalid record separator: %s", recordSep)
+		}
+		base.RecordSeparator = sep
+	}
+
+	if includeCols != "" {
+		base.IncludeColumns = strings.Split(includeCols, ",")
+	}
+
+	if excludeCols != "" {
+		base.ExcludeColumns = strings.Split(excludeCols, ",")
+	}
+
+	if textColumns != "" {
+		base.TextColumns = strings.Split(textColumns, ",")
+	}
+
+	if keepEmpty != "" {
+		base.PreserveEmpty = strings.Split(keepEmpty, ",")
+	}
+
+	if normSpace != "" {
+		base.NormalizeSpace = strings.Split(normSpace, ",")
+	}
+
+	if rowHash {
+		base.RowHash = &sqlimporter.RowHash{Algorithm: hashAlgo}
+
+		if hashColumns != "" {
+			base.RowHash.Columns = strings.Split(hashColumns, ",")
+		}
+	}
+
+	if notNull != "" {
+		base.NotNullColumns = strings.Split(notNull, ",")
+	}
+
+	if nullable != "" {
+		base.NullableColumns = strings.Split(nullable, ",")
+	}
+
+	if coerce != "" {
+		m, err := parsePairs(coerce)
+		if err != nil {
+			log.Fatalf("invalid -coerce: %s", err)
+		}
+		base.Coerce = m
+	}
+
+	if rename != "" {
+		m, err := parsePairs(rename)
+		if err != nil {
+			log.Fatalf("invalid -rename: %s", err)
+		}
+		base.RenameColumns = m
+	}
+
+	if columnMap != "" {
+		m, err := parseMapping(columnMap)
+		if err != nil {
+			log.Fatalf("invalid -map: %s", err)
+		}
+		base.ColumnMap = m
+	}
+
+	if defaults != "" {
+		m, err := parsePairs(defaults)
+		if err != nil {
+			log.Fatalf("invalid -defaults: %s", err)
+		}
+		base.ColumnDefaults = m
+	}
+
+	if profileOnly {
+		base.Path = inputName
+		if err := printProfile(os.Stdout, base); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if verify {
+		base.Path = inputName
+		verifyFile(base)
+		return
+	}
+
+	if union {
+		writeResult(resultFile, loadFiles(args, base))
+		return
+	}
+
+	// Standard input has no file name to name the table after.
+	if inputName == "-" {
+		if base.Table == "" && !directives {
+			log.Fatal("-table is required when reading standard input")
+		}
+
+		writeResult(resultFile, loadFile("", base))
+		return
+	}
+
 	stat, _ := os.Stat(inputName)
 
-	if stat.IsDir() {
-		loadDir(
-			inputName,
-			dbUrl,
-			compressionType,
-			csvDelimiter,
-			appendTable,
-			useCstore,
-		)
+	if t, _ := reader.DetectType(inputName); t == "tar" && !stat.IsDir() {
+		// Directives are not read from the files of an archive.
+		base.Schema = schemaName
+		loadTar(inputName, base)
+	} else if stat.IsDir() && partition != "" {
+		writeResult(resultFile, loadPartitioned(inputName, base))
+	} else if stat.IsDir() {
+		if err := loadDir(inputName, base, dirOpts); err != nil {
+			log.Fatal(err)
+		}
 	} else {
-		loadFile(
-			inputName,
-			dbUrl,
-			schemaName,
-			tableName,
-			compressionType,
-			csvDelimiter,
-			csvType,
-			appendTable,
-			useCstore,
-			csvNoHeader,
-		)
+		writeResult(resultFile, loadFile(inputName, base))
 	}
 }
 
-func loadFile(path, dbUrl, schemaName, tableName, compressionType, csvDelimiter string, csvType, appendTable, useCstore, csvNoHeader bool) {
-	r := sqlimporter.Request{
-		Path: path,
+// envPrefix prefixes the environment variables setting flags.
+const envPrefix = "SQLIMPORTER_"
+
+// envName returns the environment variable of the flag, such as
+// SQLIMPORTER_CSV_DELIM for -csv.delim.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// applyEnv sets the flags not given on the command line from environment
+// variables, so flags take precedence over the environment and the
+// environment over the defaults.
+func applyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
 
-		Database: dbUrl,
-		Schema:   schemaName,
-		Table:    tableName,
+	var err error
 
-		AppendTable: appendTable,
-		CStore:      useCstore,
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
 
-		CSV:         csvType,
-		Compression: compressionType,
+		env := envName(f.Name)
+		if v, ok := lookup(env); ok {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid %s: %s", env, serr)
+			}
+		}
+	})
+
+	return err
+}
+
+// parsePairs parses a comma-separated list of key:value pairs.
+func parsePairs(s string) (map[string]string, error) {
+	m := make(map[string]string)
+
+	for _, p := range strings.Split(s, ",") {
+		toks := strings.SplitN(p, ":", 2)
+		if len(toks) != 2 || toks[0] == "" || toks[1] == "" {
+			return nil, fmt.Errorf("expected key:value, got %q", p)
+		}
 
-		Delimiter: csvDelimiter,
-		Header:    !csvNoHeader,
+		m[toks[0]] = toks[1]
 	}
 
-	if err := sqlimporter.Import(&r); err != nil {
+	return m, nil
+}
+
+// parseMapping parses the source:target pairs of a column map in order.
+func parseMapping(s string) ([]sqlimporter.ColumnMapping, error) {
+	var m []sqlimporter.ColumnMapping
+
+	for _, p := range strings.Split(s, ",") {
+		toks := strings.SplitN(p, ":", 2)
+		if len(toks) != 2 || toks[0] == "" || toks[1] == "" {
+			return nil, fmt.Errorf("expected source:target, got %q", p)
+		}
+
+		m = append(m, sqlimporter.ColumnMapping{Source: toks[0], Target: toks[1]})
+	}
+
+	return m, nil
+}
+
+func loadFile(path string, r sqlimporter.Request) *sqlimporter.Result {
+	r.Path = path
+
+	res, err := sqlimporter.Import(&r)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return res
+}
+
+// loadTar loads each file of the tar archive into its own table.
+func loadTar(path string, r sqlimporter.Request) {
+	r.Path = path
+
+	if _, err := sqlimporter.ImportTar(&r); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// verifyFile verifies the table against the file and exits non-zero if it
+// does not match.
+func verifyFile(r sqlimporter.Request) {
+	v, err := sqlimporter.Verify(&r)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	if !v.Match() {
+		log.Fatalf(`"%s"."%s" does not match %s: %s`, r.Schema, r.Table, r.Path, v)
+	}
+
+	log.Printf(`"%s"."%s" matches %s`, r.Schema, r.Table, r.Path)
 }
 
-func loadDir(rootDir, dbUrl, compressionType, csvDelimiter string, appendTable, useCstore bool) {
+// printProfile prints the columns the input would be loaded into with
+// their counts of nulls and distinct values.
+func printProfile(w io.Writer, r sqlimporter.Request) error {
+	r.CountDistinct = true
+
+	res, err := sqlimporter.Profile(&r)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "column\ttype\tnullable\tunique\tnulls\tdistinct")
+
+	for _, f := range res.Schema.Fields {
+		nulls, distinct := "-", "-"
+
+		// The fields of the profile are keyed by name as profiled.
+		if pf, ok := res.Profile.Fields[f.Name]; ok {
+			nulls = strconv.FormatInt(pf.NullCount, 10)
+			if pf.DistinctCount >= 0 {
+				distinct = strconv.FormatInt(pf.DistinctCount, 10)
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%s\t%s\n", f.Name, f.Type, f.Nullable, f.Unique, nulls, distinct)
+	}
+
+	return tw.Flush()
+}
+
+// loadFiles loads the files into one table.
+func loadFiles(paths []string, r sqlimporter.Request) *sqlimporter.Result {
+	res, err := sqlimporter.ImportFiles(paths, &r)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return res
+}
+
+// result is the JSON output of a load. Durations are in nanoseconds.
+type result struct {
+	Rows     int64               `json:"rows"`
+	Rejected int64               `json:"rejected"`
+	Skipped  bool                `json:"skipped"`
+	Timings  sqlimporter.Timings `json:"timings"`
+}
+
+// writeResult writes the result of the load as JSON to the path if set.
+func writeResult(path string, res *sqlimporter.Result) {
+	if path == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(result{
+		Rows:     res.Rows,
+		Rejected: res.Rejected,
+		Skipped:  res.Skipped,
+		Timings:  res.Timings,
+	}, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		log.Fatalf("cannot write result: %s", err)
+	}
+}
+
+// loadPartitioned loads the files directly in the directory into one table
+// partitioned by file name. The manifest of the directory applies to all
+// files.
+func loadPartitioned(dir string, r sqlimporter.Request) *sqlimporter.Result {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var paths []string
+
+	for _, info := range infos {
+		if !info.IsDir() && info.Name() != sqlimporter.ManifestName {
+			paths = append(paths, filepath.Join(dir, info.Name()))
+		}
+	}
+
+	m, err := sqlimporter.LoadManifest(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return loadFiles(paths, dirRequest(r, m))
+}
+
+// dirRequest returns the request of the files of a directory with the
+// manifest of the directory applied. The file type is detected and a
+// header is required unless the manifest says otherwise.
+func dirRequest(r sqlimporter.Request, m *sqlimporter.Manifest) sqlimporter.Request {
+	if !r.JSON && !r.LDJSON {
+		r.CSV = true
+	}
+	r.Header = true
+
+	m.Apply(&r)
+
+	return r
+}
+
+// dirOptions are options specific to loading a directory.
+type dirOptions struct {
+	loadConcurrency    int
+	profileConcurrency int
+	statePath          string
+
+	// If true, files are sorted by path and dispatched in order so tables
+	// are created in the same order on every run given a concurrency of 1.
+	ordered bool
+
+	// Nested directories are joined with the separator into the schema
+	// name. If depth is positive, only that many directories form the
+	// schema and the remaining are prefixed to the table name.
+	schemaSep   string
+	schemaDepth int
+}
+
+// dirTableName returns the schema and table names of a file given its path
+// relative to the root directory.
+func dirTableName(rpath string, opts dirOptions) (string, string) {
+	dir, name := filepath.Split(filepath.ToSlash(rpath))
+
+	tableName := strings.Split(name, ".")[0]
+
+	var dirs []string
+	if dir = strings.Trim(dir, "/"); dir != "" {
+		dirs = strings.Split(dir, "/")
+	}
+
+	if opts.schemaDepth > 0 && len(dirs) > opts.schemaDepth {
+		rest := append(dirs[opts.schemaDepth:], tableName)
+		tableName = strings.Join(rest, opts.schemaSep)
+		dirs = dirs[:opts.schemaDepth]
+	}
+
+	schemaName := strings.Join(dirs, opts.schemaSep)
+
+	if schemaName == "" {
+		schemaName = "public"
+	}
+
+	return schemaName, tableName
+}
+
+// importFile imports a file of a directory. Replaced in tests.
+var importFile = sqlimporter.Import
+
+// dirFile is a file of a directory to import.
+type dirFile struct {
+	rpath string
+	info  os.FileInfo
+	r     sqlimporter.Request
+}
+
+func loadDir(rootDir string, base sqlimporter.Request, opts dirOptions) error {
 	wg := &sync.WaitGroup{}
 
-	filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+	// Profiling is bounded separately from loading since it holds
+	// the most memory per file.
+	profileLimiter := sqlimporter.NewLimiter(opts.profileConcurrency)
+	loadLimiter := sqlimporter.NewLimiter(opts.loadConcurrency)
+
+	var (
+		state     *sqlimporter.State
+		stateFile string
+	)
+
+	if opts.statePath != "" {
+		var err error
+		if state, err = sqlimporter.LoadState(opts.statePath); err != nil {
+			return err
+		}
+
+		stateFile, _ = filepath.Abs(opts.statePath)
+	}
+
+	// Manifests keyed by directory.
+	manifests := make(map[string]*sqlimporter.Manifest)
+
+	var files []*dirFile
+
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
 		if info.IsDir() {
+			m, err := sqlimporter.LoadManifest(path)
+			if err != nil {
+				return err
+			}
+
+			manifests[filepath.Clean(path)] = m
 			return nil
 		}
 
-		rpath, _ := filepath.Rel(rootDir, path)
-		dir, base := filepath.Split(rpath)
+		if info.Name() == sqlimporter.ManifestName {
+			return nil
+		}
+
+		// The state file may be written within the directory.
+		if state != nil {
+			if abs, _ := filepath.Abs(path); abs == stateFile || strings.HasPrefix(info.Name(), ".sqlimporter-state") {
+				return nil
+			}
+		}
 
-		tableName := strings.Split(base, ".")[0]
-		schemaName := strings.Replace(strings.Trim(dir, "/"), "/", "_", -1)
+		rpath, _ := filepath.Rel(rootDir, path)
 
-		if schemaName == "" {
-			schemaName = "public"
+		if state != nil && state.Done(rpath, info) {
+			log.Printf("skipping loaded file %s", rpath)
+			return nil
 		}
 
-		r := sqlimporter.Request{
-			Path: path,
+		schemaName, tableName := dirTableName(rpath, opts)
 
-			Database: dbUrl,
-			Schema:   schemaName,
-			Table:    tableName,
+		r := dirRequest(base, manifests[filepath.Dir(path)])
+		r.Path = path
+		r.Schema = schemaName
+		r.Table = tableName
+		r.ProfileLimiter = profileLimiter
+
+		files = append(files, &dirFile{
+			rpath: rpath,
+			info:  info,
+			r:     r,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-			AppendTable: appendTable,
-			CStore:      useCstore,
+	if opts.ordered {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].rpath < files[j].rpath
+		})
+	}
 
-			CSV:         true,
-			Compression: compressionType,
+	for _, f := range files {
+		f := f
 
-			Delimiter: csvDelimiter,
-			Header:    true,
+		// Slots are acquired in order before dispatching so files are
+		// not started in the order goroutines happen to be scheduled.
+		if opts.ordered {
+			loadLimiter.Acquire()
 		}
 
 		wg.Add(1)
@@ -135,23 +816,34 @@ func loadDir(rootDir, dbUrl, compressionType, csvDelimiter string, appendTable,
 		go func() {
 			defer wg.Done()
 
+			if !opts.ordered {
+				loadLimiter.Acquire()
+			}
+			defer loadLimiter.Release()
+
 			defer func() {
 				if err := recover(); err != nil {
-					log.Printf("error loading file: %s", rpath)
+					log.Printf("error loading file: %s", f.rpath)
 					log.Printf("%s", err)
 				}
 			}()
 
-			log.Printf(`loading file %s into table "%s"."%s"`, rpath, schemaName, tableName)
+			log.Printf(`loading file %s into table "%s"."%s"`, f.rpath, f.r.Schema, f.r.Table)
 
-			if err := sqlimporter.Import(&r); err != nil {
+			if _, err := importFile(&f.r); err != nil {
 				log.Printf("error importing file: %s", err)
+				return
 			}
-		}()
 
-		return nil
-	})
+			if state != nil {
+				if err := state.Mark(f.rpath, f.info); err != nil {
+					log.Printf("error recording state: %s", err)
+				}
+			}
+		}()
+	}
 
 	wg.Wait()
 
+	return nil
 }
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chop-dbhi/sql-importer"
+)
+
+func TestDirTableName(t *testing.T) {
+	tests := []struct {
+		opts   dirOptions
+		path   string
+		schema string
+		table  string
+	}{
+		{dirOptions{schemaSep: "_"}, "orders.csv", "public", "orders"},
+		{dirOptions{schemaSep: "_"}, "sales/2023/orders.csv", "sales_2023", "orders"},
+		{dirOptions{schemaSep: "__"}, "sales/2023/orders.csv", "sales__2023", "orders"},
+		{dirOptions{schemaSep: "_", schemaDepth: 1}, "sales/2023/orders.csv", "sales", "2023_orders"},
+		{dirOptions{schemaSep: "_", schemaDepth: 1}, "sales/orders.csv", "sales", "orders"},
+		{dirOptions{schemaSep: "_", schemaDepth: 2}, "sales/2023/orders.csv", "sales_2023", "orders"},
+	}
+
+	for _, test := range tests {
+		schema, table := dirTableName(test.path, test.opts)
+
+		if schema != test.schema || table != test.table {
+			t.Errorf("%s with %+v: expected %s.%s, got %s.%s", test.path, test.opts, test.schema, test.table, schema, table)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"SQLIMPORTER_DB":        "postgres://env/db",
+		"SQLIMPORTER_SCHEMA":    "staging",
+		"SQLIMPORTER_CSV_DELIM": "|",
+	}
+
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	parse := func(args ...string) sqlimporter.Request {
+		var r sqlimporter.Request
+
+		fs := flag.NewFlagSet("sql-importer", flag.ContinueOnError)
+		fs.StringVar(&r.Database, "db", "", "")
+		fs.StringVar(&r.Schema, "schema", "public", "")
+		fs.StringVar(&r.Table, "table", "", "")
+		fs.StringVar(&r.Delimiter, "csv.delim", ",", "")
+
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := applyEnv(fs, lookup); err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	r := parse()
+
+	if r.Database != "postgres://env/db" || r.Schema != "staging" || r.Delimiter != "|" {
+		t.Errorf("expected environment to set the request, got %+v", r)
+	}
+
+	// Defaults are kept without a variable.
+	if r.Table != "" {
+		t.Errorf("expected default table, got %s", r.Table)
+	}
+
+	// Flags win over the environment.
+	r = parse("-schema", "public", "-csv.delim", ",")
+
+	if r.Schema != "public" || r.Delimiter != "," {
+		t.Errorf("expected flags to take precedence, got %+v", r)
+	}
+
+	if r.Database != "postgres://env/db" {
+		t.Errorf("expected environment database, got %s", r.Database)
+	}
+
+	// Invalid values are reported with the variable name.
+	fs := flag.NewFlagSet("sql-importer", flag.ContinueOnError)
+	fs.Int("limit.rows", 0, "")
+	env["SQLIMPORTER_LIMIT_ROWS"] = "many"
+
+	if err := applyEnv(fs, lookup); err == nil || !strings.Contains(err.Error(), "SQLIMPORTER_LIMIT_ROWS") {
+		t.Errorf("expected invalid variable error, got %v", err)
+	}
+}
+
+func TestLoadFileLDJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "people.ldjson")
+	sqlPath := filepath.Join(dir, "people.sql")
+
+	data := `{"name": "Joe", "age": 30, "address": {"zip": "19104"}}
+{"name": "Sue", "address": {"zip": "08002"}}
+`
+
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadFile(path, sqlimporter.Request{
+		Schema:  "public",
+		LDJSON:  true,
+		SQLFile: sqlPath,
+	})
+
+	b, err := ioutil.ReadFile(sqlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := string(b)
+
+	for _, s := range []string{
+		`"address_zip" text`,
+		`"age" integer`,
+		`"name" text`,
+		`copy "public"."people" ("address_zip", "age", "name") from stdin;`,
+		"19104\t30\tJoe\n",
+		"08002\t\\N\tSue\n",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("expected script to contain %q:\n%s", s, script)
+		}
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "people.csv")
+	resultPath := filepath.Join(dir, "result.json")
+
+	data := "id,name\n1,Joe\n2,Sue\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	writeResult(resultPath, loadFile(path, sqlimporter.Request{
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		SQLFile:   filepath.Join(dir, "people.sql"),
+	}))
+
+	b, err := ioutil.ReadFile(resultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res struct {
+		Rows    int64
+		Timings map[string]int64
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected 2 rows, got %d", res.Rows)
+	}
+
+	for _, phase := range []string{"profile", "create", "copy", "analyze"} {
+		if _, ok := res.Timings[phase]; !ok {
+			t.Errorf("expected %s timing in:\n%s", phase, b)
+		}
+	}
+
+	if res.Timings["profile"] <= 0 {
+		t.Errorf("expected profile timing, got %d", res.Timings["profile"])
+	}
+}
+
+func TestPrintProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.csv")
+
+	data := "id,name,dob\n1,Joe,2010-02-11\n2,,2008-02-24\n3,Joe,2008-02-24\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	err := printProfile(&b, sqlimporter.Request{
+		Path:      path,
+		Delimiter: ",",
+		Header:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+
+	exp := [][]string{
+		{"column", "type", "nullable", "unique", "nulls", "distinct"},
+		{"id", "integer", "false", "true", "0", "3"},
+		{"name", "text", "true", "false", "1", "1"},
+		{"dob", "date", "false", "false", "0", "2"},
+	}
+
+	if len(rows) != len(exp) {
+		t.Fatalf("expected %d lines, got:\n%s", len(exp), b.String())
+	}
+
+	for i, e := range exp {
+		if strings.Join(rows[i], " ") != strings.Join(e, " ") {
+			t.Errorf("line %d: expected %v, got %v", i, e, rows[i])
+		}
+	}
+}
+
+func TestLoadDirOrdered(t *testing.T) {
+	dir := t.TempDir()
+	out := t.TempDir()
+
+	files := map[string]string{
+		"visits.csv":        "id,score\n1,2.5\n2,3\n",
+		"people.csv":        "id,name\n1,Joe\n2,\n",
+		"sales/orders.csv":  "id,total\n1,10\n2,12\n",
+		"sales/refunds.csv": "id,date\n1,2010-02-11\n2,2010-02-12\n",
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(f func(*sqlimporter.Request) (*sqlimporter.Result, error)) {
+		importFile = f
+	}(importFile)
+
+	var (
+		mu      sync.Mutex
+		written []string
+	)
+
+	// Write the SQL of each file rather than loading it, and record the
+	// order the tables are written in.
+	importFile = func(r *sqlimporter.Request) (*sqlimporter.Result, error) {
+		r.SQLFile = filepath.Join(out, r.Schema+"."+r.Table+".sql")
+
+		res, err := sqlimporter.Import(r)
+
+		mu.Lock()
+		written = append(written, r.Schema+"."+r.Table)
+		mu.Unlock()
+
+		return res, err
+	}
+
+	run := func(concurrency int) (string, string) {
+		written = nil
+
+		opts := dirOptions{
+			loadConcurrency:    concurrency,
+			profileConcurrency: 4,
+			schemaSep:          "_",
+			ordered:            true,
+		}
+
+		if err := loadDir(dir, sqlimporter.Request{Delimiter: ","}, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		// The scripts are concatenated in path order.
+		var sql bytes.Buffer
+		for _, table := range []string{"public.people", "sales.orders", "sales.refunds", "public.visits"} {
+			b, err := ioutil.ReadFile(filepath.Join(out, table+".sql"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql.Write(b)
+		}
+
+		return strings.Join(written, " "), sql.String()
+	}
+
+	// With one load worker the tables are created in path order.
+	expOrder := "public.people sales.orders sales.refunds public.visits"
+
+	order, expSQL := run(1)
+	if order != expOrder {
+		t.Errorf("expected tables created in order %s, got %s", expOrder, order)
+	}
+
+	if !strings.Contains(expSQL, `"score" real`) || !strings.Contains(expSQL, `"date" date`) {
+		t.Errorf("expected the detected types in:\n%s", expSQL)
+	}
+
+	for i := 0; i < 2; i++ {
+		order, sql := run(1)
+		if order != expOrder {
+			t.Errorf("run %d: expected tables created in order %s, got %s", i, expOrder, order)
+		}
+		if sql != expSQL {
+			t.Errorf("run %d: expected identical SQL, got:\n%s", i, sql)
+		}
+	}
+
+	// With more workers the tables may be created in any order, but the
+	// statements of each are the same.
+	for i := 0; i < 2; i++ {
+		if _, sql := run(4); sql != expSQL {
+			t.Errorf("run %d with 4 workers: expected:\n%s\ngot:\n%s", i, expSQL, sql)
+		}
+	}
+}
+
+func TestLoadDirBadManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(dir, "sales"), 0755)
+
+	for name, data := range map[string]string{
+		"people.csv": "id,name\n1,Joe\n",
+		filepath.Join("sales", sqlimporter.ManifestName): `{"delimiter": `,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(f func(*sqlimporter.Request) (*sqlimporter.Result, error)) {
+		importFile = f
+	}(importFile)
+
+	imported := 0
+	importFile = func(r *sqlimporter.Request) (*sqlimporter.Result, error) {
+		imported++
+		return &sqlimporter.Result{}, nil
+	}
+
+	err := loadDir(dir, sqlimporter.Request{Delimiter: ","}, dirOptions{loadConcurrency: 1, profileConcurrency: 1})
+	if err == nil || !strings.Contains(err.Error(), "cannot decode manifest") {
+		t.Fatalf("expected manifest error, got %v", err)
+	}
+
+	if imported != 0 {
+		t.Errorf("expected no files imported, got %d", imported)
+	}
+}
+
+func TestLoadDirState(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, data := range map[string]string{
+		"people.csv": "id,name\n1,Joe\n",
+		"visits.csv": "id,score\n1,2.5\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(f func(*sqlimporter.Request) (*sqlimporter.Result, error)) {
+		importFile = f
+	}(importFile)
+
+	var (
+		mu       sync.Mutex
+		imported []string
+	)
+
+	importFile = func(r *sqlimporter.Request) (*sqlimporter.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		imported = append(imported, r.Table)
+		return &sqlimporter.Result{}, nil
+	}
+
+	// The state file is written within the directory and not imported.
+	opts := dirOptions{
+		loadConcurrency:    2,
+		profileConcurrency: 2,
+		statePath:          filepath.Join(dir, ".sqlimporter-state"),
+		ordered:            true,
+	}
+
+	run := func() []string {
+		imported = nil
+
+		if err := loadDir(dir, sqlimporter.Request{Delimiter: ","}, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Strings(imported)
+		return imported
+	}
+
+	if tables := run(); strings.Join(tables, " ") != "people visits" {
+		t.Errorf("expected every file imported on the first run, got %v", tables)
+	}
+
+	if tables := run(); len(tables) != 0 {
+		t.Errorf("expected unchanged files to be skipped, got %v", tables)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "visits.csv"), []byte("id,score\n1,2.5\n2,3.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if tables := run(); strings.Join(tables, " ") != "visits" {
+		t.Errorf("expected only the changed file imported, got %v", tables)
+	}
+}
@@ -0,0 +1,185 @@
+package sqlimporter
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// CStoreStripeRows is the default number of rows of each stripe of a
+// cstore table, which is the default of cstore_fdw.
+const CStoreStripeRows = 150000
+
+// rowSink receives the values of the rows loaded into the tables of a
+// load, one table per partition.
+type rowSink interface {
+	// Send sends the values of the row to the table at the index. The
+	// values may be reused once it returns.
+	Send(i int, values []interface{}) error
+
+	// Flush sends any buffered rows.
+	Flush() error
+}
+
+// copySink sends the rows to prepared copy statements. Nulls are sent as
+// the null sentinel if set.
+type copySink struct {
+	stmts []*sql.Stmt
+	null  string
+	args  []interface{}
+}
+
+func (c *Client) copySink(stmts ...*sql.Stmt) *copySink {
+	return &copySink{
+		stmts: stmts,
+		null:  c.NullSentinel,
+	}
+}
+
+func (s *copySink) Send(i int, values []interface{}) error {
+	if s.null != "" {
+		s.args = append(s.args[:0], values...)
+
+		for j, v := range s.args {
+			if v == nil {
+				s.args[j] = s.null
+			}
+		}
+
+		values = s.args
+	}
+
+	_, err := s.stmts[i].Exec(values...)
+	return err
+}
+
+func (s *copySink) Flush() error {
+	// Empty exec to flush the buffer.
+	for _, stmt := range s.stmts {
+		if _, err := stmt.Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stripeSink buffers the rows of cstore tables and inserts each batch with
+// a single statement. cstore_fdw writes a stripe per statement, so rows
+// copied or inserted one at a time are slow to load and to scan. The
+// batches of the tables of a partitioned load are inserted in parallel.
+type stripeSink struct {
+	txs     []txn
+	queries []string
+	rows    int
+	batches [][][]interface{}
+}
+
+// newStripeSink returns a sink inserting batches of rows into the tables
+// within the transactions. The columns of each table are inserted as
+// arrays cast to the types of the columns.
+func newStripeSink(txs []txn, quote func(string) string, schemaName string, tables []string, tableColumns [][]string, types map[string]string, rows int) *stripeSink {
+	if rows <= 0 {
+		rows = CStoreStripeRows
+	}
+
+	s := &stripeSink{
+		txs:     txs,
+		queries: make([]string, len(tables)),
+		rows:    rows,
+		batches: make([][][]interface{}, len(tables)),
+	}
+
+	for i, cols := range tableColumns {
+		quoted := make([]string, len(cols))
+		arrays := make([]string, len(cols))
+
+		for j, col := range cols {
+			quoted[j] = quote(col)
+			arrays[j] = fmt.Sprintf("$%d::text[]::%s[]", j+1, types[col])
+		}
+
+		s.queries[i] = fmt.Sprintf("insert into %s.%s (%s) select * from unnest(%s)", quote(schemaName), quote(tables[i]), strings.Join(quoted, ", "), strings.Join(arrays, ", "))
+	}
+
+	return s
+}
+
+func (s *stripeSink) Send(i int, values []interface{}) error {
+	s.batches[i] = append(s.batches[i], append([]interface{}(nil), values...))
+
+	// Every table receives each row, so the batches are full once the
+	// last one is.
+	if i == len(s.batches)-1 && len(s.batches[i]) >= s.rows {
+		return s.insert()
+	}
+
+	return nil
+}
+
+func (s *stripeSink) Flush() error {
+	if len(s.batches[0]) == 0 {
+		return nil
+	}
+
+	return s.insert()
+}
+
+// insert inserts the batches of the tables in parallel and empties them.
+func (s *stripeSink) insert() error {
+	errs := make([]error, len(s.batches))
+
+	var wg sync.WaitGroup
+
+	for i := range s.batches {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.insertBatch(i)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *stripeSink) insertBatch(i int) error {
+	batch := s.batches[i]
+
+	args := make([]interface{}, len(batch[0]))
+
+	for j := range args {
+		col := make([]sql.NullString, len(batch))
+
+		for k, row := range batch {
+			switch v := row[j].(type) {
+			case nil:
+			case string:
+				col[k] = sql.NullString{String: v, Valid: true}
+			default:
+				col[k] = sql.NullString{String: fmt.Sprint(v), Valid: true}
+			}
+		}
+
+		args[j] = pq.Array(col)
+	}
+
+	if _, err := s.txs[i].Exec(s.queries[i], args...); err != nil {
+		return fmt.Errorf("error inserting stripe: %w", err)
+	}
+
+	s.batches[i] = batch[:0]
+
+	return nil
+}
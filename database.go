@@ -0,0 +1,99 @@
+package sqlimporter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Database connected to when creating the target database.
+	maintenanceDatabase = "postgres"
+
+	// SQL states of the invalid_catalog_name error, returned when the
+	// database does not exist, and the duplicate_database error.
+	pgInvalidCatalogName = "3D000"
+	pgDuplicateDatabase  = "42P04"
+)
+
+// openDB opens and connects to the database of the request, so an
+// unreachable server is reported as a ConnectError before the input is
+// read. If CreateDatabase is set and the database does not exist, it is
+// created first.
+func openDB(r *Request) (*sql.DB, error) {
+	db, err := sql.Open("postgres", r.Database)
+	if err != nil {
+		return nil, &ConnectError{Err: err}
+	}
+
+	// SQL scripts are written without connecting.
+	if r.SQLFile != "" {
+		return db, nil
+	}
+
+	err = db.Ping()
+	if err == nil {
+		return db, nil
+	}
+
+	if !r.CreateDatabase || !isPQError(err, pgInvalidCatalogName) {
+		db.Close()
+		return nil, &ConnectError{Err: err}
+	}
+
+	if err := createDatabase(r.Database); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, &ConnectError{Err: err}
+	}
+
+	return db, nil
+}
+
+// createDatabase creates the database of the URL by connecting to the
+// maintenance database of the server. A database created concurrently is
+// not an error.
+func createDatabase(dbURL string) error {
+	u, err := url.Parse(dbURL)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return errors.New("creating the database requires a postgres:// URL")
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		return errors.New("creating the database requires a database name in the URL")
+	}
+
+	u.Path = "/" + maintenanceDatabase
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		return &ConnectError{Err: err}
+	}
+	defer db.Close()
+
+	log.Printf(`Creating database "%s"`, name)
+
+	// Databases cannot be created within a transaction.
+	_, err = db.Exec(fmt.Sprintf("create database %s", pq.QuoteIdentifier(name)))
+	if err != nil && !isPQError(err, pgDuplicateDatabase) {
+		return fmt.Errorf("error creating database: %s", err)
+	}
+
+	return nil
+}
+
+// isPQError returns true if the error carries the SQL state.
+func isPQError(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
@@ -0,0 +1,18 @@
+package sqlimporter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateDatabaseURL(t *testing.T) {
+	for _, u := range []string{
+		"host=localhost dbname=test",
+		"postgres://localhost:5432",
+		"postgres://localhost:5432/",
+	} {
+		if err := createDatabase(u); err == nil || !strings.Contains(err.Error(), "requires") {
+			t.Errorf("%s: expected an error, got %v", u, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package sqlimporter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff is the difference between the schema of a source and an existing
+// table. Columns are compared by their cleaned names.
+type Diff struct {
+	// Added are the columns of the source not in the table and Removed
+	// are the columns of the table not in the source, in the order of
+	// the source and the table.
+	Added   []string
+	Removed []string
+
+	// Changed are the columns in both whose types differ.
+	Changed []TypeChange
+}
+
+// TypeChange is a column whose type in the source differs from the table.
+type TypeChange struct {
+	Column string
+
+	// Type of the column in the table and in the source.
+	From string
+	To   string
+}
+
+// Empty returns true if the source matches the table.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d Diff) String() string {
+	var parts []string
+
+	for _, col := range d.Added {
+		parts = append(parts, "+"+col)
+	}
+
+	for _, col := range d.Removed {
+		parts = append(parts, "-"+col)
+	}
+
+	for _, c := range d.Changed {
+		parts = append(parts, fmt.Sprintf("%s: %s -> %s", c.Column, c.From, c.To))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+const tableTypesQuery = `select column_name, data_type, udt_name from information_schema.columns where table_schema = $1 and table_name = $2 order by ordinal_position`
+
+// DiffSchema compares the incoming schema against the existing table or
+// view, such as before appending a file to it. The identity and row id
+// columns of the table are not compared since they are not loaded from
+// the source. An error is returned if the table does not exist.
+func (c *Client) DiffSchema(schemaName, tableName string, incoming *Schema) (Diff, error) {
+	var diff Diff
+
+	rows, err := c.query(tableTypesQuery, c.ident(schemaName), c.ident(tableName))
+	if err != nil {
+		return diff, fmt.Errorf("error querying columns: %s", err)
+	}
+	defer rows.Close()
+
+	var (
+		existing []string
+		types    = make(map[string]string)
+	)
+
+	for rows.Next() {
+		var col, dataType, udtName string
+		if err := rows.Scan(&col, &dataType, &udtName); err != nil {
+			return diff, err
+		}
+
+		existing = append(existing, col)
+		types[col] = columnType(dataType, udtName)
+	}
+
+	if err := rows.Err(); err != nil {
+		return diff, err
+	}
+
+	if len(existing) == 0 {
+		return diff, fmt.Errorf("table does not exist: %s.%s", schemaName, tableName)
+	}
+
+	columns, _ := columnDefinitions(incoming, c.IndexTablespace, c.quote)
+	incomingTypes := columnTypes(incoming)
+
+	loaded := make(map[string]bool, len(columns))
+
+	for _, col := range columns {
+		loaded[col] = true
+
+		typ, ok := types[col]
+		if !ok {
+			diff.Added = append(diff.Added, col)
+			continue
+		}
+
+		if to := incomingTypes[col]; to != typ {
+			diff.Changed = append(diff.Changed, TypeChange{
+				Column: col,
+				From:   typ,
+				To:     to,
+			})
+		}
+	}
+
+	skip := map[string]bool{
+		rowIdColumn: true,
+	}
+
+	if incoming.Identity != "" {
+		skip[CleanIdentifier(incoming.Identity)] = true
+	}
+
+	for _, col := range existing {
+		if !loaded[col] && !skip[col] {
+			diff.Removed = append(diff.Removed, col)
+		}
+	}
+
+	return diff, nil
+}
+
+// Element types of arrays by their internal names.
+var arrayElemTypes = map[string]string{
+	"int4":      "integer",
+	"int8":      "bigint",
+	"float4":    "real",
+	"float8":    "double precision",
+	"bool":      "boolean",
+	"timestamp": "timestamp",
+}
+
+// columnType returns the type of the information schema column in the
+// form the schema uses, such as timestamp rather than timestamp without
+// time zone and integer[] for arrays.
+func columnType(dataType, udtName string) string {
+	switch dataType {
+	case "timestamp without time zone":
+		return "timestamp"
+
+	case "ARRAY":
+		elem := strings.TrimPrefix(udtName, "_")
+		if t, ok := arrayElemTypes[elem]; ok {
+			elem = t
+		}
+		return elem + "[]"
+	}
+
+	return dataType
+}
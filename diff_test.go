@@ -0,0 +1,71 @@
+package sqlimporter
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffSchema(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	b.query = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.Contains(query, "information_schema.columns") {
+			return nil, nil, fmt.Errorf("unexpected query: %s", query)
+		}
+
+		var rows [][]driver.Value
+		if args[0] == "public" && args[1] == "people" {
+			rows = [][]driver.Value{
+				{"pk", "integer", "int4"},
+				{"id", "integer", "int4"},
+				{"name", "text", "text"},
+				{"age", "integer", "int4"},
+				{"tags", "ARRAY", "_text"},
+				{"dob", "timestamp without time zone", "timestamp"},
+			}
+		}
+
+		return []string{"column_name", "data_type", "udt_name"}, rows, nil
+	}
+
+	incoming := &Schema{
+		Identity: "pk",
+		Fields: []*Field{
+			{Name: "ID", Type: "integer"},
+			{Name: "Name", Type: "text"},
+			{Name: "Age", Type: "real"},
+			{Name: "Tags", Type: "text[]"},
+			{Name: "Email", Type: "text"},
+		},
+	}
+
+	c := New(db)
+
+	diff, err := c.DiffSchema("public", "people", incoming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Diff{
+		Added:   []string{"email"},
+		Removed: []string{"dob"},
+		Changed: []TypeChange{
+			{Column: "age", From: "integer", To: "real"},
+		},
+	}
+
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %v, got %v", expected, diff)
+	}
+
+	if diff.Empty() {
+		t.Error("expected the diff not to be empty")
+	}
+
+	if _, err := c.DiffSchema("public", "missing", incoming); err == nil {
+		t.Error("expected an error for a missing table")
+	}
+}
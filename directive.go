@@ -0,0 +1,103 @@
+package sqlimporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// directive is the target of the input named by a directive line, such as
+// "#schema=sales #table=orders", preceding the header.
+//
+// A directive line starts with a # and is terminated by a newline. It
+// contains whitespace-separated #key=value pairs whose keys are schema
+// and table. Either may be omitted.
+type directive struct {
+	Schema string
+	Table  string
+}
+
+// parseDirective parses a directive line.
+func parseDirective(line string) (*directive, error) {
+	d := &directive{}
+
+	toks := strings.Fields(line)
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("invalid directive line: %q", line)
+	}
+
+	for _, tok := range toks {
+		kv := strings.SplitN(strings.TrimPrefix(tok, "#"), "=", 2)
+		if !strings.HasPrefix(tok, "#") || len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid directive %q, expected #key=value", tok)
+		}
+
+		switch kv[0] {
+		case "schema":
+			d.Schema = kv[1]
+		case "table":
+			d.Table = kv[1]
+		default:
+			return nil, fmt.Errorf("unknown directive: %s", kv[0])
+		}
+	}
+
+	return d, nil
+}
+
+// readDirective reads the directive line at the start of the input, if
+// any. The returned reader reads the input following it. The directive is
+// nil if the input does not start with a #.
+func readDirective(in io.Reader) (*directive, io.Reader, error) {
+	br := bufio.NewReader(in)
+
+	// Errors reading the input are returned by the reader.
+	if b, err := br.Peek(1); err != nil || b[0] != '#' {
+		return nil, br, nil
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	d, err := parseDirective(line)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return d, br, nil
+}
+
+// setDirective sets the schema and table of the request that are not set
+// from the directive line of the source, if any. The schema defaults to
+// public if neither sets it.
+func setDirective(r *Request, src source) error {
+	input, err := src.Open()
+	if err != nil {
+		return fmt.Errorf("cannot open input: %s", err)
+	}
+	defer input.Close()
+
+	d, _, err := readDirective(input)
+	if err != nil {
+		return err
+	}
+
+	if d != nil {
+		if r.Schema == "" {
+			r.Schema = d.Schema
+		}
+
+		if r.Table == "" {
+			r.Table = d.Table
+		}
+	}
+
+	if r.Schema == "" {
+		r.Schema = "public"
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package sqlimporter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultMaxEnumValues is the most distinct values of a column made an
+// enum type if the limit is not set, so high-cardinality columns remain
+// text.
+const DefaultMaxEnumValues = 20
+
+// enumTypeName returns the name of the enum type of the column of the
+// table, such as people_status.
+func enumTypeName(tableName, column string) string {
+	return fmt.Sprintf("%s_%s", tableName, CleanIdentifier(column))
+}
+
+// createEnumTypes creates the enum types of the enum fields of the table
+// and makes them the types of the fields. Since the types are used by the
+// table being replaced on reload, existing types are not recreated. The
+// values not in them are added instead and values no longer present are
+// kept since enum values cannot be dropped.
+func (c *Client) createEnumTypes(schemaName, tableName string, tableSchema *Schema) error {
+	defer c.timed(&c.timings.Create, time.Now())
+
+	for _, f := range tableSchema.Fields {
+		if len(f.Enum) == 0 {
+			continue
+		}
+
+		// Values added within a transaction cannot be used before it
+		// is committed.
+		if c.tx != nil {
+			return errors.New("enum types are not supported within a transaction")
+		}
+
+		values := make([]string, len(f.Enum))
+		for i, v := range f.Enum {
+			values[i] = pq.QuoteLiteral(v)
+		}
+
+		data := &tableData{
+			Schema: schemaName,
+			Type:   enumTypeName(tableName, f.Name),
+			Values: strings.Join(values, ", "),
+		}
+
+		var b bytes.Buffer
+		if err := executeTmpl(&b, "createEnumType", data, c.Quoting); err != nil {
+			return err
+		}
+
+		err := c.execTx(func(tx txn) error {
+			sql := b.String()
+			if _, err := tx.Exec(sql); err != nil {
+				return fmt.Errorf("error creating enum type: %s\n%s", err, sql)
+			}
+
+			return c.setOwner(tx, "typeOwner", data)
+		})
+		if err != nil {
+			return err
+		}
+
+		// Values cannot be added within a transaction block before
+		// Postgres 12.
+		for _, v := range values {
+			data.Values = v
+
+			b.Reset()
+			if err := executeTmpl(&b, "addEnumValue", data, c.Quoting); err != nil {
+				return err
+			}
+
+			sql := b.String()
+			if _, err := c.db.Exec(sql); err != nil {
+				return fmt.Errorf("error adding enum value: %s\n%s", err, sql)
+			}
+		}
+
+		f.Type = c.quote(schemaName) + "." + c.quote(data.Type)
+	}
+
+	return nil
+}
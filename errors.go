@@ -0,0 +1,132 @@
+package sqlimporter
+
+import (
+	libcsv "encoding/csv"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chop-dbhi/sql-importer/profile/csv"
+	"github.com/lib/pq"
+)
+
+// ParseError is returned if the input cannot be parsed, such as a CSV
+// field with a bare quote or malformed JSON. The line and column are
+// 1-based and zero if unknown.
+type ParseError struct {
+	// Path of the input or empty if read from a stream.
+	Path string
+
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	var pos string
+
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		pos = fmt.Sprintf(" at line %d, column %d", e.Line, e.Column)
+	case e.Line > 0:
+		pos = fmt.Sprintf(" at line %d", e.Line)
+	}
+
+	if e.Path != "" {
+		return fmt.Sprintf("cannot parse %s%s: %s", e.Path, pos, e.Err)
+	}
+
+	return fmt.Sprintf("cannot parse input%s: %s", pos, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectError is returned if the database cannot be connected to.
+type ConnectError struct {
+	Err error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("cannot connect to db: %s", e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is returned if the data cannot be loaded into the table, such
+// as a constraint violation. Errors returned by Postgres can be
+// retrieved with errors.As as a *pq.Error.
+type LoadError struct {
+	Schema string
+	Table  string
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("error loading: %s", e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the SQL state of the Postgres error that failed the load,
+// such as 23505 for a unique violation, or an empty string.
+func (e *LoadError) Code() string {
+	var pqErr *pq.Error
+	if errors.As(e.Err, &pqErr) {
+		return string(pqErr.Code)
+	}
+
+	return ""
+}
+
+// parseError returns a ParseError if the error is due to malformed input
+// and the error as is otherwise.
+func parseError(path string, err error) error {
+	var (
+		csvErr    *csv.ParseError
+		libcsvErr *libcsv.ParseError
+		syntaxErr *stdjson.SyntaxError
+	)
+
+	switch {
+	case errors.As(err, &csvErr):
+		return &ParseError{Path: path, Line: csvErr.Line, Column: csvErr.Column, Err: csvErr.Err}
+	case errors.As(err, &libcsvErr):
+		return &ParseError{Path: path, Line: libcsvErr.Line, Column: libcsvErr.Column, Err: libcsvErr.Err}
+	case errors.As(err, &syntaxErr):
+		return &ParseError{Path: path, Err: syntaxErr}
+	}
+
+	return err
+}
+
+// isTransient returns true if the error may not recur if the operation is
+// retried, such as a timeout or a connection reset of a network read.
+// Errors of the net and syscall packages report it.
+func isTransient(err error) bool {
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) && temp.Temporary() {
+		return true
+	}
+
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// sourcePath returns the path of the source or an empty string if it is a
+// stream. Files of an archive are joined to the path of the archive.
+func sourcePath(src source) string {
+	switch s := src.(type) {
+	case *fileSource:
+		return s.path
+	case *tarSource:
+		return s.archive + "/" + s.name
+	}
+
+	return ""
+}
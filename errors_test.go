@@ -0,0 +1,108 @@
+package sqlimporter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestImportParseError(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	path := writeTempFile(t, "data.csv", "id,name\n1,Joe\n2,S\"ue\n")
+
+	r := &Request{
+		Path:      path,
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	_, err := importDB(db, r)
+
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+
+	if perr.Path != path {
+		t.Errorf("expected path %s, got %s", path, perr.Path)
+	}
+
+	if perr.Line != 3 {
+		t.Errorf("expected line 3, got %d", perr.Line)
+	}
+}
+
+func TestImportJSONParseError(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	r := &Request{
+		Path:   writeTempFile(t, "data.json", `[{"id": 1}, {"id": }]`),
+		Schema: "public",
+	}
+
+	_, err := importDB(db, r)
+
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestImportLoadError(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	b.execErr = func(query string) error {
+		if strings.HasPrefix(query, "COPY") {
+			return &pq.Error{Code: "23505", Message: "duplicate key value"}
+		}
+		return nil
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "data.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	_, err := importDB(db, r)
+
+	var lerr *LoadError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expected load error, got %v", err)
+	}
+
+	if lerr.Table != "data" {
+		t.Errorf("expected table data, got %s", lerr.Table)
+	}
+
+	if lerr.Code() != "23505" {
+		t.Errorf("expected code 23505, got %q", lerr.Code())
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		t.Error("expected the postgres error to be wrapped")
+	}
+}
+
+func TestImportConnectError(t *testing.T) {
+	r := &Request{
+		Path:      writeTempFile(t, "data.csv", "id,name\n1,Joe\n"),
+		Database:  "postgres://127.0.0.1:1/db?sslmode=disable&connect_timeout=1",
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	_, err := Import(r)
+
+	var cerr *ConnectError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected connect error, got %v", err)
+	}
+}
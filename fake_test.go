@@ -0,0 +1,287 @@
+package sqlimporter
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The fake backend is a minimal database/sql driver that records the
+// statements it receives and the rows sent through COPY. It allows the
+// client to be tested without a running Postgres server.
+
+var (
+	fakeBackends   = make(map[string]*fakeBackend)
+	fakeBackendsMu sync.Mutex
+	fakeBackendSeq int
+
+	fakeCopyTable   = regexp.MustCompile(`^COPY (\S+) `)
+	fakeCreateTable = regexp.MustCompile(`(?i)^create (?:\w+ )*table (?:if not exists )?(\S+)`)
+	fakeDropTable   = regexp.MustCompile(`(?i)^drop table (?:if exists )?(\S+)`)
+	fakeRenameTable = regexp.MustCompile(`(?i)^alter table ((\S+)\.\S+) rename to (\S+)`)
+)
+
+func init() {
+	sql.Register("sqlimporter-fake", fakeDriver{})
+}
+
+type fakeBackend struct {
+	mu sync.Mutex
+
+	// Committed statements, tables, and rows keyed by the quoted
+	// table name.
+	execs  []string
+	tables map[string]string
+	copies map[string][][]interface{}
+
+	// Optional hooks to fail statements or answer queries.
+	execErr func(query string) error
+	query   func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+}
+
+// fakeOp is a statement or a copied row pending in a transaction.
+type fakeOp struct {
+	exec  string
+	table string
+	row   []interface{}
+}
+
+func fakeTableName(schema, table string) string {
+	return fmt.Sprintf(`"%s"."%s"`, schema, table)
+}
+
+// copied returns the committed rows copied into the table.
+func (b *fakeBackend) copied(schema, table string) [][]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.copies[fakeTableName(schema, table)]
+}
+
+// table returns the statement that created the table if it exists.
+func (b *fakeBackend) table(schema, table string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stmt, ok := b.tables[fakeTableName(schema, table)]
+	return stmt, ok
+}
+
+// executed returns the committed statements containing the substring.
+func (b *fakeBackend) executed(substr string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var stmts []string
+	for _, s := range b.execs {
+		if strings.Contains(s, substr) {
+			stmts = append(stmts, s)
+		}
+	}
+	return stmts
+}
+
+// commit applies the operations in order. Table creation, renames, and
+// drops are tracked so rows follow the table they were copied into.
+func (b *fakeBackend) commit(ops []fakeOp) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, op := range ops {
+		if op.exec == "" {
+			b.copies[op.table] = append(b.copies[op.table], op.row)
+			continue
+		}
+
+		b.execs = append(b.execs, op.exec)
+
+		if m := fakeCreateTable.FindStringSubmatch(op.exec); m != nil {
+			if _, ok := b.tables[m[1]]; !ok {
+				b.tables[m[1]] = op.exec
+			}
+		} else if m := fakeDropTable.FindStringSubmatch(op.exec); m != nil {
+			delete(b.tables, m[1])
+			delete(b.copies, m[1])
+		} else if m := fakeRenameTable.FindStringSubmatch(op.exec); m != nil {
+			to := fmt.Sprintf("%s.%s", m[2], m[3])
+			b.tables[to] = b.tables[m[1]]
+			b.copies[to] = b.copies[m[1]]
+			delete(b.tables, m[1])
+			delete(b.copies, m[1])
+		}
+	}
+}
+
+func newFakeDB(t testing.TB) (*sql.DB, *fakeBackend) {
+	fakeBackendsMu.Lock()
+	fakeBackendSeq++
+	name := fmt.Sprintf("fake-%d", fakeBackendSeq)
+	b := &fakeBackend{
+		tables: make(map[string]string),
+		copies: make(map[string][][]interface{}),
+	}
+	fakeBackends[name] = b
+	fakeBackendsMu.Unlock()
+
+	db, err := sql.Open("sqlimporter-fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db, b
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeBackendsMu.Lock()
+	defer fakeBackendsMu.Unlock()
+
+	b, ok := fakeBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake backend: %s", name)
+	}
+
+	return &fakeConn{b: b}, nil
+}
+
+type fakeConn struct {
+	b  *fakeBackend
+	tx *fakeTx
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("fake: transaction already open")
+	}
+
+	c.tx = &fakeTx{c: c}
+
+	return c.tx, nil
+}
+
+// apply adds the operation to the open transaction or commits it
+// immediately.
+func (c *fakeConn) apply(op fakeOp) {
+	if c.tx != nil {
+		c.tx.ops = append(c.tx.ops, op)
+	} else {
+		c.b.commit([]fakeOp{op})
+	}
+}
+
+type fakeTx struct {
+	c   *fakeConn
+	ops []fakeOp
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.c.b.commit(tx.ops)
+	tx.c.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.c.tx = nil
+	return nil
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	b := s.c.b
+
+	if b.execErr != nil {
+		if err := b.execErr(s.query); err != nil {
+			return nil, err
+		}
+	}
+
+	if m := fakeCopyTable.FindStringSubmatch(s.query); m != nil {
+		// An empty exec flushes the copy buffer. The statement is
+		// recorded so the copied columns can be checked.
+		if len(args) == 0 {
+			s.c.apply(fakeOp{exec: s.query})
+			return driver.RowsAffected(0), nil
+		}
+
+		row := make([]interface{}, len(args))
+		for i, a := range args {
+			row[i] = a
+		}
+
+		s.c.apply(fakeOp{table: m[1], row: row})
+
+		return driver.RowsAffected(1), nil
+	}
+
+	s.c.apply(fakeOp{exec: s.query})
+
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	b := s.c.b
+
+	if b.query == nil {
+		return nil, fmt.Errorf("fake: unexpected query: %s", s.query)
+	}
+
+	cols, rows, err := b.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.cols
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
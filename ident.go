@@ -0,0 +1,104 @@
+package sqlimporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Styles of quoting of the identifiers of the generated statements.
+const (
+	// QuoteAlways double quotes every identifier.
+	QuoteAlways = "always"
+
+	// QuoteMinimal lowercases identifiers, as Postgres folds unquoted
+	// names, and leaves them unquoted unless they are keywords or start
+	// with a digit, such as for tools that do not handle quoted
+	// identifiers. Names that differ only by case name the same object.
+	QuoteMinimal = "minimal"
+)
+
+// Keywords of Postgres that cannot be used as unquoted names in every
+// context: the reserved keywords and those that can only name columns or
+// only types and functions.
+var sqlKeywords = make(map[string]struct{})
+
+func init() {
+	for _, k := range strings.Fields(`
+		all analyse analyze and any array as asc asymmetric authorization
+		between bigint binary bit boolean both case cast char character check
+		coalesce collate collation column concurrently constraint create
+		cross current_catalog current_date current_role current_schema
+		current_time current_timestamp current_user dec decimal default
+		deferrable desc distinct do else end except exists extract false
+		fetch float for foreign freeze from full grant greatest group
+		grouping having ilike in initially inner inout int integer intersect
+		interval into is isnull join lateral leading least left like limit
+		localtime localtimestamp national natural nchar none normalize not
+		notnull null nullif numeric offset on only or order out outer
+		overlaps overlay placing position precision primary real references
+		returning right row select session_user setof similar smallint some
+		substring symmetric system_user table tablesample then time
+		timestamp to trailing treat trim true union unique user using values
+		varchar variadic verbose when where window with xmlattributes
+		xmlconcat xmlelement xmlexists xmlforest xmlparse xmlpi xmlroot
+		xmlserialize xmltable
+	`) {
+		sqlKeywords[k] = struct{}{}
+	}
+}
+
+// ValidateQuoting returns an error if the quoting style is not supported.
+func ValidateQuoting(style string) error {
+	switch style {
+	case "", QuoteAlways, QuoteMinimal:
+		return nil
+	}
+
+	return fmt.Errorf("identifier quoting not supported: %s", style)
+}
+
+// quoteIdent quotes the identifier in the style, which defaults to
+// QuoteAlways.
+func quoteIdent(style, name string) string {
+	name = identName(style, name)
+
+	if style == QuoteMinimal && !needsQuotes(name) {
+		return name
+	}
+
+	return pq.QuoteIdentifier(name)
+}
+
+// identName returns the name of the object created for the identifier
+// in the style, which is lowercased with QuoteMinimal so the unquoted
+// and quoted uses of the name agree.
+func identName(style, name string) string {
+	if style == QuoteMinimal {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
+// needsQuotes returns true if the name must be quoted to mean the same,
+// since it is not made of lowercase letters, digits, and underscores
+// starting with a letter or underscore, or it is a keyword.
+func needsQuotes(name string) bool {
+	if name == "" {
+		return true
+	}
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return true
+		}
+	}
+
+	_, ok := sqlKeywords[name]
+	return ok
+}
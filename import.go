@@ -1,14 +1,27 @@
 package sqlimporter
 
 import (
+	"bufio"
+	"compress/gzip"
 	"database/sql"
 	libcsv "encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/chop-dbhi/sql-importer/profile"
 	"github.com/chop-dbhi/sql-importer/profile/csv"
+	"github.com/chop-dbhi/sql-importer/profile/json"
 	"github.com/chop-dbhi/sql-importer/reader"
 )
 
@@ -21,92 +34,2148 @@ type Request struct {
 	Schema   string
 	Table    string
 
+	// CreateDatabase creates the database if it does not exist by
+	// connecting to the postgres database of the server. The database
+	// must be a postgres:// URL.
+	CreateDatabase bool
+
+	// Owner is the role made the owner of the created schema, table, and
+	// views, such as a service role, rather than the connecting user.
+	Owner string
+
+	// Quoting is the style of quoting of the identifiers of the created
+	// objects and the SQL script: QuoteAlways, the default, or
+	// QuoteMinimal to only quote the names that need it, such as for
+	// tools that do not handle quoted identifiers.
+	Quoting string
+
 	// Behavior
 	AppendTable bool
 	CStore      bool
 
-	// File specifics.
+	// CStoreStripeRows is the number of rows of each stripe of a cstore
+	// table. Rows are inserted in batches of a stripe since cstore_fdw
+	// writes a stripe per statement. It defaults to CStoreStripeRows.
+	CStoreStripeRows int
+
+	// Unlogged creates the table without write-ahead logging for faster
+	// loads. The table is emptied if the server crashes, so it is only
+	// suitable for staging data that can be reloaded.
+	Unlogged bool
+
+	// Name of an auto-incrementing primary key column added to the table.
+	IdentityColumn string
+
+	// PrimaryKey is the name of a column made the primary key, which is
+	// commonly a unique key in the first column. If PrimaryKeyFirst is
+	// set, the first column is used. The column is not null and the load
+	// fails on duplicate values. If ValidatePrimaryKey is set, duplicates
+	// and nulls are reported after profiling, before anything is loaded.
+	// It is not supported when multiple files are loaded into one table.
+	PrimaryKey         string
+	PrimaryKeyFirst    bool
+	ValidatePrimaryKey bool
+
+	// RowHash adds a column containing a hash of the values of each row.
+	RowHash *RowHash
+
+	// OnExisting is the policy if the table exists and is not appended
+	// to: ExistingReplace, ExistingFail, or ExistingSkip. The table is
+	// replaced if not set.
+	OnExisting string
+
+	// TempTable loads into a temporary table that is discarded after the
+	// load, which validates the data against the table without persisting
+	// it. The schema is ignored.
+	TempTable bool
+
+	// SingleTransaction creates, loads, and renames the table within a
+	// single transaction, so a failure leaves neither a partial table
+	// nor the schema behind and the existing table is swapped atomically.
+	// Each file of a directory is loaded in its own transaction. Enum
+	// types and tables too wide to be created without partitioning are
+	// not supported.
+	SingleTransaction bool
+
+	// CheckCount counts the rows of the loaded tables and fails the load
+	// with ErrCountMismatch if they are not the rows read from the file.
+	CheckCount bool
+
+	// Tablespace is the tablespace of the created tables and
+	// IndexTablespace that of the indexes of their primary keys and
+	// unique columns, in the Postgres database and the SQL script.
+	Tablespace      string
+	IndexTablespace string
+
+	// PartitionPattern is a regular expression with one group matched
+	// against the base name of each file of ImportFiles, such as
+	// _(\d{4}_\d{2})\. for events_2023_01.csv. The files are loaded into
+	// one table partitioned by list on the PartitionColumn, with a
+	// partition per file whose key is the matched group. The table name
+	// defaults to the base name of the first file before the match.
+	PartitionPattern string
+
+	// VerifyRows compares the number of rows of the file and the table
+	// when verifying the table against the file with Verify.
+	VerifyRows bool
+
+	// MatchColumns appends to an existing table by copying only the source
+	// columns, so the other columns of the table take their defaults. The
+	// load fails if a source column is not in the table.
+	MatchColumns bool
+
+	// AppendNew appends only the rows whose row hash is not already in
+	// the table. The default row hash is used if RowHash is not set.
+	AppendNew bool
+
+	// File specifics. JSON is an array of objects and LDJSON is
+	// newline-delimited objects. CSV is used if neither is set.
 	CSV         bool
+	JSON        bool
+	LDJSON      bool
 	Compression string
 
+	// Separator joining the keys of nested JSON objects into column
+	// names. It defaults to an underscore.
+	JSONSeparator string
+
+	// Number of levels of nested JSON objects flattened into columns.
+	// Objects nested deeper are loaded as jsonb. There is no limit if zero.
+	JSONMaxDepth int
+
 	// CSV
-	Delimiter string
-	Header    bool
+	Delimiter   string
+	Header      bool
+	MaxLineSize int
+
+	// TypeHints is true if the header is followed by a line of the types
+	// of the columns, such as int,string,date. Columns are given the type
+	// of their hint if their values match it, which is checked while
+	// profiling. Columns with an empty hint are inferred.
+	TypeHints bool
+
+	// Directives is true if the input may start with a directive line
+	// preceding the header, such as "#schema=sales #table=orders", that
+	// names the schema and table the input is loaded into if they are not
+	// set. The line is skipped. The directive of the first file or of the
+	// stream is used and the schema defaults to public if neither sets it.
+	Directives bool
+
+	// HeaderDelimiter is the delimiter of the header if it differs from
+	// the delimiter of the rows, such as a pipe-delimited header followed
+	// by comma-delimited rows. The Delimiter is used if not set.
+	HeaderDelimiter string
+
+	// RecordSeparator terminates the records of CSV input if they are not
+	// terminated by newlines, such as the ASCII record separator "\x1e"
+	// or a null byte. Newlines are then part of the values. Header
+	// delimiters and trailing lines are not supported with it.
+	RecordSeparator string
+
+	// SkipTrailingLines is the number of lines at the end of the input
+	// that are not loaded, such as a trailer with a record count. Blank
+	// lines are not counted.
+	SkipTrailingLines int
+
+	// Offset is the number of rows of each input after the header that
+	// are skipped and Limit the most rows loaded after them, such as rows
+	// 1,000,001 to 2,000,000 for a test or an incremental load. The same
+	// rows are profiled. There is no limit if zero and the table is empty
+	// if the offset is past the end of the input.
+	Offset int64
+	Limit  int64
+
+	// SnakeCase converts camelCase and PascalCase column names to
+	// snake_case, such as FirstName to first_name and HTTPStatus to
+	// http_status, rather than only lowercasing them. Options naming
+	// columns refer to the converted names.
+	SnakeCase bool
+
+	// KeepLineEndings disables the rewriting of carriage returns to
+	// newlines. Set it for files terminated by \n that contain carriage
+	// returns in quoted values, which would be corrupted otherwise.
+	KeepLineEndings bool
+
+	// Values treated as nulls in addition to empty strings, such as \N.
+	NullTokens []string
+
+	// PreserveEmpty are glob patterns of text columns whose empty
+	// strings are loaded as empty strings rather than nulls.
+	PreserveEmpty []string
+
+	// NormalizeSpace are glob patterns of text columns, such as * for all
+	// of them, whose values have runs of whitespace, including tabs and
+	// line breaks, collapsed to single spaces and are trimmed before they
+	// are loaded. Values are profiled as is.
+	NormalizeSpace []string
+
+	// NullSentinel is the null marker of the COPY statements and of the
+	// SQL script, unless SQLNull is set, rather than \N. Values are
+	// escaped when loading, so values equal to \N are loaded as is
+	// either way. Values equal to the sentinel fail the load since they
+	// would be loaded as nulls. Nulls and empty strings are loaded as
+	// distinct values with PreserveEmpty.
+	NullSentinel string
+
+	// Limits aborting the import of inputs with more rows, columns, or
+	// distinct values of a column than expected. Zero is unlimited.
+	MaxRows           int64
+	MaxColumns        int
+	MaxDistinctValues int
+
+	// MaxUniqueValues caps the distinct values of a column held to track
+	// its uniqueness rather than aborting. Columns past the cap are not
+	// unique constraints and cannot be validated as primary keys.
+	MaxUniqueValues int
+
+	// CountDistinct counts the distinct values of each column into the
+	// profile, holding up to MaxUniqueValues of them per column.
+	CountDistinct bool
+
+	// MaxExamples is the number of values per column that caused its
+	// type to be generalized, such as to text, that are kept and logged.
+	MaxExamples int
+
+	// MaxEnumValues is the most distinct values of a column reported as
+	// enum-like, such as a status, to help decide on an enum type or a
+	// check constraint. Enums are not detected if zero.
+	MaxEnumValues int
+
+	// EnumTypes creates an enum type for each enum-like text column with
+	// its values and uses it as the type of the column. MaxEnumValues
+	// defaults to DefaultMaxEnumValues. On reload the values not in the
+	// type are added. Enum types are not created for temporary tables or
+	// SQL output.
+	EnumTypes bool
+
+	// SchemaOnly creates the empty table from the header of the CSV file
+	// without loading any rows, such as to create it before data is
+	// streamed into it. Columns are typed by the type hints, if any, and
+	// are nullable text otherwise. Rows after the header are ignored.
+	SchemaOnly bool
+
+	// StatementTimeout aborts statements that take longer, such as a copy
+	// waiting on a locked table. There is no timeout if zero.
+	StatementTimeout time.Duration
+
+	// Statistics target and verbosity of the analyze run after loading.
+	// The server's default target is used if zero.
+	AnalyzeTarget  int
+	AnalyzeVerbose bool
+
+	// ProfileTable writes the statistics of the columns of the table into
+	// a companion table named with the ProfileTableSuffix after loading.
+	ProfileTable bool
+
+	// Schema. FloatType is one of FloatAuto, FloatReal, or FloatDouble.
+	FloatType string
+
+	// Coerce maps column names to a type (integer, float, boolean, date,
+	// datetime, or string). Values that do not match the type are loaded
+	// as nulls rather than generalizing the column to text.
+	Coerce map[string]string
+
+	// TextColumns are glob patterns, such as zip or *_code, for columns
+	// that are typed as text regardless of the inferred type.
+	TextColumns []string
+
+	// TypeConfidence is the fraction of the values of a column, such as
+	// 0.99, that must match a type for the column to keep it rather than
+	// be generalized to text. The other values are loaded as nulls. Every
+	// value must match if zero.
+	TypeConfidence float64
+
+	// MaxIntDigits is the most digits of the values of an integer column.
+	// Columns with longer values, such as phone and account numbers, are
+	// typed as text since they are identifiers that would overflow. There
+	// is no limit if zero, the default of a Request, so columns with values
+	// of more than 9 digits are bigint. The command line defaults it to 9
+	// with -int.digits, typing such columns as text instead.
+	MaxIntDigits int
+
+	// Detectors classify values of custom types, such as diagnosis codes,
+	// before the built-in types. SQLTypes maps the custom types to the
+	// SQL types of their columns, which are text otherwise.
+	Detectors []profile.Detector
+	SQLTypes  map[profile.ValueType]string
+
+	// AllText types every column as text without detecting the types of
+	// the values, which speeds up profiling large files. Uniqueness is
+	// only tracked if the primary key is validated.
+	AllText bool
+
+	// IncludeColumns and ExcludeColumns are names or glob patterns, such
+	// as tmp_* or *_internal, of the columns to load and to skip. All
+	// columns are loaded if IncludeColumns is empty.
+	IncludeColumns []string
+	ExcludeColumns []string
+
+	// NotNullColumns and NullableColumns force the nullability of the
+	// columns regardless of whether nulls are observed. The load fails if
+	// a not null column contains a null.
+	NotNullColumns  []string
+	NullableColumns []string
+
+	// RejectsFile is the path of a CSV file the rows with a null in a not
+	// null column or a value not matching the type of its column are
+	// written to rather than failing the load. The rows are written as
+	// read with the delimiter of the input and the error in the
+	// RejectErrorColumn. It is compressed if the path ends in .gz.
+	RejectsFile string
+
+	// ColumnDefaults maps original column names to the defaults of their
+	// columns, such as 'new' or now(). Names are matched as profiled, so
+	// PatientID names patient_id with SnakeCase. Defaults are literals
+	// quoted by DefaultExpr unless they are one of a few functions. The
+	// nulls of a column are set to its default when a table is replaced,
+	// while appended rows keep them. Not supported with cstore tables.
+	ColumnDefaults map[string]string
+
+	// RenameColumns maps original column names to the desired names,
+	// such as "Pt ID" to "patient_id". Coerce and TextColumns refer to
+	// the original names.
+	RenameColumns map[string]string
+
+	// ColumnMap lists the source columns that are loaded, the target
+	// columns they are loaded into, and their order in the table. Other
+	// columns are skipped. It replaces IncludeColumns, ExcludeColumns,
+	// and RenameColumns, so they cannot be set with it. Options naming
+	// columns refer to the source names.
+	ColumnMap []ColumnMapping
+
+	// Output. If set, a SQL script is written to this path instead of
+	// loading into the database.
+	SQLFile string
+
+	// SQLCompressionLevel is the gzip level of compressed SQL scripts,
+	// from 1 for the fastest to 9 for the smallest. The default level of
+	// gzip is used if zero.
+	SQLCompressionLevel int
+
+	// Format, delimiter, and null marker of the COPY data in the SQL
+	// script. The format is CopyText or CopyCSV and defaults to text.
+	SQLFormat    string
+	SQLDelimiter string
+	SQLNull      string
+
+	// Concurrency. Requests sharing a limiter are bounded in the number
+	// of files that may be profiled at the same time.
+	ProfileLimiter Limiter
+
+	// ProfileRetries is the number of times the profiling pass over an
+	// input is retried from the start after a transient read error, such
+	// as a connection reset while reading a network mount. It waits
+	// ProfileRetryDelay, or DefaultRetryDelay if zero, before the first
+	// retry and twice as long before each of the next. Streams that are
+	// not seekable are not retried. Database errors are not retried.
+	ProfileRetries    int
+	ProfileRetryDelay time.Duration
+}
+
+// DefaultRetryDelay is the wait before the first retry of a profiling
+// pass if the delay is not set.
+const DefaultRetryDelay = time.Second
+
+// ColumnMapping maps a source column to the target column it is loaded
+// into.
+type ColumnMapping struct {
+	Source string
+	Target string
+}
+
+// Fields present in less than this fraction of records are reported
+// since they usually signal malformed input.
+const sparseFraction = 0.1
+
+// Limiter bounds the number of concurrent operations that share it.
+// A nil Limiter imposes no limit.
+type Limiter chan struct{}
+
+// NewLimiter returns a limiter allowing n concurrent operations. A nil
+// limiter is returned if n is less than one.
+func NewLimiter(n int) Limiter {
+	if n < 1 {
+		return nil
+	}
+
+	return make(Limiter, n)
+}
+
+// Acquire blocks until a slot is available.
+func (l Limiter) Acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// Release frees a slot held by a previous call to Acquire.
+func (l Limiter) Release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// profileHook is called while a profiling slot is held. Used for testing.
+var profileHook func()
+
+// Result describes the outcome of an import. The profile and schema are
+// set once profiling completes so they are available even if the load fails.
+type Result struct {
+	// Profile of the input.
+	Profile *profile.Profile
+
+	// Schema derived from the profile.
+	Schema *Schema
+
+	// Number of records loaded.
+	Rows int64
+
+	// Number of records written to the rejects file.
+	Rejected int64
+
+	// Skipped is true if the table exists and the existing table policy
+	// is ExistingSkip, so nothing was loaded.
+	Skipped bool
+
+	// Partitions are the tables the columns were split into if the
+	// input was too wide for a single table. The partitions are joined
+	// on the row id column. A view of the table name joining them is
+	// created if the columns fit in a single select.
+	Partitions  []Partition
+	RowIDColumn string
+	View        bool
+
+	// Durations of the phases of the import.
+	Timings Timings
+}
+
+// Partition is a table containing a subset of the columns.
+type Partition struct {
+	Table   string
+	Columns []string
+}
+
+func validateFloatType(t string) error {
+	switch t {
+	case "", FloatAuto, FloatReal, FloatDouble:
+		return nil
+	}
+
+	return fmt.Errorf("float type not supported: %s", t)
+}
+
+// validateDelimiter checks the delimiter is a single character that does
+// not conflict with the quote character or line endings, which would make
+// the fields ambiguous. Fields are split on bytes, so the delimiter must
+// be ASCII since other bytes are part of multibyte UTF-8 characters.
+func validateDelimiter(name, delim string) error {
+	if delim != "" && delim[0] >= utf8.RuneSelf {
+		return fmt.Errorf("%s must be an ASCII character: %q", name, delim)
+	}
+
+	if len(delim) != 1 {
+		return fmt.Errorf("%s must be a single character: %q", name, delim)
+	}
+
+	switch delim[0] {
+	case '"':
+		return fmt.Errorf("%s conflicts with the quote character: %q", name, delim)
+	case '\n', '\r':
+		return fmt.Errorf("%s conflicts with line endings: %q", name, delim)
+	}
+
+	return nil
+}
+
+// validateRecordSeparator checks the record separator is a single byte
+// distinct from the delimiter and the quote character.
+func validateRecordSeparator(r *Request) error {
+	sep := r.RecordSeparator
+
+	switch {
+	case sep == "":
+		return nil
+	case len(sep) != 1 || sep[0] >= utf8.RuneSelf:
+		return fmt.Errorf("record separator must be a single ASCII character: %q", sep)
+	case sep == `"`:
+		return fmt.Errorf("record separator conflicts with the quote character: %q", sep)
+	case sep == r.Delimiter:
+		return fmt.Errorf("record separator conflicts with the delimiter: %q", sep)
+	case r.HeaderDelimiter != "" || r.SkipTrailingLines > 0:
+		return errors.New("record separator is not supported with a header delimiter or trailing lines")
+	}
+
+	return nil
+}
+
+func validateNullability(notNull, nullable []string) error {
+	for _, n := range notNull {
+		if containsName(nullable, strings.ToLower(n)) {
+			return fmt.Errorf("column %s cannot be both not null and nullable", n)
+		}
+	}
+
+	return nil
+}
+
+func parseCoerce(m map[string]string) (map[string]profile.ValueType, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	coerce := make(map[string]profile.ValueType, len(m))
+
+	for col, name := range m {
+		t, ok := profile.ParseType(name)
+		if !ok || t == profile.NullType || t == profile.BinaryType || t == profile.ObjectType {
+			return nil, fmt.Errorf("cannot coerce %s to type: %s", col, name)
+		}
+
+		coerce[strings.ToLower(col)] = t
+	}
+
+	return coerce, nil
 }
 
-func Import(r *Request) error {
-	fileType, fileComp := reader.DetectType(r.Path)
+func Import(r *Request) (*Result, error) {
+	// Connect to database.
+	db, err := openDB(r)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return importDB(db, r)
+}
 
-	if r.CSV || fileType == "csv" {
+// ImportReader profiles and loads CSV or JSON data read from a stream. Since the
+// data is read twice, non-seekable streams are buffered to a temporary file
+// while profiling. The table name is required unless it is named by the
+// directive line of the data, and the path is ignored.
+func ImportReader(db *sql.DB, in io.Reader, r *Request) (*Result, error) {
+	if r.jsonFormat() == "" {
 		r.CSV = true
-	} else {
-		return fmt.Errorf("file type not supported: %s", fileType)
 	}
 
-	if r.Compression == "" {
-		r.Compression = fileComp
+	src := &streamSource{
+		in:          in,
+		compression: r.Compression,
+
+		keepLineEndings: r.KeepLineEndings,
+	}
+	defer src.Close()
+
+	if r.Directives {
+		if err := setDirective(r, src); err != nil {
+			return nil, err
+		}
 	}
 
 	if r.Table == "" {
-		_, base := path.Split(r.Path)
-		r.Table = strings.Split(base, ".")[0]
+		return nil, errors.New("table name required for data read from a stream, such as standard input")
 	}
 
+	return importSource(db, r, src)
+}
+
+func importDB(db *sql.DB, r *Request) (*Result, error) {
+	// Standard input can only be read once.
+	if r.Path == "" {
+		return ImportReader(db, os.Stdin, r)
+	}
+
+	return importFiles(db, []string{r.Path}, r)
+}
+
+// ImportFiles profiles the files together and loads them into one table in
+// a single operation. The files must have the same columns in the same
+// order. The table name defaults to the name of the first file and the
+// path of the request is ignored.
+func ImportFiles(paths []string, r *Request) (*Result, error) {
 	// Connect to database.
-	db, err := sql.Open("postgres", r.Database)
+	db, err := openDB(r)
 	if err != nil {
-		return fmt.Errorf("cannot open db connection: %s", err)
+		return nil, err
 	}
 	defer db.Close()
 
-	// Open the input stream.
-	input, err := reader.Open(r.Path, r.Compression)
+	return importFiles(db, paths, r)
+}
+
+func importFiles(db *sql.DB, paths []string, r *Request) (*Result, error) {
+	srcs, err := fileSources(paths, r)
 	if err != nil {
-		return fmt.Errorf("cannot open input: %s", err)
+		return nil, err
 	}
-	defer input.Close()
 
-	cp := csv.NewProfiler(input)
-	cp.Delimiter = r.Delimiter[0]
-	cp.Header = r.Header
+	return importSource(db, r, srcs...)
+}
 
-	prof, err := cp.Profile()
+// ImportTar loads each file of the tar archive at the path of the request
+// into its own table, one at a time. The tables are named as the files of
+// a directory are: the directories of a file within the archive are joined
+// with underscores into the schema name and its name up to the first dot is
+// the table name. Files at the root are loaded into the schema of the
+// request. The compression of the request applies to the archive and the
+// format of each file is detected unless set. The archive is read once,
+// each file being copied to a temporary file while it is loaded. Rows of
+// each file are rejected to their own file named after the table, such as
+// rejects.sales.orders.csv for a RejectsFile of rejects.csv. The results
+// of the files loaded are returned with the first error.
+func ImportTar(r *Request) ([]*Result, error) {
+	// Connect to database.
+	db, err := openDB(r)
 	if err != nil {
-		return fmt.Errorf("profile error: %s", err)
+		return nil, err
 	}
+	defer db.Close()
 
-	log.Print("Done profiling")
+	return importTar(db, r)
+}
 
-	input.Close()
-	input, err = reader.Open(r.Path, r.Compression)
+func importTar(db *sql.DB, r *Request) ([]*Result, error) {
+	t, err := reader.OpenTar(r.Path, r.Compression)
 	if err != nil {
-		return fmt.Errorf("cannot open input: %s", err)
+		return nil, fmt.Errorf("cannot read archive: %s", err)
 	}
-	defer input.Close()
+	defer t.Close()
 
-	schema := NewSchema(prof)
-	if r.CStore {
-		schema.Cstore = true
+	dir, err := ioutil.TempDir("", "sqlimporter")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create spool directory: %s", err)
 	}
+	defer os.RemoveAll(dir)
 
-	// Load intot he database.
-	log.Printf(`Begin load into "%s"."%s"`, r.Schema, r.Table)
+	var results []*Result
 
-	cr := libcsv.NewReader(input)
-	cr.Comma = rune(r.Delimiter[0])
+	for {
+		_, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, fmt.Errorf("cannot read archive: %s", err)
+		}
 
-	var n int64
-	dbc := New(db)
-	if r.AppendTable {
-		n, err = dbc.Append(r.Schema, r.Table, schema, cr)
-	} else {
-		n, err = dbc.Replace(r.Schema, r.Table, schema, cr)
+		res, err := importTarFile(db, r, t, dir)
+		if err != nil {
+			return results, err
+		}
+
+		if res != nil {
+			results = append(results, res)
+		}
+	}
+
+	return results, nil
+}
+
+// importTarFile loads the current file of the archive, spooled to the
+// directory, and returns a nil result if its type is not supported.
+func importTarFile(db *sql.DB, r *Request, t *reader.TarReader, dir string) (*Result, error) {
+	name := t.Name()
+
+	spooled, err := spoolTar(t, dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s in archive: %s", name, err)
+	}
+	defer os.Remove(spooled)
+
+	src := &tarSource{
+		fileSource: fileSource{
+			path:            spooled,
+			keepLineEndings: r.KeepLineEndings,
+		},
+		archive: r.Path,
+		name:    name,
+	}
+
+	fr := *r
+	fr.Schema, fr.Table = tarTableName(r.Schema, name)
+
+	if r.RejectsFile != "" {
+		fr.RejectsFile = tarRejectsFile(r.RejectsFile, fr.Schema, fr.Table)
+	}
+
+	if !r.CSV && !r.JSON && !r.LDJSON {
+		typ, _ := reader.DetectType(name)
+		if typ == "" {
+			if typ, err = sniffType(src); err != nil {
+				return nil, err
+			}
+		}
+
+		switch typ {
+		case "csv":
+			fr.CSV = true
+		case "json":
+			fr.JSON = true
+		case "ldjson":
+			fr.LDJSON = true
+		default:
+			log.Printf("Skipping %s in archive since its type is not supported", name)
+			return nil, nil
+		}
+	}
+
+	return importSource(db, &fr, src)
+}
+
+// tarRejectsFile returns the rejects file of a file of an archive, which is
+// the rejects file of the request with the schema and table inserted
+// before its extensions.
+func tarRejectsFile(p, schemaName, tableName string) string {
+	dir, base := filepath.Split(p)
+
+	ext := ""
+	if i := strings.Index(base, "."); i > 0 {
+		base, ext = base[:i], base[i:]
+	}
+
+	return filepath.Join(dir, base+"."+schemaName+"."+tableName+ext)
+}
+
+// tarTableName returns the schema and table names of a file of an archive
+// given its path within the archive.
+func tarTableName(schemaName, name string) (string, string) {
+	dir, base := path.Split(strings.TrimPrefix(name, "./"))
+
+	if dir = strings.Trim(dir, "/"); dir != "" {
+		schemaName = strings.Replace(dir, "/", "_", -1)
+	}
+
+	return schemaName, strings.Split(base, ".")[0]
+}
+
+// fileSources returns the sources of the files and sets the format and the
+// table name of the request if not set.
+func fileSources(paths []string, r *Request) ([]source, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no files to import")
+	}
+
+	var (
+		srcs     []source
+		fileType string
+	)
+
+	for _, p := range paths {
+		t, comp := reader.DetectType(p)
+
+		if r.Compression != "" {
+			comp = r.Compression
+		}
+
+		src := &fileSource{
+			path:        p,
+			compression: comp,
+
+			keepLineEndings: r.KeepLineEndings,
+		}
+
+		// The format of files such as data.gz is detected from the
+		// decompressed content.
+		if t == "" && !r.CSV && !r.JSON && !r.LDJSON {
+			var err error
+			if t, err = sniffType(src); err != nil {
+				return nil, err
+			}
+		}
+
+		if fileType == "" {
+			fileType = t
+		} else if t != fileType && !r.CSV && !r.JSON && !r.LDJSON {
+			return nil, fmt.Errorf("file %s is %s, expected %s", p, t, fileType)
+		}
+
+		srcs = append(srcs, src)
+	}
+
+	switch {
+	case r.JSON || r.LDJSON:
+	case r.CSV || fileType == "csv":
+		r.CSV = true
+	case fileType == "json":
+		r.JSON = true
+	case fileType == "ldjson":
+		r.LDJSON = true
+	default:
+		return nil, fmt.Errorf("file type not supported: %s", fileType)
+	}
+
+	if r.PartitionPattern != "" {
+		if err := setPartitions(srcs, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Directives {
+		if err := setDirective(r, srcs[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Table == "" {
+		_, base := path.Split(paths[0])
+		r.Table = strings.Split(base, ".")[0]
 	}
+
+	return srcs, nil
+}
+
+// setPartitions sets the partition key of each file source from its base
+// name and the table name of the request if not set.
+func setPartitions(srcs []source, r *Request) error {
+	re, err := regexp.Compile(r.PartitionPattern)
 	if err != nil {
-		return fmt.Errorf("error loading: %s", err)
+		return fmt.Errorf("invalid partition pattern: %s", err)
+	}
+
+	if re.NumSubexp() != 1 {
+		return fmt.Errorf("partition pattern must have one group: %s", r.PartitionPattern)
 	}
 
-	log.Printf("Loaded %d records", n)
+	seen := make(map[string]string, len(srcs))
+
+	for _, src := range srcs {
+		s := src.(*fileSource)
+		_, base := path.Split(s.path)
+
+		m := re.FindStringSubmatchIndex(base)
+		if m == nil || m[2] < 0 || m[2] == m[3] {
+			return fmt.Errorf("file %s does not match the partition pattern", s.path)
+		}
+
+		s.partition = base[m[2]:m[3]]
+
+		if other, ok := seen[s.partition]; ok {
+			return fmt.Errorf("files %s and %s have the same partition: %s", other, s.path, s.partition)
+		}
+		seen[s.partition] = s.path
+
+		// The table is named by the base name before the match or, if
+		// it matches at the start, after it.
+		if r.Table == "" {
+			name := base[:m[0]]
+			if name == "" {
+				name = base[m[1]:]
+			}
+			r.Table = strings.Split(name, ".")[0]
+		}
+	}
 
 	return nil
 }
+
+// sourcePartitions returns the partition keys of the sources. An error is
+// returned if a source is not a file.
+func sourcePartitions(srcs []source) ([]string, error) {
+	keys := make([]string, len(srcs))
+	for i, src := range srcs {
+		s, ok := src.(*fileSource)
+		if !ok || s.partition == "" {
+			return nil, errors.New("partitioning by file name requires files")
+		}
+		keys[i] = s.partition
+	}
+
+	return keys, nil
+}
+
+// sniffType returns the format of the source detected from the start of
+// its decompressed content.
+func sniffType(src source) (string, error) {
+	input, err := src.Open()
+	if err != nil {
+		return "", fmt.Errorf("cannot open input: %s", err)
+	}
+	defer input.Close()
+
+	b := make([]byte, reader.SniffLen)
+
+	n, err := io.ReadFull(input, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("cannot read input: %s", err)
+	}
+
+	return reader.SniffType(b[:n]), nil
+}
+
+// Profile profiles the input of the request and derives the schema without
+// loading it. The result has no rows.
+func Profile(r *Request) (*Result, error) {
+	if r.Path == "" {
+		if r.jsonFormat() == "" {
+			r.CSV = true
+		}
+
+		src := &streamSource{
+			in:          os.Stdin,
+			compression: r.Compression,
+
+			keepLineEndings: r.KeepLineEndings,
+		}
+		defer src.Close()
+
+		if r.Directives {
+			if err := setDirective(r, src); err != nil {
+				return nil, err
+			}
+		}
+
+		return profileSources(r, src)
+	}
+
+	srcs, err := fileSources([]string{r.Path}, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return profileSources(r, srcs...)
+}
+
+func importSource(db *sql.DB, r *Request, srcs ...source) (*Result, error) {
+	res, err := profileSources(r, srcs...)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := res.Schema
+
+	cr := &unionRows{
+		r:      r,
+		prof:   res.Profile,
+		schema: schema,
+		srcs:   srcs,
+	}
+	defer cr.Close()
+
+	replace := func(dbc *Client) (int64, error) {
+		return dbc.replace(r.Schema, r.Table, schema, cr)
+	}
+
+	// The partition key of each row is loaded after the columns of the file.
+	if r.PartitionPattern != "" {
+		keys, err := sourcePartitions(srcs)
+		if err != nil {
+			return nil, err
+		}
+
+		schema.Fields = append(schema.Fields, &Field{
+			Name: PartitionColumn,
+			Type: "text",
+		})
+
+		cr.partitioned = true
+
+		replace = func(dbc *Client) (int64, error) {
+			return dbc.replacePartitionedTx(r.Schema, r.Table, schema, keys, cr)
+		}
+	}
+
+	if r.SQLFile != "" {
+		log.Printf(`Begin writing "%s"."%s" to %s`, r.Schema, r.Table, r.SQLFile)
+
+		start := time.Now()
+		res.Rows, err = writeSQLFile(r, schema, cr)
+		res.Timings.Copy = time.Since(start)
+
+		if err != nil {
+			return res, fmt.Errorf("error writing sql: %s", err)
+		}
+
+		log.Printf("Wrote %d records", res.Rows)
+		logTimings(res.Timings)
+
+		return res, nil
+	}
+
+	// Load intot he database.
+	log.Printf(`Begin load into "%s"."%s"`, r.Schema, r.Table)
+
+	dbc := New(db)
+	dbc.NullTokens = r.NullTokens
+	dbc.NullSentinel = r.NullSentinel
+	dbc.Analyze = AnalyzeOptions{Target: r.AnalyzeTarget, Verbose: r.AnalyzeVerbose}
+	dbc.StatementTimeout = r.StatementTimeout
+	dbc.OnExisting = r.OnExisting
+	dbc.Owner = r.Owner
+	dbc.Quoting = r.Quoting
+	dbc.CheckCount = r.CheckCount
+	dbc.Tablespace = r.Tablespace
+	dbc.IndexTablespace = r.IndexTablespace
+
+	// The statements of the load are run within a transaction that is
+	// committed once it succeeds.
+	commit := func() error { return nil }
+
+	if r.SingleTransaction {
+		tx, err := dbc.beginTx()
+		if err != nil {
+			return res, err
+		}
+		defer tx.Rollback()
+
+		dbc = dbc.inTx(tx)
+		commit = tx.Commit
+	}
+
+	if r.SchemaOnly {
+		err := dbc.CreateTable(r.Schema, r.Table, schema)
+		if err == nil {
+			err = commit()
+		}
+
+		res.Timings = loadTimings(dbc, res)
+
+		if err != nil {
+			return res, err
+		}
+
+		log.Printf(`Created "%s"."%s" without loading rows`, r.Schema, r.Table)
+		logTimings(res.Timings)
+
+		return res, nil
+	}
+
+	var rejects *reader.Writer
+
+	if r.RejectsFile != "" {
+		if rejects, err = reader.Create(r.RejectsFile, ""); err != nil {
+			return res, fmt.Errorf("cannot create rejects file: %s", err)
+		}
+		defer rejects.Close()
+
+		dbc.Rejects = NewRejectWriter(rejects, rune(r.Delimiter[0]))
+	}
+
+	if r.TempTable {
+		res.Rows, err = dbc.loadTemp(r.Table, schema, cr)
+	} else if r.AppendNew {
+		res.Rows, err = dbc.appendNew(r.Schema, r.Table, schema, cr)
+	} else if r.MatchColumns {
+		res.Rows, err = dbc.appendColumns(r.Schema, r.Table, schema, cr)
+	} else if r.AppendTable {
+		res.Rows, err = dbc.appendTable(r.Schema, r.Table, schema, cr)
+	} else if r.OnExisting == ExistingSkip {
+		// Checked before replacing to report the skip.
+		if res.Skipped, err = dbc.TableExists(r.Schema, r.Table); err == nil && !res.Skipped {
+			res.Rows, err = replace(dbc)
+		}
+	} else {
+		res.Rows, err = replace(dbc)
+	}
+
+	if dbc.Rejects != nil {
+		res.Rejected = dbc.Rejects.Count()
+
+		ferr := dbc.Rejects.Flush()
+		if cerr := rejects.Close(); ferr == nil {
+			ferr = cerr
+		}
+
+		if ferr != nil && err == nil {
+			err = fmt.Errorf("cannot write rejects file: %s", ferr)
+		}
+	}
+
+	if err != nil {
+		res.Timings = loadTimings(dbc, res)
+		return res, &LoadError{Schema: r.Schema, Table: r.Table, Err: err}
+	}
+
+	if r.ProfileTable && !res.Skipped {
+		if err := dbc.WriteProfile(r.Schema, r.Table, schema); err != nil {
+			res.Timings = loadTimings(dbc, res)
+			return res, err
+		}
+	}
+
+	if err := commit(); err != nil {
+		res.Timings = loadTimings(dbc, res)
+		return res, &LoadError{Schema: r.Schema, Table: r.Table, Err: err}
+	}
+
+	res.Timings = loadTimings(dbc, res)
+
+	if res.Skipped {
+		log.Printf(`Skipped "%s"."%s" since it exists`, r.Schema, r.Table)
+		return res, nil
+	}
+
+	if r.TempTable {
+		log.Printf("Validated %d records in a temporary table", res.Rows)
+	} else {
+		log.Printf("Loaded %d records", res.Rows)
+	}
+	if res.Rejected > 0 {
+		log.Printf("Rejected %d records to %s", res.Rejected, r.RejectsFile)
+	}
+	logTimings(res.Timings)
+
+	if len(schema.Partitions) > 1 {
+		res.RowIDColumn = rowIdColumn
+		res.View = hasPartitionView(schema, schema.Partitions)
+
+		for i, cols := range schema.Partitions {
+			res.Partitions = append(res.Partitions, Partition{
+				Table:   partitionName(r.Table, i),
+				Columns: cols,
+			})
+		}
+	}
+
+	for _, f := range schema.Fields {
+		if f.Coerced > 0 {
+			log.Printf("Coerced %d values of %s to null", f.Coerced, f.Name)
+		}
+	}
+
+	return res, nil
+}
+
+// profileSources validates the request, profiles the sources, and derives
+// the schema.
+func profileSources(r *Request, srcs ...source) (*Result, error) {
+	if r.Delimiter == "" {
+		r.Delimiter = ","
+	}
+
+	if err := validateDelimiter("delimiter", r.Delimiter); err != nil {
+		return nil, err
+	}
+
+	if r.HeaderDelimiter != "" {
+		if err := validateDelimiter("header delimiter", r.HeaderDelimiter); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateRecordSeparator(r); err != nil {
+		return nil, err
+	}
+
+	if r.JSONSeparator == "" {
+		r.JSONSeparator = json.DefaultSeparator
+	}
+
+	if err := validateFloatType(r.FloatType); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateOnExisting(r.OnExisting); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateOwner(r.Owner); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateQuoting(r.Quoting); err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{r.Tablespace, r.IndexTablespace} {
+		if err := ValidateTablespace(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.TempTable && (r.AppendTable || r.AppendNew || r.MatchColumns) {
+		return nil, errors.New("temporary tables cannot be appended to")
+	}
+
+	if r.SingleTransaction && (r.SQLFile != "" || r.EnumTypes) {
+		return nil, errors.New("single transaction is not supported with SQL output or enum types")
+	}
+
+	if r.PartitionPattern != "" && (r.SQLFile != "" || r.TempTable || r.SchemaOnly || r.AppendTable || r.AppendNew || r.MatchColumns) {
+		return nil, errors.New("partitioning by file name is only supported when replacing the table")
+	}
+
+	if r.TempTable && r.ProfileTable {
+		return nil, errors.New("profile tables are not supported with temporary tables")
+	}
+
+	if r.TypeHints && (!r.CSV || !r.Header) {
+		return nil, errors.New("type hints require a csv file with a header")
+	}
+
+	if r.SchemaOnly && (!r.CSV || !r.Header) {
+		return nil, errors.New("schema only requires a csv file with a header")
+	}
+
+	if r.SchemaOnly && (r.TempTable || r.SQLFile != "") {
+		return nil, errors.New("schema only is not supported with temporary tables or SQL output")
+	}
+
+	if r.TypeConfidence < 0 || r.TypeConfidence > 1 {
+		return nil, fmt.Errorf("type confidence must be between 0 and 1, got %g", r.TypeConfidence)
+	}
+
+	if r.MaxIntDigits < 0 {
+		return nil, fmt.Errorf("max integer digits cannot be negative, got %d", r.MaxIntDigits)
+	}
+
+	if r.ProfileRetries < 0 || r.ProfileRetryDelay < 0 {
+		return nil, fmt.Errorf("profile retries and delay cannot be negative, got %d and %s", r.ProfileRetries, r.ProfileRetryDelay)
+	}
+
+	if r.Offset < 0 || r.Limit < 0 {
+		return nil, fmt.Errorf("row offset and limit cannot be negative, got %d and %d", r.Offset, r.Limit)
+	}
+
+	if len(r.ColumnDefaults) > 0 && r.CStore {
+		return nil, errors.New("column defaults are not supported with cstore tables")
+	}
+
+	coerce, err := parseCoerce(r.Coerce)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateNullability(r.NotNullColumns, r.NullableColumns); err != nil {
+		return nil, err
+	}
+
+	for _, p := range r.TextColumns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid text column pattern: %s", p)
+		}
+	}
+
+	for _, p := range append(r.IncludeColumns, r.ExcludeColumns...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid column pattern: %s", p)
+		}
+	}
+
+	if err := validateColumnMap(r); err != nil {
+		return nil, err
+	}
+
+	for _, p := range r.PreserveEmpty {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid preserve empty column pattern: %s", p)
+		}
+	}
+
+	for _, p := range r.NormalizeSpace {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid normalize space column pattern: %s", p)
+		}
+	}
+
+	if r.NullSentinel != "" {
+		if err := validateNullSentinel(r.NullSentinel); err != nil {
+			return nil, err
+		}
+	}
+
+	// Values are not compared across the profiles of the sources.
+	if r.ValidatePrimaryKey && len(srcs) > 1 {
+		return nil, errors.New("the uniqueness of the primary key cannot be validated across multiple files")
+	}
+
+	start := time.Now()
+
+	// Multiple sources are profiled separately and merged.
+	var prof *profile.Profile
+
+	for _, src := range srcs {
+		p, err := profileSource(r, src)
+		if err != nil {
+			return nil, err
+		}
+
+		if prof == nil {
+			prof = p
+		} else if prof, err = profile.Merge(prof, p, r.profileConfig()); err != nil {
+			return nil, fmt.Errorf("cannot union inputs: %s", err)
+		}
+	}
+
+	log.Print("Done profiling")
+
+	// Such as JSON records that are empty objects or a header whose
+	// fields are all excluded.
+	if len(prof.Fields) == 0 {
+		return nil, profile.ErrNoColumns
+	}
+
+	for _, n := range prof.SparseFields(sparseFraction) {
+		log.Printf("Warning: field %s is present in %d of %d records", n, prof.Fields[n].Count, prof.RecordCount)
+	}
+
+	if err := mapColumns(r, prof); err != nil {
+		return nil, err
+	}
+
+	logExamples(prof)
+	logEnums(prof)
+
+	// The types of JSON values are known without detection, so they are
+	// made text by the schema.
+	defaults := make(map[string]string, len(r.ColumnDefaults))
+	for col, v := range r.ColumnDefaults {
+		name := r.sourceName(col)
+		if _, ok := prof.Fields[name]; !ok {
+			return nil, fmt.Errorf("default of unknown column: %s", col)
+		}
+
+		defaults[name] = DefaultExpr(v)
+	}
+
+	textPatterns := r.TextColumns
+	if r.AllText {
+		textPatterns = []string{"*"}
+	}
+
+	schema := NewSchemaWithConfig(prof, &SchemaConfig{
+		FloatType: r.FloatType,
+		Coerce:    coerce,
+
+		TextPatterns:   textPatterns,
+		PreserveEmpty:  r.PreserveEmpty,
+		NormalizeSpace: r.NormalizeSpace,
+
+		NotNull:  r.NotNullColumns,
+		Nullable: r.NullableColumns,
+
+		EnumTypes:     r.EnumTypes,
+		MaxEnumValues: r.maxEnumValues(),
+
+		Defaults: defaults,
+		SQLTypes: r.SQLTypes,
+	})
+	if r.CStore {
+		schema.Cstore = true
+		schema.StripeRows = r.CStoreStripeRows
+	}
+	schema.Unlogged = r.Unlogged
+	schema.Identity = r.IdentityColumn
+	schema.RowHash = r.RowHash
+	if r.AppendNew && schema.RowHash == nil {
+		schema.RowHash = &RowHash{}
+	}
+
+	if err := setPrimaryKey(r, prof, schema); err != nil {
+		return nil, err
+	}
+
+	renames := r.RenameColumns
+	if len(r.ColumnMap) > 0 {
+		renames = r.columnMapRenames()
+	}
+
+	if err := schema.RenameFields(renames); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Profile: prof,
+		Schema:  schema,
+		Timings: Timings{
+			Profile: time.Since(start),
+		},
+	}, nil
+}
+
+// validateColumnMap returns an error if a column of the column map is
+// empty or repeated, or other options select or rename the columns.
+func validateColumnMap(r *Request) error {
+	if len(r.ColumnMap) == 0 {
+		return nil
+	}
+
+	if len(r.IncludeColumns) > 0 || len(r.ExcludeColumns) > 0 || len(r.RenameColumns) > 0 {
+		return errors.New("column map cannot be combined with included, excluded, or renamed columns")
+	}
+
+	sources := make(map[string]bool, len(r.ColumnMap))
+	targets := make(map[string]bool, len(r.ColumnMap))
+
+	for _, m := range r.ColumnMap {
+		if m.Source == "" || m.Target == "" {
+			return fmt.Errorf("column map has an empty column: %q to %q", m.Source, m.Target)
+		}
+
+		source := r.sourceName(m.Source)
+		if sources[source] {
+			return fmt.Errorf("column map has duplicate source column: %s", m.Source)
+		}
+		sources[source] = true
+
+		target := CleanIdentifier(m.Target)
+		if targets[target] {
+			return fmt.Errorf("column map has duplicate target column: %s", m.Target)
+		}
+		targets[target] = true
+	}
+
+	return nil
+}
+
+// mapColumns orders the fields of the profile as the column map of the
+// request after checking the source columns exist.
+func mapColumns(r *Request, prof *profile.Profile) error {
+	for i, m := range r.ColumnMap {
+		f, ok := prof.Fields[r.sourceName(m.Source)]
+		if !ok {
+			return fmt.Errorf("source column of column map does not exist: %s", m.Source)
+		}
+
+		f.Index = i
+	}
+
+	return nil
+}
+
+// columnMapRenames returns the target names of the source columns of the
+// column map.
+func (r *Request) columnMapRenames() map[string]string {
+	renames := make(map[string]string, len(r.ColumnMap))
+
+	for _, m := range r.ColumnMap {
+		renames[r.sourceName(m.Source)] = m.Target
+	}
+
+	return renames
+}
+
+// includeColumns returns the patterns of the included columns, which are
+// the source columns of the column map if set.
+func (r *Request) includeColumns() []string {
+	if len(r.ColumnMap) == 0 {
+		return r.IncludeColumns
+	}
+
+	patterns := make([]string, len(r.ColumnMap))
+	for i, m := range r.ColumnMap {
+		patterns[i] = globEscaper.Replace(r.sourceName(m.Source))
+	}
+
+	return patterns
+}
+
+// sourceName returns the name of the source column as profiled.
+func (r *Request) sourceName(n string) string {
+	config := profile.Config{SnakeCase: r.SnakeCase}
+	return config.FieldName(n)
+}
+
+// globEscaper escapes the special characters of glob patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// setPrimaryKey marks the primary key column of the schema, if any, and
+// validates it against the profile if requested.
+func setPrimaryKey(r *Request, prof *profile.Profile, schema *Schema) error {
+	if r.PrimaryKey != "" && r.PrimaryKeyFirst {
+		return errors.New("primary key column and first column key are mutually exclusive")
+	}
+
+	var key *Field
+
+	switch {
+	case r.PrimaryKeyFirst:
+		if len(schema.Fields) == 0 {
+			return errors.New("first column key requires at least one column")
+		}
+		key = schema.Fields[0]
+
+	case r.PrimaryKey != "":
+		name := strings.ToLower(r.PrimaryKey)
+		for _, f := range schema.Fields {
+			if f.Name == name {
+				key = f
+				break
+			}
+		}
+		if key == nil {
+			return fmt.Errorf("primary key column does not exist: %s", r.PrimaryKey)
+		}
+
+	default:
+		return nil
+	}
+
+	if r.ValidatePrimaryKey {
+		f := prof.Fields[key.Name]
+
+		if f.Nullable || f.Missing {
+			return fmt.Errorf("primary key column %s has null values", key.Name)
+		}
+
+		if f.UniqueUnknown {
+			return fmt.Errorf("primary key column %s has more than %d values to validate", key.Name, r.MaxUniqueValues)
+		}
+
+		if !f.Unique {
+			return fmt.Errorf("primary key column %s has duplicate values", key.Name)
+		}
+	}
+
+	key.PrimaryKey = true
+	key.Nullable = false
+
+	return nil
+}
+
+// loadTimings returns the timings of the client with the profiling time
+// of the result.
+func loadTimings(dbc *Client, res *Result) Timings {
+	t := dbc.Timings()
+	t.Profile = res.Timings.Profile
+	return t
+}
+
+func logTimings(t Timings) {
+	log.Printf("Took %s profiling, %s creating, %s copying, and %s analyzing", t.Profile, t.Create, t.Copy, t.Analyze)
+}
+
+// logExamples logs the values that caused the type of fields to be
+// generalized.
+func logExamples(prof *profile.Profile) {
+	var names []string
+	for n, f := range prof.Fields {
+		if len(f.Examples) > 0 {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := prof.Fields[n]
+		log.Printf("Field %s is %s due to values such as %q", n, f.Type, f.Examples)
+	}
+}
+
+func logEnums(prof *profile.Profile) {
+	var names []string
+	for n, f := range prof.Fields {
+		if len(f.EnumValues) > 0 {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := prof.Fields[n]
+		log.Printf("Field %s is enum-like with values %q", n, f.EnumValues)
+	}
+}
+
+// profileSource profiles a pass over the source, which is retried from
+// the start on transient read errors.
+func profileSource(r *Request, src source) (*profile.Profile, error) {
+	delay := r.ProfileRetryDelay
+	if delay == 0 {
+		delay = DefaultRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		prof, err := profilePass(r, src)
+		if err == nil || attempt == r.ProfileRetries || !isTransient(err) || !reopenable(src) {
+			return prof, err
+		}
+
+		name := sourcePath(src)
+		if name == "" {
+			name = "input"
+		}
+
+		log.Printf("Retrying profile of %s in %s: %s", name, delay, err)
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// profilePass profiles a single pass over the source.
+func profilePass(r *Request, src source) (*profile.Profile, error) {
+	// Open the input stream.
+	input, err := src.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open input: %w", err)
+	}
+	defer input.Close()
+
+	// Profiling keeps the distinct values of every column in memory, so
+	// many wide files profiled at once can exhaust memory.
+	r.ProfileLimiter.Acquire()
+	if profileHook != nil {
+		profileHook()
+	}
+	prof, err := profileInput(r, input)
+	r.ProfileLimiter.Release()
+
+	if err != nil {
+		if perr := parseError(sourcePath(src), err); perr != err {
+			return nil, perr
+		}
+		return nil, fmt.Errorf("profile error: %w", err)
+	}
+
+	// Report decompression errors not surfaced while profiling.
+	if err := input.Close(); err != nil {
+		return nil, fmt.Errorf("cannot read input: %w", err)
+	}
+
+	return prof, nil
+}
+
+// unionRows reads the rows of each source in turn. The header of the first
+// source is read and the headers of the others are skipped. If partitioned,
+// the partition key of the source is appended to each row.
+type unionRows struct {
+	r           *Request
+	prof        *profile.Profile
+	schema      *Schema
+	srcs        []source
+	partitioned bool
+
+	next   int
+	input  io.ReadCloser
+	rows   RowReader
+	row    []string
+	header bool
+}
+
+func (u *unionRows) Read() ([]string, error) {
+	for {
+		if u.rows == nil {
+			if u.next == len(u.srcs) {
+				return nil, io.EOF
+			}
+
+			if err := u.open(u.srcs[u.next], u.next > 0); err != nil {
+				return nil, err
+			}
+
+			u.next++
+		}
+
+		row, err := u.rows.Read()
+		if err != io.EOF {
+			if err != nil {
+				return nil, parseError(sourcePath(u.srcs[u.next-1]), err)
+			}
+
+			u.row = row
+
+			if u.partitioned {
+				row = u.appendPartition(row)
+			}
+
+			return row, nil
+		}
+
+		// Report decompression errors at the end of each input.
+		err = u.input.Close()
+		u.input = nil
+		u.rows = nil
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot read input: %s", err)
+		}
+	}
+}
+
+// Raw returns the last row as read from the current source, without the
+// partition key.
+func (u *unionRows) Raw() []string {
+	return rawRow(u.rows, u.row)
+}
+
+// appendPartition appends the partition key of the current source to the
+// row, or the partition column to the header.
+func (u *unionRows) appendPartition(row []string) []string {
+	if !u.header {
+		u.header = true
+		return append(row, PartitionColumn)
+	}
+
+	return append(row, u.srcs[u.next-1].(*fileSource).partition)
+}
+
+func (u *unionRows) open(src source, skipHeader bool) error {
+	input, err := src.Open()
+	if err != nil {
+		return fmt.Errorf("cannot open input: %s", err)
+	}
+
+	rows, err := rowReader(u.r, input, u.prof, u.schema)
+	if err != nil {
+		input.Close()
+		return err
+	}
+
+	u.input = input
+	u.rows = rows
+
+	if skipHeader {
+		if _, err := rows.Read(); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *unionRows) Close() error {
+	if u.input == nil {
+		return nil
+	}
+
+	return u.input.Close()
+}
+
+// jsonFormat returns the JSON format of the request or an empty string
+// if the input is CSV.
+func (r *Request) jsonFormat() string {
+	switch {
+	case r.LDJSON:
+		return "ldjson"
+	case r.JSON:
+		return "json"
+	}
+
+	return ""
+}
+
+// input wraps the input to drop the directive line and the trailing lines.
+func (r *Request) input(in io.Reader) (io.Reader, error) {
+	if r.Directives {
+		var err error
+		if _, in, err = readDirective(in); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.SkipTrailingLines > 0 {
+		return reader.NewTrailerReader(in, r.SkipTrailingLines), nil
+	}
+
+	return in, nil
+}
+
+// maxEnumValues returns the most distinct values of enum-like columns.
+func (r *Request) maxEnumValues() int {
+	if r.EnumTypes && r.MaxEnumValues == 0 {
+		return DefaultMaxEnumValues
+	}
+
+	return r.MaxEnumValues
+}
+
+// profileConfig returns the config of the profiler.
+func (r *Request) profileConfig() *profile.Config {
+	return &profile.Config{
+		Include:    r.includeColumns(),
+		Exclude:    r.ExcludeColumns,
+		NullTokens: r.NullTokens,
+		SnakeCase:  r.SnakeCase,
+		MaxRecords: r.MaxRows,
+		MaxFields:  r.MaxColumns,
+		MaxValues:  r.MaxDistinctValues,
+		Offset:     r.Offset,
+		Limit:      r.Limit,
+
+		MaxUniqueValues: r.MaxUniqueValues,
+		CountDistinct:   r.CountDistinct,
+
+		MaxExamples:  r.MaxExamples,
+		Confidence:   r.TypeConfidence,
+		MaxIntDigits: r.MaxIntDigits,
+		Detectors:    r.Detectors,
+
+		MaxEnumValues: r.maxEnumValues(),
+
+		AllText:     r.AllText,
+		TrackUnique: r.ValidatePrimaryKey,
+	}
+}
+
+func profileInput(r *Request, input io.Reader) (*profile.Profile, error) {
+	input, err := r.input(input)
+	if err != nil {
+		return nil, err
+	}
+
+	config := r.profileConfig()
+
+	if format := r.jsonFormat(); format != "" {
+		jp := json.NewProfiler(input, format)
+		jp.Config = config
+		jp.Separator = r.JSONSeparator
+		jp.MaxDepth = r.JSONMaxDepth
+		return jp.Profile()
+	}
+
+	cp := csv.NewProfiler(input)
+	cp.Config = config
+	cp.Delimiter = r.Delimiter[0]
+	cp.Header = r.Header
+	cp.TypeHints = r.TypeHints
+	cp.HeaderOnly = r.SchemaOnly
+	if r.HeaderDelimiter != "" {
+		cp.HeaderDelimiter = r.HeaderDelimiter[0]
+	}
+	cp.MaxLineSize = r.MaxLineSize
+	if r.RecordSeparator != "" {
+		cp.Split = csv.SplitRecords(r.RecordSeparator[0])
+	}
+
+	prof, err := cp.Profile()
+	if err != nil || !r.SchemaOnly {
+		return prof, err
+	}
+
+	// Without values, columns are typed by hints or as text and may
+	// contain anything.
+	for _, f := range prof.Fields {
+		if f.Type == profile.UnknownType {
+			f.Type = profile.StringType
+		}
+		f.Nullable = true
+		f.Unique = false
+	}
+
+	return prof, nil
+}
+
+// rowReader returns a reader of the rows to load from the input.
+func rowReader(r *Request, input io.Reader, prof *profile.Profile, schema *Schema) (RowReader, error) {
+	input, err := r.input(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if format := r.jsonFormat(); format != "" {
+		name := strings.ToLower
+		if r.SnakeCase {
+			name = profile.SnakeCase
+		}
+
+		rows, err := newJSONRows(input, format, r.JSONSeparator, r.JSONMaxDepth, name, prof, schema)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.window(rows), nil
+	}
+
+	var rows RowReader
+
+	if r.Header && r.HeaderDelimiter != "" {
+		hr, err := newHeaderRows(input, r.HeaderDelimiter[0], r.Delimiter[0])
+		if err != nil {
+			return nil, err
+		}
+		rows = hr
+	} else if r.RecordSeparator != "" {
+		rows = newSeparatedRows(input, r.Delimiter[0], r.RecordSeparator[0], r.MaxLineSize)
+	} else {
+		cr := libcsv.NewReader(input)
+		cr.Comma = rune(r.Delimiter[0])
+		rows = cr
+	}
+
+	if r.TypeHints {
+		rows = &hintRows{rows: rows}
+	}
+
+	if len(r.includeColumns()) > 0 || len(r.ExcludeColumns) > 0 {
+		rows = &selectRows{
+			rows:   rows,
+			prof:   prof,
+			config: r.profileConfig(),
+			header: r.Header,
+		}
+	}
+
+	return r.window(rows), nil
+}
+
+// window wraps the rows to skip those before the offset and past the
+// limit of the request.
+func (r *Request) window(rows RowReader) RowReader {
+	if r.Offset == 0 && r.Limit == 0 {
+		return rows
+	}
+
+	return &windowRows{
+		rows:   rows,
+		config: r.profileConfig(),
+	}
+}
+
+// windowRows passes the header and the rows within the window of the
+// config, that is those that were profiled.
+type windowRows struct {
+	rows   RowReader
+	config *profile.Config
+	header bool
+	n      int64
+	row    []string
+}
+
+func (w *windowRows) Read() ([]string, error) {
+	if !w.header {
+		w.header = true
+
+		row, err := w.rows.Read()
+		w.row = row
+		return row, err
+	}
+
+	for {
+		skip, stop := w.config.Window(w.n)
+		if stop {
+			return nil, io.EOF
+		}
+
+		row, err := w.rows.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		w.n++
+
+		if !skip {
+			w.row = row
+			return row, nil
+		}
+	}
+}
+
+// Raw returns the last row as read from the input.
+func (w *windowRows) Raw() []string {
+	return rawRow(w.rows, w.row)
+}
+
+// separatedRows reads records terminated by a separator other than a
+// newline with the parser of the profiler, so they are split as they were
+// profiled. Records have the number of fields of the first one, missing
+// fields being empty.
+type separatedRows struct {
+	cr *csv.CSVReader
+	n  int
+}
+
+func newSeparatedRows(input io.Reader, delim, sep byte, maxLineSize int) *separatedRows {
+	cr := csv.NewCSVReader(input, delim)
+	cr.Split = csv.SplitRecords(sep)
+	if maxLineSize > 0 {
+		cr.MaxLineSize = maxLineSize
+	}
+
+	return &separatedRows{cr: cr}
+}
+
+func (s *separatedRows) Read() ([]string, error) {
+	if s.n == 0 {
+		row, err := s.cr.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		s.n = len(row)
+		return row, nil
+	}
+
+	row := make([]string, s.n)
+	if err := s.cr.ScanLine(row); err != nil {
+		return nil, err
+	}
+
+	return row, nil
+}
+
+// selectRows drops the columns that were excluded from the profile and
+// orders the others by their index in the profile. The columns are
+// selected by the names in the header or the generated names if there is
+// none.
+type selectRows struct {
+	rows    RowReader
+	prof    *profile.Profile
+	config  *profile.Config
+	header  bool
+	indexes []int
+	raw     []string
+}
+
+func (s *selectRows) Read() ([]string, error) {
+	row, err := s.rows.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	s.raw = row
+
+	if s.indexes == nil {
+		s.indexes = make([]int, len(s.prof.Fields))
+
+		for i, v := range row {
+			n := fmt.Sprintf("c%d", i)
+			if s.header {
+				n = s.config.FieldName(v)
+			}
+
+			if f, ok := s.prof.Fields[n]; ok {
+				s.indexes[f.Index] = i
+			}
+		}
+	}
+
+	selected := make([]string, len(s.indexes))
+	for i, idx := range s.indexes {
+		if idx < len(row) {
+			selected[i] = row[idx]
+		}
+	}
+
+	return selected, nil
+}
+
+// Raw returns the last row with all its columns.
+func (s *selectRows) Raw() []string {
+	return s.raw
+}
+
+// hintRows drops the line of type hints following the header.
+type hintRows struct {
+	rows    RowReader
+	started bool
+}
+
+func (h *hintRows) Read() ([]string, error) {
+	if h.started {
+		return h.rows.Read()
+	}
+
+	h.started = true
+
+	header, err := h.rows.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := h.rows.Read(); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// headerRows reads a header with a different delimiter than the rows.
+type headerRows struct {
+	header []string
+	rows   *libcsv.Reader
+}
+
+func newHeaderRows(input io.Reader, headerSep, sep byte) (*headerRows, error) {
+	br := bufio.NewReader(input)
+
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	hr := libcsv.NewReader(strings.NewReader(line))
+	hr.Comma = rune(headerSep)
+
+	header, err := hr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %s", err)
+	}
+
+	cr := libcsv.NewReader(br)
+	cr.Comma = rune(sep)
+	cr.FieldsPerRecord = len(header)
+
+	return &headerRows{
+		header: header,
+		rows:   cr,
+	}, nil
+}
+
+func (h *headerRows) Read() ([]string, error) {
+	if h.header != nil {
+		header := h.header
+		h.header = nil
+		return header, nil
+	}
+
+	return h.rows.Read()
+}
+
+func writeSQLFile(r *Request, schema *Schema, cr RowReader) (int64, error) {
+	if r.AppendNew {
+		return 0, errors.New("appending new rows is not supported with sql output")
+	}
+
+	if r.MatchColumns {
+		return 0, errors.New("matching the columns of a table is not supported with sql output")
+	}
+
+	if r.TempTable {
+		return 0, errors.New("temporary tables are not supported with sql output")
+	}
+
+	if r.ProfileTable {
+		return 0, errors.New("profile tables are not supported with sql output")
+	}
+
+	if r.RejectsFile != "" {
+		return 0, errors.New("rejects files are not supported with sql output")
+	}
+
+	if r.OnExisting != "" && r.OnExisting != ExistingReplace {
+		return 0, fmt.Errorf("existing table policy %s is not supported with sql output", r.OnExisting)
+	}
+
+	if r.SQLCompressionLevel < 0 || r.SQLCompressionLevel > gzip.BestCompression {
+		return 0, fmt.Errorf("sql compression level must be between 1 and 9, got %d", r.SQLCompressionLevel)
+	}
+
+	level := gzip.DefaultCompression
+	if r.SQLCompressionLevel > 0 {
+		level = r.SQLCompressionLevel
+	}
+
+	// Compressed based on the extension, such as .sql.gz.
+	f, err := reader.CreateLevel(r.SQLFile, "", level)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w := NewSQLWriter(f)
+	w.NullTokens = r.NullTokens
+	w.Format = r.SQLFormat
+	w.Delimiter = r.SQLDelimiter
+	w.NullMarker = r.SQLNull
+	if w.NullMarker == "" {
+		w.NullMarker = r.NullSentinel
+	}
+	w.Analyze = AnalyzeOptions{Target: r.AnalyzeTarget, Verbose: r.AnalyzeVerbose}
+	w.Owner = r.Owner
+	w.Quoting = r.Quoting
+	w.Tablespace = r.Tablespace
+	w.IndexTablespace = r.IndexTablespace
+
+	var n int64
+	if r.AppendTable {
+		n, err = w.Append(r.Schema, r.Table, schema, cr)
+	} else {
+		n, err = w.Replace(r.Schema, r.Table, schema, cr)
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, f.Close()
+}
@@ -0,0 +1,3128 @@
+package sqlimporter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/chop-dbhi/sql-importer/profile"
+	"github.com/chop-dbhi/sql-importer/reader"
+)
+
+// writeTempFile writes the contents to a file in a temporary directory
+// and returns the path.
+func writeTempFile(t *testing.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "sqlimporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestImportProfileLimiter(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	var (
+		mu      sync.Mutex
+		active  int
+		maxSeen int
+	)
+
+	profileHook = func() {
+		mu.Lock()
+		active++
+		if active > maxSeen {
+			maxSeen = active
+		}
+		mu.Unlock()
+
+		// Give other imports a chance to enter profiling.
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}
+	defer func() {
+		profileHook = nil
+	}()
+
+	limiter := NewLimiter(2)
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 8; i++ {
+		r := &Request{
+			Path:           writeTempFile(t, fmt.Sprintf("data%d.csv", i), "id,name\n1,Joe\n2,Sue\n"),
+			Schema:         "public",
+			Delimiter:      ",",
+			Header:         true,
+			ProfileLimiter: limiter,
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := importDB(db, r); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if maxSeen > 2 {
+		t.Errorf("expected at most 2 concurrent profiles, got %d", maxSeen)
+	}
+}
+
+func TestImportResultOnLoadFailure(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	b.execErr = func(query string) error {
+		if strings.HasPrefix(query, "COPY") {
+			return errors.New("copy failed")
+		}
+		return nil
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "data.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	res, err := importDB(db, r)
+	if err == nil {
+		t.Fatal("expected load error")
+	}
+
+	if res == nil || res.Schema == nil || res.Profile == nil {
+		t.Fatal("expected profiled schema on load failure")
+	}
+
+	if len(res.Schema.Fields) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(res.Schema.Fields))
+	}
+
+	if f := res.Schema.Fields[0]; f.Name != "id" || f.Type != "integer" {
+		t.Errorf("expected integer id field, got %s %s", f.Name, f.Type)
+	}
+}
+
+func TestImportNullTokens(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:       writeTempFile(t, "data.csv", "id,name\n1,Joe\n2,\\N\n"),
+		Schema:     "public",
+		Delimiter:  ",",
+		Header:     true,
+		NullTokens: []string{`\N`},
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := res.Profile.Fields["name"]; !f.Nullable || f.Type != profile.StringType {
+		t.Errorf("expected nullable string field, got %s (nullable=%v)", f.Type, f.Nullable)
+	}
+
+	rows := b.copied("public", "data")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	if rows[1][1] != nil {
+		t.Errorf("expected null, got %v", rows[1][1])
+	}
+}
+
+func TestImportCoerce(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "data.csv", "id,count\n1,10\n2,n/a\n3,30\n4,?\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		Coerce:    map[string]string{"count": "integer"},
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := res.Schema.Fields[1]
+
+	if f.Type != "integer" {
+		t.Errorf("expected integer, got %s", f.Type)
+	}
+
+	if f.Coerced != 2 {
+		t.Errorf("expected 2 coerced values, got %d", f.Coerced)
+	}
+
+	rows := b.copied("public", "data")
+
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+
+	for i, exp := range []interface{}{"10", nil, "30", nil} {
+		if rows[i][1] != exp {
+			t.Errorf("row %d: expected %v, got %v", i, exp, rows[i][1])
+		}
+	}
+}
+
+func TestImportRenameColumns(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:          writeTempFile(t, "visits.csv", "Pt ID,Visit Date,Site\n1,2017-01-02,A\n2,2017-03-04,B\n"),
+		Schema:        "public",
+		Delimiter:     ",",
+		Header:        true,
+		RenameColumns: map[string]string{"Pt ID": "patient_id", "site": "Site Name"},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "visits")
+
+	for _, col := range []string{`"patient_id"`, `"visit_date"`, `"site_name"`} {
+		if !strings.Contains(ddl, col) {
+			t.Errorf("expected column %s, got: %s", col, ddl)
+		}
+	}
+
+	copies := b.executed("COPY")
+	if len(copies) != 1 || !strings.Contains(copies[0], `("patient_id", "visit_date", "site_name")`) {
+		t.Errorf("expected renamed copy columns, got %v", copies)
+	}
+
+	rows := b.copied("public", "visits")
+	if len(rows) != 2 || rows[1][0] != "2" || rows[1][2] != "B" {
+		t.Errorf("expected copied values to align, got %v", rows)
+	}
+}
+
+func TestImportCheckCount(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	// Counts returned in turn, before and after the copy.
+	var (
+		counts  []int64
+		queries []string
+	)
+
+	b.query = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.HasPrefix(query, "select count(*)") || len(counts) == 0 {
+			return nil, nil, fmt.Errorf("unexpected query: %s", query)
+		}
+
+		queries = append(queries, query)
+		n := counts[0]
+		counts = counts[1:]
+
+		return []string{"count"}, [][]driver.Value{{n}}, nil
+	}
+
+	r := &Request{
+		Path:       writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:     "public",
+		Table:      "people",
+		Delimiter:  ",",
+		Header:     true,
+		CheckCount: true,
+	}
+
+	counts = []int64{0, 2}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary table is counted before it is renamed.
+	if len(queries) != 2 || queries[0] != queries[1] || strings.Contains(queries[0], `"people"`) {
+		t.Errorf("expected the temporary table to be counted twice, got %v", queries)
+	}
+
+	if len(b.copied("public", "people")) != 2 {
+		t.Errorf("expected 2 rows to be loaded")
+	}
+
+	// A row lost on the way fails the load.
+	r.Table = "visits"
+	counts = []int64{0, 1}
+
+	_, err := importDB(db, r)
+	if !errors.Is(err, ErrCountMismatch) || !strings.Contains(err.Error(), "expected 2") {
+		t.Fatalf("expected count mismatch, got %v", err)
+	}
+
+	if _, ok := b.table("public", "visits"); ok {
+		t.Error("expected the table not to be created")
+	}
+}
+
+func TestImportColumnMap(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "visits.csv", "Pt ID,site,Visit,notes,score\n1,a,2020-01-02,x,5\n2,b,2020-03-04,y,6\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		ColumnMap: []ColumnMapping{
+			{Source: "score", Target: "visit_score"},
+			{Source: "pt id", Target: "patient_id"},
+			{Source: "Visit", Target: "visit_date"},
+		},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "visits")
+	if !strings.Contains(ddl, `( "visit_score" integer unique,"patient_id" integer unique,"visit_date" date unique )`) {
+		t.Errorf("expected the mapped columns in order, got: %s", ddl)
+	}
+
+	exp := [][]interface{}{
+		{"5", "1", "2020-01-02"},
+		{"6", "2", "2020-03-04"},
+	}
+
+	if rows := b.copied("public", "visits"); !reflect.DeepEqual(rows, exp) {
+		t.Errorf("expected %v, got %v", exp, rows)
+	}
+
+	for _, m := range [][]ColumnMapping{
+		{{Source: "missing", Target: "x"}},
+		{{Source: "site", Target: "x"}, {Source: "notes", Target: "X"}},
+		{{Source: "site", Target: "x"}, {Source: "SITE", Target: "y"}},
+	} {
+		r.ColumnMap = m
+		if _, err := importDB(db, r); err == nil {
+			t.Errorf("expected an error mapping %v", m)
+		}
+	}
+}
+
+func TestImportRenameColumnsCollide(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	r := &Request{
+		Path:          writeTempFile(t, "visits.csv", "id,site\n1,A\n"),
+		Schema:        "public",
+		Delimiter:     ",",
+		Header:        true,
+		RenameColumns: map[string]string{"site": "ID"},
+	}
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected colliding rename to fail")
+	}
+}
+
+func TestImportJSONArrays(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:   writeTempFile(t, "posts.ldjson", "{\"id\": 1, \"tags\": [\"a\", \"b \\\"c\\\"\"]}\n{\"id\": 2, \"tags\": []}\n"),
+		Schema: "public",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "posts")
+	if !strings.Contains(ddl, `"tags" text[]`) {
+		t.Errorf("expected text array column, got: %s", ddl)
+	}
+
+	rows := b.copied("public", "posts")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	for i, exp := range []string{`{"a","b \"c\""}`, `{}`} {
+		if rows[i][1] != exp {
+			t.Errorf("row %d: expected %s, got %v", i, exp, rows[i][1])
+		}
+	}
+}
+
+func TestImportJSONNested(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:   writeTempFile(t, "people.json", `[{"name": "Joe", "address": {"zip": "19104"}}]`),
+		Schema: "public",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "people")
+	if !strings.Contains(ddl, `"address_zip" text`) {
+		t.Errorf("expected address_zip column, got: %s", ddl)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 1 || rows[0][0] != "19104" {
+		t.Errorf("expected zip to be copied, got %v", rows)
+	}
+}
+
+func TestImportJSONMaxDepth(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:         writeTempFile(t, "people.json", `[{"address": {"geo": {"lat": 39.9}, "zip": "19104"}}]`),
+		Schema:       "public",
+		JSONMaxDepth: 1,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "people")
+	if !strings.Contains(ddl, `"address_geo" jsonb`) {
+		t.Errorf("expected jsonb column, got: %s", ddl)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 1 || rows[0][0] != `{"lat":39.9}` {
+		t.Errorf("expected inner object as JSON, got %v", rows)
+	}
+}
+
+func TestImportJSONObject(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:   writeTempFile(t, "config.json", `{"name": "export", "version": 3}`),
+		Schema: "public",
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 1 {
+		t.Errorf("expected 1 row, got %d", res.Rows)
+	}
+
+	rows := b.copied("public", "config")
+	if len(rows) != 1 || rows[0][0] != "export" || rows[0][1] != "3" {
+		t.Errorf("expected object to be copied, got %v", rows)
+	}
+}
+
+func TestImportJSONBigInteger(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:   writeTempFile(t, "events.ldjson", "{\"id\": 12345678901234567890}\n{\"id\": 12345678901234567891}\n"),
+		Schema: "public",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "events")
+	if !strings.Contains(ddl, `"id" text`) {
+		t.Errorf("expected text column, got: %s", ddl)
+	}
+
+	rows := b.copied("public", "events")
+	if len(rows) != 2 || rows[0][0] != "12345678901234567890" || rows[1][0] != "12345678901234567891" {
+		t.Errorf("expected exact values, got %v", rows)
+	}
+}
+
+func TestImportBoolVariants(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "flags.csv", "id,active\n1,Y\n2,N\n3,y\n4,\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "flags")
+	if !strings.Contains(ddl, `"active" boolean`) {
+		t.Errorf("expected boolean column, got: %s", ddl)
+	}
+
+	rows := b.copied("public", "flags")
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+
+	for i, exp := range []interface{}{"true", "false", "true", nil} {
+		if rows[i][1] != exp {
+			t.Errorf("row %d: expected %v, got %v", i, exp, rows[i][1])
+		}
+	}
+}
+
+func TestImportDatesISO(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "visits.csv", "id,visited,seen\n1,01/02/2014,2014-01-02T10:30:00Z\n2,12/31/2014,2014-12-31 08:00\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The layout matched while profiling is used to load.
+	if l := res.Schema.Fields[1].Layout; l != "01/02/2006" {
+		t.Errorf("expected 01/02/2006 layout, got %q", l)
+	}
+
+	rows := b.copied("public", "visits")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	exp := [][]interface{}{
+		{"2014-01-02", "2014-01-02 10:30:00"},
+		{"2014-12-31", "2014-12-31 08:00:00"},
+	}
+
+	for i, e := range exp {
+		if rows[i][1] != e[0] || rows[i][2] != e[1] {
+			t.Errorf("row %d: expected %v, got %v", i, e, rows[i][1:])
+		}
+	}
+}
+
+func TestImportPartitions(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	var header, row []string
+	for i := 0; i < 1500; i++ {
+		header = append(header, fmt.Sprintf("c%d", i))
+		row = append(row, "1")
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "wide.csv", strings.Join(header, ",")+"\n"+strings.Join(row, ",")+"\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.RowIDColumn != "_row_id" {
+		t.Errorf("expected row id column, got %q", res.RowIDColumn)
+	}
+
+	if !res.View {
+		t.Error("expected a view")
+	}
+
+	if len(res.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(res.Partitions))
+	}
+
+	var n int
+	for i, p := range res.Partitions {
+		if exp := fmt.Sprintf("wide_%d", i); p.Table != exp {
+			t.Errorf("expected partition %s, got %s", exp, p.Table)
+		}
+		n += len(p.Columns)
+	}
+
+	if n != 1500 {
+		t.Errorf("expected 1500 partitioned columns, got %d", n)
+	}
+}
+
+func TestImportPreserveEmpty(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:          writeTempFile(t, "notes.csv", "id,note,comment\n1,,\n2,a,b\n3,\\N,c\n"),
+		Schema:        "public",
+		Delimiter:     ",",
+		Header:        true,
+		NullTokens:    []string{`\N`},
+		PreserveEmpty: []string{"note"},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := b.copied("public", "notes")
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	exp := [][]interface{}{
+		{"", nil},
+		{"a", "b"},
+		{nil, "c"},
+	}
+
+	for i, e := range exp {
+		if rows[i][1] != e[0] || rows[i][2] != e[1] {
+			t.Errorf("row %d: expected %v, got %v", i, e, rows[i][1:])
+		}
+	}
+}
+
+func TestImportNormalizeSpace(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:           writeTempFile(t, "notes.csv", "id,note,comment\n1,\"a   b\",\"a   b\"\n2,\" c\t\td \",x\n3,\"   \",y\n"),
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+		NormalizeSpace: []string{"note"},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := b.copied("public", "notes")
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	// Other columns are loaded as is and values of only whitespace
+	// are nulls.
+	exp := [][]interface{}{
+		{"a b", "a   b"},
+		{"c d", "x"},
+		{nil, "y"},
+	}
+
+	for i, e := range exp {
+		if rows[i][1] != e[0] || rows[i][2] != e[1] {
+			t.Errorf("row %d: expected %q, got %q", i, e, rows[i][1:])
+		}
+	}
+}
+
+// ZIP+4 codes are classified by a custom detector with a SQL type.
+var zipType = profile.NewType("zip4")
+
+func detectZip(v string) (profile.ValueType, bool) {
+	ok := len(v) == 10 && v[5] == '-' && strings.Trim(v[:5]+v[6:], "0123456789") == ""
+	return zipType, ok
+}
+
+func TestImportCustomType(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "sites.csv", "id,zip\n1,19104-4399\n2,19146-1234\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		Detectors: []profile.Detector{detectZip},
+		SQLTypes:  map[profile.ValueType]string{zipType: "char(10)"},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, _ := b.table("public", "sites")
+	if !strings.Contains(ddl, `"zip" char(10)`) {
+		t.Errorf("expected char column, got: %s", ddl)
+	}
+
+	if rows := b.copied("public", "sites"); len(rows) != 2 || rows[0][1] != "19104-4399" {
+		t.Errorf("expected codes to be loaded as is, got %v", rows)
+	}
+
+	// Other requests do not detect the custom type.
+	db, b = newFakeDB(t)
+	r.Detectors = nil
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if ddl, _ := b.table("public", "sites"); !strings.Contains(ddl, `"zip" text`) {
+		t.Errorf("expected text column, got: %s", ddl)
+	}
+}
+
+func TestImportRowRange(t *testing.T) {
+	var data strings.Builder
+	data.WriteString("id,name\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&data, "%d,n%d\n", i, i)
+	}
+
+	t.Run("slice", func(t *testing.T) {
+		db, b := newFakeDB(t)
+
+		r := &Request{
+			Path:      writeTempFile(t, "people.csv", data.String()),
+			Schema:    "public",
+			Delimiter: ",",
+			Header:    true,
+			Offset:    3,
+			Limit:     4,
+		}
+
+		res, err := importDB(db, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Profile.RecordCount != 4 {
+			t.Errorf("expected 4 profiled rows, got %d", res.Profile.RecordCount)
+		}
+
+		rows := b.copied("public", "people")
+		if len(rows) != 4 {
+			t.Fatalf("expected 4 rows, got %d", len(rows))
+		}
+
+		for i, row := range rows {
+			if exp := fmt.Sprintf("n%d", i+4); row[1] != exp {
+				t.Errorf("row %d: expected %s, got %v", i, exp, row)
+			}
+		}
+	})
+
+	t.Run("past end", func(t *testing.T) {
+		db, b := newFakeDB(t)
+
+		r := &Request{
+			Path:      writeTempFile(t, "people.csv", data.String()),
+			Schema:    "public",
+			Delimiter: ",",
+			Header:    true,
+			Offset:    20,
+		}
+
+		if _, err := importDB(db, r); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := b.table("public", "people"); !ok {
+			t.Error("expected the table to be created")
+		}
+
+		if rows := b.copied("public", "people"); len(rows) != 0 {
+			t.Errorf("expected no rows, got %v", rows)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		db, b := newFakeDB(t)
+
+		r := &Request{
+			Path:   writeTempFile(t, "people.ldjson", "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"),
+			Schema: "public",
+			LDJSON: true,
+			Offset: 1,
+			Limit:  1,
+		}
+
+		if _, err := importDB(db, r); err != nil {
+			t.Fatal(err)
+		}
+
+		if rows := b.copied("public", "people"); len(rows) != 1 || rows[0][0] != "2" {
+			t.Errorf("expected the second row, got %v", rows)
+		}
+	})
+}
+
+func TestImportNullSentinel(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:          writeTempFile(t, "notes.csv", "id,note\n1,\n2,\\N\n3,a\n4,null\n"),
+		Schema:        "public",
+		Delimiter:     ",",
+		Header:        true,
+		NullTokens:    []string{"null"},
+		PreserveEmpty: []string{"note"},
+		NullSentinel:  "__NULL__",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.executed(`WITH (NULL '__NULL__')`)) == 0 {
+		t.Error("expected the null sentinel in the copy statement")
+	}
+
+	rows := b.copied("public", "notes")
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+
+	// Empty strings and \N are loaded as is and nulls as the sentinel.
+	exp := []interface{}{"", `\N`, "a", "__NULL__"}
+
+	for i, e := range exp {
+		if rows[i][1] != e {
+			t.Errorf("row %d: expected %q, got %v", i, e, rows[i][1])
+		}
+	}
+
+	// Without a sentinel nulls are sent as nil and escaped values as is,
+	// so they are distinct as well.
+	r.NullSentinel = ""
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	rows = b.copied("public", "notes")
+	exp = []interface{}{"", `\N`, "a", nil}
+
+	for i, e := range exp {
+		if rows[i][1] != e {
+			t.Errorf("row %d: expected %v, got %v", i, e, rows[i][1])
+		}
+	}
+
+	// Values equal to the sentinel would be loaded as nulls.
+	r.NullSentinel = "__NULL__"
+	r.Path = writeTempFile(t, "notes.csv", "id,note\n1,__NULL__\n")
+
+	_, err := importDB(db, r)
+	if err == nil || !strings.Contains(err.Error(), "null sentinel") {
+		t.Fatalf("expected null sentinel error, got %v", err)
+	}
+
+	r.NullSentinel = "\t"
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected invalid null sentinel error")
+	}
+}
+
+func TestImportColumnDefaults(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "orders.csv", "id,status,created\n1,,\n2,paid,2017-03-01\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		ColumnDefaults: map[string]string{
+			"Status":  "new",
+			"created": "now()",
+		},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, _ := b.table("public", "orders")
+
+	for _, s := range []string{`"status" text default 'new'`, `"created" date default now()`} {
+		if !strings.Contains(stmt, s) {
+			t.Errorf("expected %s in %s", s, stmt)
+		}
+	}
+
+	fill := `set "status" = coalesce("status", 'new'), "created" = coalesce("created", now()) where "status" is null or "created" is null`
+	if fills := b.executed(fill); len(fills) != 1 {
+		t.Errorf("expected the nulls to be defaulted by one update, got %v", b.executed("update"))
+	}
+
+	r.Table = ""
+	r.ColumnDefaults = map[string]string{"state": "new"}
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected error for the default of an unknown column")
+	}
+}
+
+func TestImportColumnDefaultsSnakeCase(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "visits.csv", "VisitID,PatientID\n1,\n2,7\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		SnakeCase: true,
+		ColumnDefaults: map[string]string{
+			"PatientID": "0",
+		},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt, _ := b.table("public", "visits"); !strings.Contains(stmt, `"patient_id" integer default '0'`) {
+		t.Errorf("expected the default of patient_id in %s", stmt)
+	}
+}
+
+func TestImportNullability(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "people.csv", "id,name,color\n1,Joe,\n2,Sue,Red\n"),
+		Schema:          "public",
+		Delimiter:       ",",
+		Header:          true,
+		NotNullColumns:  []string{"Color"},
+		NullableColumns: []string{"name"},
+	}
+
+	_, err := importDB(db, r)
+	if err == nil || !strings.Contains(err.Error(), "null value in not null column color at row 1") {
+		t.Fatalf("expected not null error, got %v", err)
+	}
+
+	if rows := b.copied("public", "people"); len(rows) != 0 {
+		t.Errorf("expected no rows to be loaded, got %d", len(rows))
+	}
+
+	stmts := b.executed("create table")
+	if len(stmts) != 1 {
+		t.Fatalf("expected one create table, got %d", len(stmts))
+	}
+
+	for _, col := range []string{`"color" text not null`, `"name" text,`} {
+		if !strings.Contains(stmts[0], col) {
+			t.Errorf("expected column %s in %s", col, stmts[0])
+		}
+	}
+
+	r.NullableColumns = []string{"color"}
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected conflicting nullability to fail")
+	}
+}
+
+func TestImportPrimaryKeyFirst(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:          "public",
+		Delimiter:       ",",
+		Header:          true,
+		PrimaryKeyFirst: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := res.Schema.Fields[0]; !f.PrimaryKey || f.Nullable {
+		t.Errorf("expected id to be a not null primary key, got %+v", f)
+	}
+
+	if stmts := b.executed(`"id" integer primary key`); len(stmts) != 1 {
+		t.Errorf("expected primary key, got %v", b.executed("create table"))
+	}
+
+	// A duplicate key fails before loading if validated.
+	r.Path = writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n1,Bob\n")
+	r.ValidatePrimaryKey = true
+
+	if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("expected duplicate key error, got %v", err)
+	}
+
+	// A named column.
+	r.PrimaryKeyFirst = false
+	r.PrimaryKey = "Name"
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmts := b.executed(`"name" text primary key`); len(stmts) != 1 {
+		t.Errorf("expected name primary key, got %v", b.executed("create table"))
+	}
+
+	r.PrimaryKey = "missing"
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected error for missing primary key column")
+	}
+
+	r.PrimaryKey = "name"
+	r.IdentityColumn = "row_id"
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected error for primary key and identity column")
+	}
+}
+
+func TestImportRowHash(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n1,Joe\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		RowHash:   &RowHash{},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmts := b.executed(`"_row_hash" text not null`); len(stmts) != 1 {
+		t.Errorf("expected row hash column, got %v", b.executed("create table"))
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	sum := sha256.Sum256([]byte("1\x00Joe\x00"))
+	if exp := hex.EncodeToString(sum[:]); rows[0][2] != exp {
+		t.Errorf("expected hash %s, got %v", exp, rows[0][2])
+	}
+
+	if rows[0][2] != rows[2][2] {
+		t.Errorf("expected identical rows to have the same hash, got %v and %v", rows[0][2], rows[2][2])
+	}
+
+	if rows[0][2] == rows[1][2] {
+		t.Error("expected different rows to have different hashes")
+	}
+
+	// Only the hashed columns contribute.
+	r.RowHash = &RowHash{Algorithm: "md5", Columns: []string{"name"}}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	md := md5.Sum([]byte("Joe\x00"))
+	if rows := b.copied("public", "people"); rows[0][2] != hex.EncodeToString(md[:]) {
+		t.Errorf("expected md5 of name, got %v", rows[0][2])
+	}
+
+	r.RowHash = &RowHash{Columns: []string{"missing"}}
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected unknown hash column to fail")
+	}
+}
+
+func TestImportAppendNew(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		AppendNew: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows are copied into a temporary table and inserted if new.
+	copies := b.executed("COPY")
+	if len(copies) != 1 || strings.Contains(copies[0], `"people"`) {
+		t.Errorf("expected copy into a temporary table, got %v", copies)
+	}
+
+	inserts := b.executed("insert into")
+	if len(inserts) != 1 {
+		t.Fatalf("expected one insert, got %v", inserts)
+	}
+
+	for _, s := range []string{
+		`insert into "public"."people" ("id", "name", "_row_hash") select "id", "name", "_row_hash" from "public".`,
+		`where not exists (select 1 from "public"."people" x where x."_row_hash" = t."_row_hash")`,
+	} {
+		if !strings.Contains(inserts[0], s) {
+			t.Errorf("expected insert to contain %q:\n%s", s, inserts[0])
+		}
+	}
+
+	if stmts := b.executed(`create unlogged table`); len(stmts) != 1 {
+		t.Errorf("expected unlogged temporary table, got %v", b.executed("create"))
+	}
+
+	if drops := b.executed("drop table"); len(drops) != 1 {
+		t.Errorf("expected temporary table to be dropped, got %v", drops)
+	}
+
+	if _, ok := b.table("public", "people"); !ok {
+		t.Error("expected table to be created")
+	}
+}
+
+func TestImportMatchColumns(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	// The table has columns with defaults not in the file.
+	b.query = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.Contains(query, "information_schema.columns") {
+			return nil, nil, fmt.Errorf("unexpected query: %s", query)
+		}
+
+		var rows [][]driver.Value
+		if args[0] == "public" && args[1] == "people" {
+			for _, col := range []string{"pk", "id", "name", "age", "loaded_at"} {
+				rows = append(rows, []driver.Value{col})
+			}
+		}
+
+		return []string{"column_name"}, rows, nil
+	}
+
+	r := &Request{
+		Path:         writeTempFile(t, "people.csv", "ID,Name,Age\n1,Joe,30\n2,Sue,40\n"),
+		Schema:       "public",
+		Delimiter:    ",",
+		Header:       true,
+		MatchColumns: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected 2 rows, got %d", res.Rows)
+	}
+
+	if stmts := b.executed("create table"); len(stmts) != 0 {
+		t.Errorf("expected no table to be created, got %v", stmts)
+	}
+
+	copies := b.executed("COPY")
+	if len(copies) != 1 || !strings.Contains(copies[0], `"people" ("id", "name", "age")`) {
+		t.Errorf("expected copy of the file columns, got %v", copies)
+	}
+
+	r.Path = writeTempFile(t, "people.csv", "id,name,city\n1,Joe,Philadelphia\n")
+
+	if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "city") {
+		t.Errorf("expected error for unmatched column, got %v", err)
+	}
+
+	r.Table = "missing"
+
+	if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected error for missing table, got %v", err)
+	}
+}
+
+func TestImportStatementTimeout(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:             writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:           "public",
+		Delimiter:        ",",
+		Header:           true,
+		StatementTimeout: 1500 * time.Millisecond,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	sets := b.executed("set local statement_timeout = 1500")
+	if len(sets) < 2 {
+		t.Fatalf("expected timeout in each transaction, got %v", sets)
+	}
+
+	// The copy runs in a transaction with the timeout.
+	b.mu.Lock()
+	execs := b.execs
+	b.mu.Unlock()
+
+	for i, stmt := range execs {
+		if strings.HasPrefix(stmt, "COPY") && (i == 0 || !strings.HasPrefix(execs[i-1], "set local statement_timeout")) {
+			t.Errorf("expected timeout before copy, got %v", execs)
+		}
+	}
+
+	// Timeouts under a millisecond are rounded up rather than disabled.
+	db, b = newFakeDB(t)
+	r.StatementTimeout = 500 * time.Microsecond
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	sets = b.executed("statement_timeout")
+	if len(sets) == 0 {
+		t.Fatal("expected timeout")
+	}
+
+	for _, stmt := range sets {
+		if stmt != "set local statement_timeout = 1" {
+			t.Errorf("expected timeout of 1ms, got %s", stmt)
+		}
+	}
+
+	// No timeout is set by default.
+	db, b = newFakeDB(t)
+	r.StatementTimeout = 0
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if sets := b.executed("statement_timeout"); len(sets) != 0 {
+		t.Errorf("expected no timeout, got %v", sets)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	rejects := filepath.Join(t.TempDir(), "rejects.csv")
+
+	r := &Request{
+		Path:           writeTempFile(t, "people.csv", "id|name|age\n1|Joe|30\n2|Sue|\n3|\"Smith| Al\"|\n4|Ann|40\n"),
+		Schema:         "public",
+		Delimiter:      "|",
+		Header:         true,
+		NotNullColumns: []string{"age"},
+		RejectsFile:    rejects,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 || res.Rejected != 2 {
+		t.Fatalf("expected 2 loaded and 2 rejected rows, got %d and %d", res.Rows, res.Rejected)
+	}
+
+	f, err := os.Open(rejects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := csv.NewReader(f)
+	cr.Comma = '|'
+	records, err := cr.ReadAll()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected a header and 2 rejected rows, got %d", len(records))
+	}
+
+	if got := strings.Join(records[0], ","); got != "id,name,age,"+RejectErrorColumn {
+		t.Errorf("expected the header with the error column, got %s", got)
+	}
+
+	if records[2][1] != "Smith| Al" || !strings.Contains(records[2][3], "null value") {
+		t.Errorf("expected the original fields and the error, got %q", records[2])
+	}
+
+	// Fix the rejected rows and import them into the table.
+	records[1][2] = "50"
+	records[2][2] = "60"
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = '|'
+	w.WriteAll(records)
+
+	r2 := &Request{
+		Path:           writeTempFile(t, "fixed.csv", buf.String()),
+		Schema:         "public",
+		Table:          "people",
+		Delimiter:      "|",
+		Header:         true,
+		AppendTable:    true,
+		NotNullColumns: []string{"age"},
+		ExcludeColumns: []string{RejectErrorColumn},
+	}
+
+	if res, err = importDB(db, r2); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected the 2 fixed rows to load, got %d", res.Rows)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+
+	if got := fmt.Sprint(rows[3]); got != "[3 Smith| Al 60]" {
+		t.Errorf("expected the fixed row, got %v", rows[3])
+	}
+}
+
+func TestImportRejectsExcludedColumns(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	rejects := filepath.Join(t.TempDir(), "rejects.csv")
+
+	r := &Request{
+		Path:           writeTempFile(t, "people.csv", "id,note,name,age\n1,a,Joe,30\n2,b,Sue,\n3,c,Al,\n"),
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+		ExcludeColumns: []string{"note"},
+		NotNullColumns: []string{"age"},
+		Offset:         1,
+		RejectsFile:    rejects,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rejected != 2 {
+		t.Fatalf("expected 2 rejected rows, got %d", res.Rejected)
+	}
+
+	b, err := ioutil.ReadFile(rejects)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows are written as read, including the excluded columns.
+	exp := "id,note,name,age,_error\n2,b,Sue,,"
+	if !strings.HasPrefix(string(b), exp) || !strings.Contains(string(b), "\n3,c,Al,,") {
+		t.Errorf("expected the rows as read, got:\n%s", b)
+	}
+}
+
+func TestImportTypeConfidence(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var data strings.Builder
+	data.WriteString("id,count\n")
+	for i := 1; i <= 999; i++ {
+		fmt.Fprintf(&data, "%d,%d\n", i, i*10)
+	}
+	data.WriteString("1000,n/a\n")
+
+	r := &Request{
+		Path:           writeTempFile(t, "counts.csv", data.String()),
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+		TypeConfidence: 0.99,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := res.Schema.Fields[1]
+
+	if f.Type != "integer" || !f.Nullable {
+		t.Errorf("expected nullable integer count, got %s", f.Type)
+	}
+
+	if f.Coerced != 1 {
+		t.Errorf("expected 1 value loaded as null, got %d", f.Coerced)
+	}
+
+	rows := b.copied("public", "counts")
+	if len(rows) != 1000 || rows[999][1] != nil {
+		t.Errorf("expected the last count to be null, got %v", rows[len(rows)-1])
+	}
+
+	r.Table = ""
+	r.TypeConfidence = 2
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected an error for a confidence above 1")
+	}
+}
+
+func TestImportMaxIntDigits(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:         writeTempFile(t, "accounts.csv", "id,account\n1,1234567890123456789\n2,9876543210987654321\n"),
+		Schema:       "public",
+		Delimiter:    ",",
+		Header:       true,
+		MaxIntDigits: 18,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if typ := res.Schema.Fields[1].Type; typ != "text" {
+		t.Errorf("expected text account, got %s", typ)
+	}
+
+	if rows := b.copied("public", "accounts"); len(rows) != 2 || rows[0][1] != "1234567890123456789" {
+		t.Errorf("expected the accounts to be loaded as is, got %v", rows)
+	}
+}
+
+func TestImportIntDigitsPhone(t *testing.T) {
+	contents := "id,phone,count\n1,2155551234,7\n2,6105559876,8\n"
+
+	tests := map[int]string{
+		// Phone numbers overflow an integer column.
+		9: "text",
+
+		// Up to 18 digits are allowed, which fit a bigint column.
+		18: "bigint",
+		0:  "bigint",
+	}
+
+	for digits, expected := range tests {
+		db, b := newFakeDB(t)
+
+		r := &Request{
+			Path:         writeTempFile(t, "contacts.csv", contents),
+			Schema:       "public",
+			Delimiter:    ",",
+			Header:       true,
+			MaxIntDigits: digits,
+		}
+
+		res, err := importDB(db, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if typ := res.Schema.Fields[1].Type; typ != expected {
+			t.Errorf("%d digits: expected %s phone, got %s", digits, expected, typ)
+		}
+
+		// Short integers still fit an integer column.
+		if typ := res.Schema.Fields[2].Type; typ != "integer" {
+			t.Errorf("%d digits: expected integer count, got %s", digits, typ)
+		}
+
+		if rows := b.copied("public", "contacts"); len(rows) != 2 || rows[0][1] != "2155551234" {
+			t.Errorf("%d digits: expected the phones to be loaded as is, got %v", digits, rows)
+		}
+	}
+}
+
+func TestImportCstoreStripes(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:             writeTempFile(t, "events.csv", "id,name\n1,a\n2,b\n3,c\n4,d\n5,\n"),
+		Schema:           "public",
+		Delimiter:        ",",
+		Header:           true,
+		CStore:           true,
+		CStoreStripeRows: 2,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 5 {
+		t.Errorf("expected 5 rows, got %d", res.Rows)
+	}
+
+	if stmts := b.executed("stripe_row_count '2'"); len(stmts) != 1 {
+		t.Errorf("expected the stripe rows to be set on the table, got %v", b.executed("create"))
+	}
+
+	// Two full stripes and the remainder.
+	inserts := b.executed("select * from unnest(")
+	if len(inserts) != 3 {
+		t.Fatalf("expected 3 stripe inserts, got %d", len(inserts))
+	}
+
+	if !strings.Contains(inserts[0], `("id", "name") select * from unnest($1::text[]::integer[], $2::text[]::text[])`) {
+		t.Errorf("unexpected insert: %s", inserts[0])
+	}
+
+	if len(b.executed("COPY")) != 0 {
+		t.Error("expected cstore rows not to be copied")
+	}
+}
+
+func TestImportEnumTypes(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var data strings.Builder
+	data.WriteString("id,status\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&data, "%d,%s\n", i, []string{"active", "inactive", "pending"}[i%3])
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", data.String()),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		AllText:   true,
+		EnumTypes: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := res.Schema.Fields[1]; f.Type != `"public"."people_status"` {
+		t.Errorf("expected the enum type, got %s", f.Type)
+	}
+
+	// The unique id has more values than the limit.
+	if f := res.Schema.Fields[0]; f.Type != "text" {
+		t.Errorf("expected text id, got %s", f.Type)
+	}
+
+	if stmts := b.executed(`create type "public"."people_status" as enum ('active', 'inactive', 'pending')`); len(stmts) != 1 {
+		t.Errorf("expected the enum type to be created, got %v", b.executed("type"))
+	}
+
+	if stmts := b.executed(`alter type "public"."people_status" add value if not exists`); len(stmts) != 3 {
+		t.Errorf("expected the values to be added if missing, got %v", stmts)
+	}
+
+	if stmts := b.executed(`"status" "public"."people_status"`); len(stmts) != 1 {
+		t.Errorf("expected the column to have the enum type, got %v", b.executed("create table"))
+	}
+}
+
+func TestImportEnumTypesNormalizeSpace(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var data strings.Builder
+	data.WriteString("code,status\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&data, "c %d,%s\n", i, []string{"active", "on hold", "on  hold", " active"}[i%4])
+	}
+	data.WriteString("c  1,active\n")
+
+	r := &Request{
+		Path:           writeTempFile(t, "people.csv", data.String()),
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+		EnumTypes:      true,
+		NormalizeSpace: []string{"*"},
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The enum has the normalized values, which are loaded.
+	f := res.Schema.Fields[1]
+	if !reflect.DeepEqual(f.Enum, []string{"active", "on hold"}) {
+		t.Errorf("expected the normalized enum values, got %q", f.Enum)
+	}
+
+	if stmts := b.executed(`create type "public"."people_status" as enum ('active', 'on hold')`); len(stmts) != 1 {
+		t.Errorf("expected the enum type to be created, got %v", b.executed("type"))
+	}
+
+	for _, row := range b.copied("public", "people") {
+		if v := row[1]; v != "active" && v != "on hold" {
+			t.Errorf("expected a value of the enum, got %q", v)
+		}
+	}
+
+	// The codes are unique as profiled, but not once normalized.
+	if f := res.Schema.Fields[0]; f.Unique {
+		t.Error("expected the normalized code to not be unique")
+	}
+}
+
+func TestImportAllText(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name,dob,active\n1,Joe,2013-03-11,true\n2,,2008-02-24,false\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		AllText:   true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range res.Schema.Fields {
+		if f.Type != "text" {
+			t.Errorf("expected %s to be text, got %s", f.Name, f.Type)
+		}
+	}
+
+	if !res.Schema.Fields[1].Nullable {
+		t.Error("expected name to be nullable")
+	}
+
+	if rows := b.copied("public", "people"); len(rows) != 2 {
+		t.Errorf("expected 2 rows, got %d", len(rows))
+	}
+
+	// JSON values are typed without detection.
+	r.CSV = false
+	r.Path = writeTempFile(t, "people.ldjson", `{"id": 1, "active": true}`+"\n")
+	r.Table = ""
+
+	if res, err = importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range res.Schema.Fields {
+		if f.Type != "text" {
+			t.Errorf("expected JSON %s to be text, got %s", f.Name, f.Type)
+		}
+	}
+}
+
+func TestImportExcludeColumns(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:           writeTempFile(t, "people.csv", "id,Load_Tmp,name,row_tmp,age\nx,1,Joe,a,30\ny,2,Sue,b,40\n"),
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+		ExcludeColumns: []string{"*_tmp"},
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range res.Schema.Fields {
+		names = append(names, f.Name)
+	}
+
+	if got := strings.Join(names, ","); got != "id,name,age" {
+		t.Fatalf("expected the tmp columns to be excluded, got %s", got)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	if got := fmt.Sprint(rows[1]); got != "[y Sue 40]" {
+		t.Errorf("expected the tmp values to be skipped, got %v", rows[1])
+	}
+}
+
+func TestImportOwner(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	b.query = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.Contains(query, "pg_namespace") {
+			return nil, nil, fmt.Errorf("unexpected query: %s", query)
+		}
+
+		return []string{"exists"}, [][]driver.Value{{args[0] == "public"}}, nil
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name\n1,Joe\n"),
+		Schema:    "staging",
+		Delimiter: ",",
+		Header:    true,
+		Owner:     "etl_service",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.executed(`alter schema "staging" owner to "etl_service"`)) != 1 {
+		t.Error("expected the schema owner to be set")
+	}
+
+	// The table is created under a temporary name and renamed.
+	owners := b.executed(`owner to "etl_service"`)
+	if len(owners) != 2 || !strings.HasPrefix(owners[1], `alter table "staging".`) {
+		t.Errorf("expected the table owner to be set, got %q", owners)
+	}
+
+	// An existing schema is left alone while the table is still owned.
+	pub := *r
+	pub.Schema = "public"
+
+	if _, err := importDB(db, &pub); err != nil {
+		t.Fatal(err)
+	}
+
+	if alters := b.executed(`alter schema "public"`); len(alters) != 0 {
+		t.Errorf("expected the existing schema to be left alone, got %q", alters)
+	}
+
+	if owners := b.executed(`owner to "etl_service"`); len(owners) != 3 || !strings.HasPrefix(owners[2], `alter table "public".`) {
+		t.Error("expected the table owner to be set in the existing schema")
+	}
+
+	for _, role := range []string{"etl service", `etl"; drop table x; --`, "Etl"} {
+		r.Owner = role
+		if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "invalid owner") {
+			t.Errorf("%q: expected an invalid owner error, got %v", role, err)
+		}
+	}
+}
+
+func TestImportTablespace(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:          "public",
+		Table:           "people",
+		Delimiter:       ",",
+		Header:          true,
+		IdentityColumn:  "row_id",
+		Tablespace:      "bulk",
+		IndexTablespace: "fast_idx",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	creates := b.executed("create table")
+	if len(creates) != 1 {
+		t.Fatalf("expected one table to be created, got %q", creates)
+	}
+
+	for _, clause := range []string{
+		`"row_id" bigint generated always as identity primary key using index tablespace "fast_idx"`,
+		`"id" integer unique using index tablespace "fast_idx"`,
+		`) tablespace "bulk"`,
+	} {
+		if !strings.Contains(creates[0], clause) {
+			t.Errorf("expected %s in %s", clause, creates[0])
+		}
+	}
+
+	for _, name := range []string{"bulk data", `bulk"; drop table x; --`, "1bulk"} {
+		r.Tablespace = name
+		if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "invalid tablespace") {
+			t.Errorf("%q: expected an invalid tablespace error, got %v", name, err)
+		}
+	}
+}
+
+func TestImportTempTable(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name,age\n1,Joe,30\n2,Sue,40\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		TempTable: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected 2 rows, got %d", res.Rows)
+	}
+
+	// The transaction is rolled back, so nothing is committed.
+	if _, ok := b.table(tempSchema, "people"); ok {
+		t.Error("expected the temporary table to be discarded")
+	}
+
+	if _, ok := b.table("public", "people"); ok {
+		t.Error("expected no table to be created")
+	}
+
+	if rows := b.copied(tempSchema, "people"); len(rows) != 0 {
+		t.Errorf("expected no rows to be kept, got %d", len(rows))
+	}
+
+	r.AppendTable = true
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected appending to a temporary table to fail")
+	}
+}
+
+func TestImportProfileTable(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:         writeTempFile(t, "people.csv", "id,name,active\n1,Joe,true\n2,,false\n"),
+		Schema:       "public",
+		Delimiter:    ",",
+		Header:       true,
+		ProfileTable: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.executed(`create table if not exists "public"."people_profile"`)) != 1 {
+		t.Error("expected the profile table to be created")
+	}
+
+	// The columns are profiled by a single scan of the table.
+	upserts := b.executed(`insert into "public"."people_profile"`)
+	if len(upserts) != 1 {
+		t.Fatalf("expected 1 profile upsert, got %d", len(upserts))
+	}
+
+	if n := strings.Count(upserts[0], `from "public"."people"`); n != 1 {
+		t.Errorf("expected 1 scan of the table, got %d", n)
+	}
+
+	if !strings.Contains(upserts[0], `min("active"::text)`) {
+		t.Errorf("expected boolean bounds compared as text, got %s", upserts[0])
+	}
+
+	if len(b.executed(`delete from "public"."people_profile"`)) != 1 {
+		t.Error("expected profiles of dropped columns to be deleted")
+	}
+
+	// Wide tables are profiled in batches within the target list limit.
+	schema := &Schema{}
+	for i := 0; i < 500; i++ {
+		schema.Fields = append(schema.Fields, &Field{Name: fmt.Sprintf("c%d", i), Type: "integer"})
+	}
+
+	if err := New(db).WriteProfile("public", "wide", schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if upserts := b.executed(`insert into "public"."wide_profile"`); len(upserts) != 2 {
+		t.Errorf("expected 2 profile upserts, got %d", len(upserts))
+	}
+}
+
+func TestImportOnExisting(t *testing.T) {
+	// The people table exists.
+	existing := func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		var rows [][]driver.Value
+		if args[1] == "people" {
+			rows = append(rows, []driver.Value{"id"})
+		}
+		return []string{"column_name"}, rows, nil
+	}
+
+	newRequest := func(policy string) *Request {
+		return &Request{
+			Path:       writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+			Schema:     "public",
+			Delimiter:  ",",
+			Header:     true,
+			OnExisting: policy,
+		}
+	}
+
+	for _, policy := range []string{"", ExistingReplace} {
+		db, b := newFakeDB(t)
+		b.query = existing
+
+		res, err := importDB(db, newRequest(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Rows != 2 || len(b.copied("public", "people")) != 2 {
+			t.Errorf("%q: expected table to be replaced, got %d rows", policy, res.Rows)
+		}
+	}
+
+	db, b := newFakeDB(t)
+	b.query = existing
+
+	_, err := importDB(db, newRequest(ExistingFail))
+	if !errors.Is(err, ErrTableExists) {
+		t.Errorf("expected table exists error, got %v", err)
+	}
+
+	if copies := b.executed("COPY"); len(copies) != 0 {
+		t.Errorf("expected nothing to be copied, got %v", copies)
+	}
+
+	// Tables that do not exist are loaded.
+	r := newRequest(ExistingFail)
+	r.Table = "visits"
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := b.copied("public", "visits"); len(rows) != 2 {
+		t.Errorf("expected new table to be loaded, got %d rows", len(rows))
+	}
+
+	db, b = newFakeDB(t)
+	b.query = existing
+
+	res, err := importDB(db, newRequest(ExistingSkip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Skipped || res.Rows != 0 {
+		t.Errorf("expected table to be skipped, got %+v", res)
+	}
+
+	if stmts := b.executed(""); len(stmts) != 0 {
+		t.Errorf("expected nothing to be executed, got %v", stmts)
+	}
+
+	if _, err := importDB(db, newRequest("overwrite")); err == nil {
+		t.Error("expected error for unsupported policy")
+	}
+}
+
+func TestImportSingleTransaction(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:              writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:            "public",
+		Delimiter:         ",",
+		Header:            true,
+		SingleTransaction: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.executed("release savepoint")) == 0 {
+		t.Error("expected the steps of the load to run in savepoints")
+	}
+
+	before := b.executed("")
+
+	// Fail the copy of the second row of the reload.
+	var copies int
+	b.execErr = func(query string) error {
+		if strings.HasPrefix(query, "COPY") {
+			if copies++; copies == 2 {
+				return errors.New("copy failed")
+			}
+		}
+		return nil
+	}
+
+	r.Path = writeTempFile(t, "people.csv", "id,name\n3,Bob\n4,Ann\n5,Eve\n")
+
+	if _, err := importDB(db, r); err == nil {
+		t.Fatal("expected load error")
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 2 || rows[0][0] != "1" || rows[1][0] != "2" {
+		t.Errorf("expected the table to be untouched, got %v", rows)
+	}
+
+	if after := b.executed(""); len(after) != len(before) {
+		t.Errorf("expected nothing of the failed load to be committed, got %v", after[len(before):])
+	}
+
+	r.EnumTypes = true
+
+	if _, err := importDB(db, r); err == nil {
+		t.Error("expected error for enum types within a transaction")
+	}
+}
+
+func TestImportTimings(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	start := time.Now()
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elapsed := time.Since(start)
+
+	tm := res.Timings
+
+	for name, d := range map[string]time.Duration{
+		"profile": tm.Profile,
+		"create":  tm.Create,
+		"copy":    tm.Copy,
+		"analyze": tm.Analyze,
+	} {
+		if d <= 0 {
+			t.Errorf("expected %s duration, got %s", name, d)
+		}
+	}
+
+	// The phases do not overlap.
+	if total := tm.Profile + tm.Create + tm.Copy + tm.Analyze; total > elapsed {
+		t.Errorf("expected phases to take at most %s, got %s", elapsed, total)
+	}
+}
+
+func TestImportDelimiterConflicts(t *testing.T) {
+	tests := []struct {
+		delim, header string
+		err           string
+	}{
+		{`"`, "", "delimiter conflicts with the quote character"},
+		{"\n", "", "delimiter conflicts with line endings"},
+		{"\r", "", "delimiter conflicts with line endings"},
+		{",;", "", "delimiter must be a single character"},
+		{",", `"`, "header delimiter conflicts with the quote character"},
+		{",", "||", "header delimiter must be a single character"},
+		{"§", "", "delimiter must be an ASCII character"},
+		{"\xa7", "", "delimiter must be an ASCII character"},
+		{",", "\xc3", "header delimiter must be an ASCII character"},
+	}
+
+	path := writeTempFile(t, "people.csv", "id,name\n1,Joe\n")
+
+	for _, test := range tests {
+		db, b := newFakeDB(t)
+
+		r := &Request{
+			Path:            path,
+			Schema:          "public",
+			Delimiter:       test.delim,
+			HeaderDelimiter: test.header,
+			Header:          true,
+		}
+
+		_, err := importDB(db, r)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q and %q: expected %q error, got %v", test.delim, test.header, test.err, err)
+		}
+
+		if stmts := b.executed(""); len(stmts) != 0 {
+			t.Errorf("%q and %q: expected nothing to be executed, got %v", test.delim, test.header, stmts)
+		}
+	}
+}
+
+func TestImportRecordSeparator(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "notes.csv", "id,note\x001,\"a\nb\"\x002,c\x00"),
+		Schema:          "public",
+		Delimiter:       ",",
+		Header:          true,
+		RecordSeparator: "\x00",
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f := res.Schema.Fields[0]; f.Type != "integer" {
+		t.Errorf("expected integer id, got %s", f.Type)
+	}
+
+	rows := b.copied("public", "notes")
+	if len(rows) != 2 || rows[0][1] != "a\nb" || rows[1][1] != "c" {
+		t.Errorf("expected records split on null bytes, got %q", rows)
+	}
+
+	for _, sep := range []string{",", `"`, "\x1e\x1e"} {
+		r.RecordSeparator = sep
+
+		if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "record separator") {
+			t.Errorf("%q: expected record separator error, got %v", sep, err)
+		}
+	}
+}
+
+func TestImportHeaderDelimiter(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "people.csv", "id|name|age\n1,Joe,30\n2,Sue,40\n"),
+		Schema:          "public",
+		Delimiter:       ",",
+		HeaderDelimiter: "|",
+		Header:          true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Schema.Fields) != 3 || res.Schema.Fields[2].Type != "integer" {
+		t.Fatalf("expected 3 columns, got %+v", res.Schema.Fields)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	if got := fmt.Sprint(rows[1]); got != "[2 Sue 40]" {
+		t.Errorf("expected aligned columns, got %v", rows[1])
+	}
+}
+
+func TestImportNoColumns(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "empty.csv", "\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	_, err := importDB(db, r)
+	if !errors.Is(err, profile.ErrNoColumns) || !strings.Contains(err.Error(), "no columns detected") {
+		t.Errorf("expected no columns error, got %v", err)
+	}
+
+	r.CSV = false
+	r.Path = writeTempFile(t, "empty.ldjson", "{}\n{}\n")
+	r.Table = ""
+
+	if _, err := importDB(db, r); !errors.Is(err, profile.ErrNoColumns) {
+		t.Errorf("expected no columns error for empty objects, got %v", err)
+	}
+
+	if _, ok := b.table("public", "empty"); ok {
+		t.Error("expected no table to be created")
+	}
+}
+
+func TestImportTypeHints(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,zip\n,text\n1,19104\n2,19103\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		TypeHints: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Schema.Fields[0].Type != "integer" || res.Schema.Fields[1].Type != "text" {
+		t.Errorf("expected integer and text columns, got %+v", res.Schema.Fields)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	if got := fmt.Sprint(rows[0]); got != "[1 19104]" {
+		t.Errorf("expected the hints line to be skipped, got %v", rows[0])
+	}
+}
+
+func TestImportSchemaOnly(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:       writeTempFile(t, "events.csv", "id,name,created\nint,,date\n"),
+		Schema:     "public",
+		Delimiter:  ",",
+		Header:     true,
+		TypeHints:  true,
+		SchemaOnly: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 0 {
+		t.Errorf("expected no rows, got %d", res.Rows)
+	}
+
+	stmt, ok := b.table("public", "events")
+	if !ok {
+		t.Fatal("expected the table to be created")
+	}
+
+	if !strings.Contains(stmt, `"id" integer,"name" text,"created" date`) {
+		t.Errorf("expected nullable hinted and text columns, got %s", stmt)
+	}
+
+	if len(b.executed("COPY")) != 0 {
+		t.Error("expected no rows to be copied")
+	}
+
+	// Rows after the header are ignored and columns are text.
+	r.Path = writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n")
+	r.Table = ""
+	r.TypeHints = false
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt, _ := b.table("public", "people"); !strings.Contains(stmt, `"id" text,"name" text`) {
+		t.Errorf("expected text columns, got %s", stmt)
+	}
+
+	if rows := b.copied("public", "people"); len(rows) != 0 {
+		t.Errorf("expected no rows to be loaded, got %d", len(rows))
+	}
+}
+
+func TestImportSnakeCase(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "FirstName,HTTPStatus,userID\nJoe,200,1\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		SnakeCase: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range res.Schema.Fields {
+		names = append(names, f.Name)
+	}
+
+	if exp := "first_name,http_status,user_id"; strings.Join(names, ",") != exp {
+		t.Errorf("expected %s, got %s", exp, strings.Join(names, ","))
+	}
+
+	// Nested JSON keys are converted and matched when loading.
+	r.Path = writeTempFile(t, "people.ldjson", `{"FirstName": "Joe", "HomeAddress": {"ZipCode": "19104"}}`+"\n")
+	r.CSV = false
+
+	if res, err = importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if f := res.Schema.Fields[1]; f.Name != "home_address_zip_code" {
+		t.Errorf("expected home_address_zip_code, got %s", f.Name)
+	}
+
+	rows := b.copied("public", "people")
+	if len(rows) != 1 || rows[0][0] != "Joe" || rows[0][1] != "19104" {
+		t.Errorf("expected values to be loaded, got %v", rows)
+	}
+
+	// Names are only lowercased by default.
+	r.SnakeCase = false
+
+	if res, err = importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if f := res.Schema.Fields[0]; f.Name != "firstname" {
+		t.Errorf("expected firstname, got %s", f.Name)
+	}
+}
+
+func TestImportKeepLineEndings(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "notes.csv", "id,note\n1,\"a\rb\"\n2,c\n"),
+		Schema:          "public",
+		Delimiter:       ",",
+		Header:          true,
+		KeepLineEndings: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected 2 rows, got %d", res.Rows)
+	}
+
+	rows := b.copied("public", "notes")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	if rows[0][1] != "a\rb" {
+		t.Errorf("expected carriage return to be kept, got %q", rows[0][1])
+	}
+}
+
+func TestImportSkipTrailingLines(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:              writeTempFile(t, "visits.csv", "id,score\n1,10\n2,20\n3,30\n4,40\n5,50\nTOTAL,5\n"),
+		Schema:            "public",
+		Delimiter:         ",",
+		Header:            true,
+		SkipTrailingLines: 1,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 5 {
+		t.Errorf("expected 5 rows, got %d", res.Rows)
+	}
+
+	// The trailer does not make the id a text column.
+	if f := res.Schema.Fields[0]; f.Type != "integer" {
+		t.Errorf("expected integer id, got %s", f.Type)
+	}
+
+	for _, row := range b.copied("public", "visits") {
+		if row[0] == "TOTAL" {
+			t.Error("expected trailer to be excluded")
+		}
+	}
+}
+
+func TestImportDirectives(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:       writeTempFile(t, "export.csv", "#schema=sales #table=orders\nid,total\n1,9.5\n2,3\n"),
+		Delimiter:  ",",
+		Header:     true,
+		Directives: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Schema != "sales" || r.Table != "orders" {
+		t.Errorf("expected sales.orders, got %s.%s", r.Schema, r.Table)
+	}
+
+	// The directive line is not the header.
+	if len(res.Schema.Fields) != 2 || res.Schema.Fields[0].Name != "id" {
+		t.Errorf("expected id and total columns, got %v", res.Schema.Fields)
+	}
+
+	if rows := b.copied("sales", "orders"); len(rows) != 2 {
+		t.Errorf("expected 2 rows in sales.orders, got %v", rows)
+	}
+
+	// The table given takes precedence and the schema is the directive's.
+	db, b = newFakeDB(t)
+
+	r = &Request{
+		Path:       writeTempFile(t, "export.csv", "#schema=sales #table=orders\nid,total\n1,9.5\n"),
+		Table:      "returns",
+		Delimiter:  ",",
+		Header:     true,
+		Directives: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := b.copied("sales", "returns"); len(rows) != 1 {
+		t.Errorf("expected 1 row in sales.returns, got %v", rows)
+	}
+
+	// Without a directive line, the file is loaded as usual.
+	db, b = newFakeDB(t)
+
+	r = &Request{
+		Path:       writeTempFile(t, "export.csv", "id,total\n1,9.5\n"),
+		Delimiter:  ",",
+		Header:     true,
+		Directives: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := b.copied("public", "export"); len(rows) != 1 {
+		t.Errorf("expected 1 row in public.export, got %v", rows)
+	}
+}
+
+func TestParseDirective(t *testing.T) {
+	tests := map[string]*directive{
+		"#schema=sales #table=orders\n": {Schema: "sales", Table: "orders"},
+		"#table=orders\r\n":             {Table: "orders"},
+		"  #schema=sales\t#table=x ":    {Schema: "sales", Table: "x"},
+	}
+
+	for line, expected := range tests {
+		d, err := parseDirective(line)
+		if err != nil {
+			t.Errorf("%q: %s", line, err)
+		} else if *d != *expected {
+			t.Errorf("%q: expected %+v, got %+v", line, expected, d)
+		}
+	}
+
+	for _, line := range []string{"#\n", "#id,name\n", "#schema=\n", "#owner=me\n", "#table=orders schema=sales\n"} {
+		if _, err := parseDirective(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestImportFilesUnion(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	a := writeTempFile(t, "visits.csv", "id,score\n1,10\n2,20\n")
+	c := writeTempFile(t, "visits-2.csv", "id,score\n3,1.5\n")
+
+	r := &Request{
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	res, err := importFiles(db, []string{a, c}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 3 {
+		t.Errorf("expected 3 rows, got %d", res.Rows)
+	}
+
+	// The float in the second file generalizes the column.
+	if f := res.Schema.Fields[1]; f.Type != "real" {
+		t.Errorf("expected real score, got %s", f.Type)
+	}
+
+	if rows := b.copied("public", "visits"); len(rows) != 3 {
+		t.Errorf("expected 3 rows in the table, got %d", len(rows))
+	}
+
+	// The files are loaded by a single copy.
+	if copies := b.executed("COPY"); len(copies) != 1 {
+		t.Errorf("expected one copy, got %d", len(copies))
+	}
+}
+
+func TestImportFilesUnionHeaderOnly(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	a := writeTempFile(t, "visits.csv", "id,score,day\n1,10,2014-01-02\n2,20,2014-01-03\n")
+	c := writeTempFile(t, "visits-2.csv", "id,score,day\n")
+
+	r := &Request{
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	res, err := importFiles(db, []string{a, c}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header-only file does not make the columns text.
+	for i, expected := range []string{"integer", "integer", "date"} {
+		if f := res.Schema.Fields[i]; f.Type != expected {
+			t.Errorf("%s: expected %s, got %s", f.Name, expected, f.Type)
+		}
+	}
+
+	if rows := b.copied("public", "visits"); len(rows) != 2 {
+		t.Errorf("expected 2 rows in the table, got %d", len(rows))
+	}
+}
+
+func TestImportFilesUnionValidatePrimaryKey(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	a := writeTempFile(t, "visits.csv", "id,score\n1,10\n2,20\n")
+	c := writeTempFile(t, "visits-2.csv", "id,score\n3,30\n")
+
+	r := &Request{
+		Schema:             "public",
+		Delimiter:          ",",
+		Header:             true,
+		PrimaryKey:         "id",
+		ValidatePrimaryKey: true,
+	}
+
+	_, err := importFiles(db, []string{a, c}, r)
+	if err == nil || !strings.Contains(err.Error(), "cannot be validated across multiple files") {
+		t.Errorf("expected the primary key to not be validated across files, got %v", err)
+	}
+}
+
+func TestImportFilesUnionMismatch(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	a := writeTempFile(t, "visits.csv", "id,score\n1,10\n")
+	c := writeTempFile(t, "visits-2.csv", "id,site\n3,A\n")
+
+	r := &Request{
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	if _, err := importFiles(db, []string{a, c}, r); err == nil {
+		t.Error("expected files with different columns to fail")
+	}
+}
+
+func TestImportFilesPartitioned(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	a := writeTempFile(t, "events_2023_01.csv", "id,kind\n1,open\n2,close\n")
+	c := writeTempFile(t, "events_2023_02.csv", "id,kind\n3,open\n")
+
+	r := &Request{
+		Schema:           "public",
+		Delimiter:        ",",
+		Header:           true,
+		PartitionPattern: `_(\d{4}_\d{2})\.`,
+	}
+
+	res, err := importFiles(db, []string{a, c}, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 3 {
+		t.Errorf("expected 3 rows, got %d", res.Rows)
+	}
+
+	stmt, ok := b.table("public", "events")
+	if !ok || !strings.Contains(stmt, `"_partition" text not null ) partition by list ("_partition")`) {
+		t.Errorf("expected a table partitioned by the file name, got %q", stmt)
+	}
+
+	for _, key := range []string{"2023_01", "2023_02"} {
+		stmt, ok := b.table("public", "events_"+key)
+		if !ok || !strings.Contains(stmt, fmt.Sprintf(`partition of "public"."events" for values in ('%s')`, key)) {
+			t.Errorf("expected partition %s, got %q", key, stmt)
+		}
+	}
+
+	rows := b.copied("public", "events")
+	if len(rows) != 3 || rows[0][2] != "2023_01" || rows[1][2] != "2023_01" || rows[2][2] != "2023_02" {
+		t.Errorf("expected the partition key of each row, got %v", rows)
+	}
+
+	// The partition keys must be distinct.
+	r.Table = ""
+	d := writeTempFile(t, "events_2023_01.csv", "id,kind\n4,open\n")
+
+	if _, err := importFiles(db, []string{a, d}, r); err == nil {
+		t.Error("expected error for files with the same partition")
+	}
+}
+
+func TestImportTar(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	files := []struct {
+		name, contents string
+	}{
+		{"people.csv", "id,name\n1,Joe\n2,Sue\n3,\n"},
+		{"sales/orders.csv", "id,name,total\n1,,9.5\n2,Joe,4\n"},
+		{"README", ""},
+	}
+
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.contents))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.contents))
+	}
+
+	tw.Close()
+	gw.Close()
+
+	rejects := filepath.Join(t.TempDir(), "rejects.csv")
+
+	r := &Request{
+		Path:           writeTempFile(t, "data.tar.gz", buf.String()),
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+		NotNullColumns: []string{"name"},
+		RejectsFile:    rejects,
+	}
+
+	results, err := importTar(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The empty file is skipped.
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	if rows := b.copied("public", "people"); len(rows) != 2 {
+		t.Errorf("expected 2 rows in public.people, got %v", rows)
+	}
+
+	if rows := b.copied("sales", "orders"); len(rows) != 1 || rows[0][2] != "4" {
+		t.Errorf("expected 1 row in sales.orders, got %v", rows)
+	}
+
+	// Each file has its own rejects file.
+	for name, exp := range map[string]string{
+		"rejects.public.people.csv": "3,",
+		"rejects.sales.orders.csv":  "1,,9.5",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(rejects), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], exp) {
+			t.Errorf("expected the rejected row %s in %s, got:\n%s", exp, name, data)
+		}
+	}
+}
+
+func TestImportMaxRows(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n3,Bob\n"),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		MaxRows:   2,
+	}
+
+	_, err := importDB(db, r)
+	if !errors.Is(err, profile.ErrTooManyRecords) {
+		t.Fatalf("expected too many records error, got %v", err)
+	}
+
+	if len(b.executed("create table")) != 0 {
+		t.Error("expected no table to be created")
+	}
+}
+
+// timeoutError is a transient read error, such as of a network read.
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "read timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+// flakySource fails the reads of the first passes after the first line
+// until it has failed the number of failures.
+type flakySource struct {
+	fileSource
+	failures int
+	err      error
+	opens    int
+}
+
+func (s *flakySource) Open() (io.ReadCloser, error) {
+	s.opens++
+
+	r, err := s.fileSource.Open()
+	if err != nil || s.opens > s.failures {
+		return r, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(r, 8), iotest.ErrReader(s.err)), r}, nil
+}
+
+func TestProfileRetry(t *testing.T) {
+	path := writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n")
+
+	r := &Request{
+		Delimiter:         ",",
+		Header:            true,
+		ProfileRetries:    2,
+		ProfileRetryDelay: time.Millisecond,
+	}
+
+	src := &flakySource{fileSource: fileSource{path: path}, failures: 1, err: timeoutError{}}
+
+	prof, err := profileSource(r, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prof.RecordCount != 2 || src.opens != 2 {
+		t.Errorf("expected 2 records in 2 passes, got %d in %d", prof.RecordCount, src.opens)
+	}
+
+	// Retries are exhausted.
+	src = &flakySource{fileSource: fileSource{path: path}, failures: 3, err: timeoutError{}}
+
+	if _, err := profileSource(r, src); !errors.Is(err, timeoutError{}) || src.opens != 3 {
+		t.Errorf("expected the timeout after 3 passes, got %v in %d", err, src.opens)
+	}
+
+	// Other errors are not retried.
+	src = &flakySource{fileSource: fileSource{path: path}, failures: 1, err: errors.New("bad block")}
+
+	if _, err := profileSource(r, src); err == nil || src.opens != 1 {
+		t.Errorf("expected an error after 1 pass, got %v in %d", err, src.opens)
+	}
+}
+
+func TestImportSQLFileGzip(t *testing.T) {
+	path := writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n")
+	sqlPath := filepath.Join(filepath.Dir(path), "people.sql.gz")
+
+	r := &Request{
+		Path:      path,
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+		SQLFile:   sqlPath,
+	}
+
+	if _, err := Import(r); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(sqlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := string(b)
+
+	for _, s := range []string{
+		`create table if not exists "public"."people"`,
+		`copy "public"."people" ("id", "name") from stdin;`,
+		"1\tJoe\n2\tSue\n\\.\n",
+		`analyze "public"."people"`,
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("expected script to contain %q:\n%s", s, script)
+		}
+	}
+}
+
+func TestImportSQLFileGzipLevel(t *testing.T) {
+	var data strings.Builder
+	data.WriteString("id,name\n")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&data, "%d,name %d\n", i, i%10)
+	}
+
+	path := writeTempFile(t, "people.csv", data.String())
+
+	write := func(level int) []byte {
+		sqlPath := filepath.Join(filepath.Dir(path), fmt.Sprintf("people_%d.sql.gz", level))
+
+		r := &Request{
+			Path:                path,
+			Table:               "people",
+			Schema:              "public",
+			Delimiter:           ",",
+			Header:              true,
+			SQLFile:             sqlPath,
+			SQLCompressionLevel: level,
+		}
+
+		if _, err := Import(r); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(sqlPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	}
+
+	fast, best := write(gzip.BestSpeed), write(gzip.BestCompression)
+
+	if len(best) >= len(fast) {
+		t.Errorf("expected level 9 to be smaller than level 1, got %d and %d bytes", len(best), len(fast))
+	}
+
+	for _, b := range [][]byte{fast, best} {
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		script, err := ioutil.ReadAll(gr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(script), "999\tname 9\n\\.\n") {
+			t.Errorf("expected the script to contain the rows:\n%s", script)
+		}
+	}
+
+	r := &Request{
+		Path:                path,
+		Schema:              "public",
+		Delimiter:           ",",
+		Header:              true,
+		SQLFile:             filepath.Join(filepath.Dir(path), "people.sql.gz"),
+		SQLCompressionLevel: 10,
+	}
+
+	if _, err := Import(r); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+}
+
+func TestImportSniffGzip(t *testing.T) {
+	gzipped := func(s string) string {
+		var gz bytes.Buffer
+		gw := gzip.NewWriter(&gz)
+		gw.Write([]byte(s))
+		gw.Close()
+		return gz.String()
+	}
+
+	tests := map[string]struct {
+		data   string
+		format string
+	}{
+		"csv":    {"id,name\n1,Joe\n2,Sue\n", "csv"},
+		"ldjson": {`{"id": 1, "name": "Joe"}` + "\n" + `{"id": 2, "name": "Sue"}` + "\n", "ldjson"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, b := newFakeDB(t)
+
+			r := &Request{
+				Path:      writeTempFile(t, "people.gz", gzipped(test.data)),
+				Schema:    "public",
+				Delimiter: ",",
+				Header:    true,
+			}
+
+			res, err := importDB(db, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.CSV != (test.format == "csv") || r.LDJSON != (test.format == "ldjson") {
+				t.Errorf("expected %s format, got csv %t and ldjson %t", test.format, r.CSV, r.LDJSON)
+			}
+
+			if res.Rows != 2 {
+				t.Errorf("expected 2 rows, got %d", res.Rows)
+			}
+
+			if rows := b.copied("public", "people"); len(rows) != 2 {
+				t.Errorf("expected 2 copied rows, got %d", len(rows))
+			}
+		})
+	}
+}
+
+func TestImportCorruptGzip(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("id,name\n"))
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(gw, "%d,name%d\n", i, i)
+	}
+	gw.Close()
+
+	data := gz.Bytes()
+
+	// Corrupt the trailer.
+	for i := len(data) - 8; i < len(data); i++ {
+		data[i] ^= 0xff
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "data.csv.gz", string(data)),
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	if _, err := importDB(db, r); err == nil {
+		t.Fatal("expected error importing corrupt file")
+	}
+
+	if _, ok := b.table("public", "data"); ok {
+		t.Error("expected no table to be committed")
+	}
+
+	if rows := b.copied("public", "data"); len(rows) != 0 {
+		t.Errorf("expected no rows to be committed, got %d", len(rows))
+	}
+}
+
+func TestReplaceCorruptGzip(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("id,name\n"))
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(gw, "%d,name%d\n", i, i)
+	}
+	gw.Close()
+
+	data := gz.Bytes()
+	data = data[:len(data)-4]
+
+	dr, err := reader.Decompress("gzip", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text"},
+		},
+	}
+
+	if _, err := New(db).Replace("public", "data", schema, csv.NewReader(dr)); err == nil {
+		t.Fatal("expected error loading truncated file")
+	}
+
+	if _, ok := b.table("public", "data"); ok {
+		t.Error("expected no table to be committed")
+	}
+
+	if rows := b.copied("public", "data"); len(rows) != 0 {
+		t.Errorf("expected no rows to be committed, got %d", len(rows))
+	}
+}
+
+func TestImportReader(t *testing.T) {
+	data := "id,name\n1,Joe\n2,Sue\n3,Bob\n"
+
+	tests := map[string]io.Reader{
+		"seekable": strings.NewReader(data),
+		// Hide the Seek method so the stream is spilled.
+		"stream": struct{ io.Reader }{strings.NewReader(data)},
+	}
+
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, b := newFakeDB(t)
+
+			r := &Request{
+				Schema: "public",
+				Table:  "people",
+				Header: true,
+			}
+
+			res, err := ImportReader(db, in, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Rows != 3 {
+				t.Errorf("expected 3 rows, got %d", res.Rows)
+			}
+
+			if f := res.Schema.Fields[0]; f.Type != "integer" {
+				t.Errorf("expected integer id, got %s", f.Type)
+			}
+
+			rows := b.copied("public", "people")
+			if len(rows) != 3 || rows[2][1] != "Bob" {
+				t.Errorf("expected 3 copied rows, got %v", rows)
+			}
+		})
+	}
+}
+
+func TestImportReaderTableRequired(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	r := &Request{
+		Schema: "public",
+		Header: true,
+	}
+
+	// Streams have no file name to name the table after.
+	_, err := ImportReader(db, strings.NewReader("id\n1\n"), r)
+	if err == nil || !strings.Contains(err.Error(), "table name required") {
+		t.Fatalf("expected table name error, got %v", err)
+	}
+
+	if stmts := b.executed(""); len(stmts) != 0 {
+		t.Errorf("expected nothing executed, got %v", stmts)
+	}
+}
+
+func TestImportReaderDirectives(t *testing.T) {
+	tests := map[string]struct {
+		Data   string
+		Stream bool
+		Table  string
+
+		ExpectedSchema string
+		ExpectedTable  string
+	}{
+		"directive":    {Data: "#schema=sales #table=orders\nid,total\n1,9.5\n", ExpectedSchema: "sales", ExpectedTable: "orders"},
+		"stream":       {Data: "#schema=sales #table=orders\nid,total\n1,9.5\n", Stream: true, ExpectedSchema: "sales", ExpectedTable: "orders"},
+		"table only":   {Data: "#table=orders\nid,total\n1,9.5\n", ExpectedSchema: "public", ExpectedTable: "orders"},
+		"no directive": {Data: "id,total\n1,9.5\n", Table: "orders", ExpectedSchema: "public", ExpectedTable: "orders"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, b := newFakeDB(t)
+
+			var in io.Reader = strings.NewReader(test.Data)
+			if test.Stream {
+				// Hide the Seek method so the stream is spilled.
+				in = struct{ io.Reader }{in}
+			}
+
+			r := &Request{
+				Table:      test.Table,
+				Header:     true,
+				Directives: true,
+			}
+
+			if _, err := ImportReader(db, in, r); err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Schema != test.ExpectedSchema || r.Table != test.ExpectedTable {
+				t.Errorf("expected %s.%s, got %s.%s", test.ExpectedSchema, test.ExpectedTable, r.Schema, r.Table)
+			}
+
+			if rows := b.copied(test.ExpectedSchema, test.ExpectedTable); len(rows) != 1 || rows[0][1] != "9.5" {
+				t.Errorf("expected 1 copied row, got %v", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,714 @@
+package sqlimporter
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Integration tests run against the Postgres database referenced by the
+// SQLIMPORTER_TEST_DB environment variable, such as
+// postgres://localhost:5432/postgres?sslmode=disable. They are skipped
+// if it is not set.
+
+// testDB returns a connection to the test database and a schema that is
+// dropped when the test completes.
+func testDB(t *testing.T) (*sql.DB, string) {
+	url := os.Getenv("SQLIMPORTER_TEST_DB")
+	if url == "" {
+		t.Skip("SQLIMPORTER_TEST_DB not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, _ := uuid.NewV4()
+	schema := fmt.Sprintf("sqlimporter_test_%x", uid.Bytes()[:4])
+
+	t.Cleanup(func() {
+		db.Exec(fmt.Sprintf(`drop schema if exists "%s" cascade`, schema))
+		db.Close()
+	})
+
+	return db, schema
+}
+
+func TestIntegrationCreateDatabase(t *testing.T) {
+	db, _ := testDB(t)
+
+	u, err := url.Parse(os.Getenv("SQLIMPORTER_TEST_DB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, _ := uuid.NewV4()
+	name := fmt.Sprintf("sqlimporter_test_%x", uid.Bytes()[:4])
+	u.Path = "/" + name
+
+	t.Cleanup(func() {
+		db.Exec(fmt.Sprintf(`drop database if exists "%s"`, name))
+	})
+
+	r := &Request{
+		Path:           writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Database:       u.String(),
+		CreateDatabase: true,
+		Schema:         "public",
+		Delimiter:      ",",
+		Header:         true,
+	}
+
+	res, err := Import(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected 2 rows, got %d", res.Rows)
+	}
+
+	created, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer created.Close()
+
+	var n int
+	if err := created.QueryRow(`select count(*) from "public"."people"`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("expected 2 rows in the created database, got %d", n)
+	}
+}
+
+func TestIntegrationIdentity(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:           writeTempFile(t, "people.csv", "name\nJoe\nSue\nBob\n"),
+		Schema:         schema,
+		Delimiter:      ",",
+		Header:         true,
+		IdentityColumn: "id",
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`select id, name from "%s"."people" order by id`, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var i int64
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+
+		i++
+		if id != i {
+			t.Errorf("expected id %d, got %d", i, id)
+		}
+	}
+
+	if i != 3 {
+		t.Errorf("expected 3 rows, got %d", i)
+	}
+}
+
+func TestIntegrationPrimaryKey(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:            writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n1,Bob\n"),
+		Schema:          schema,
+		Delimiter:       ",",
+		Header:          true,
+		PrimaryKeyFirst: true,
+	}
+
+	// The duplicate violates the primary key.
+	if _, err := importDB(db, r); err == nil || !strings.Contains(err.Error(), "duplicate key") {
+		t.Errorf("expected unique violation, got %v", err)
+	}
+}
+
+func TestIntegrationSingleTransaction(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:              writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:            schema,
+		Delimiter:         ",",
+		Header:            true,
+		PrimaryKeyFirst:   true,
+		SingleTransaction: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The duplicate fails the reload after the table was created.
+	r.Path = writeTempFile(t, "people.csv", "id,name\n3,Bob\n4,Ann\n3,Eve\n")
+
+	if _, err := importDB(db, r); err == nil {
+		t.Fatal("expected unique violation")
+	}
+
+	var names string
+	if err := db.QueryRow(fmt.Sprintf(`select string_agg(name, ',' order by id) from "%s"."people"`, schema)).Scan(&names); err != nil {
+		t.Fatal(err)
+	}
+
+	if names != "Joe,Sue" {
+		t.Errorf("expected the table to be untouched, got %s", names)
+	}
+
+	// The schema of a failed load is not created.
+	r.Schema = schema + "_new"
+
+	if _, err := importDB(db, r); err == nil {
+		t.Fatal("expected unique violation")
+	}
+
+	var exists bool
+	if err := db.QueryRow(`select exists (select 1 from pg_namespace where nspname = $1)`, r.Schema).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
+		t.Errorf("expected schema %s not to be created", r.Schema)
+	}
+}
+
+func TestIntegrationColumnDefaults(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "orders.csv", "id,status,created\n1,,\n2,paid,2017-03-01\n"),
+		Schema:    schema,
+		Delimiter: ",",
+		Header:    true,
+		ColumnDefaults: map[string]string{
+			"status":  "new",
+			"created": "current_date",
+		},
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		status  string
+		created bool
+	)
+
+	if err := db.QueryRow(fmt.Sprintf(`select status, created = current_date from "%s"."orders" where id = 1`, schema)).Scan(&status, &created); err != nil {
+		t.Fatal(err)
+	}
+
+	if status != "new" || !created {
+		t.Errorf("expected the defaults to apply to the nulls, got %s and %t", status, created)
+	}
+
+	// The default applies to future inserts.
+	if _, err := db.Exec(fmt.Sprintf(`insert into "%s"."orders" (id) values (3)`, schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow(fmt.Sprintf(`select status from "%s"."orders" where id = 3`, schema)).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status != "new" {
+		t.Errorf("expected the default for an insert, got %s", status)
+	}
+}
+
+func TestIntegrationTempTable(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name,age\n1,Joe,30\n2,Sue,40\n"),
+		Schema:    schema,
+		Table:     "people",
+		Delimiter: ",",
+		Header:    true,
+		TempTable: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 2 {
+		t.Errorf("expected 2 rows, got %d", res.Rows)
+	}
+
+	// The load is rolled back, so the table does not exist in whichever
+	// session of the pool runs the query.
+	var name sql.NullString
+	if err := db.QueryRow(`select to_regclass('pg_temp.people')::text`).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+
+	if name.Valid {
+		t.Errorf("expected the temporary table to be discarded, got %s", name.String)
+	}
+}
+
+func TestIntegrationCstoreStripes(t *testing.T) {
+	db, schema := testDB(t)
+
+	var server sql.NullString
+	if err := db.QueryRow(`select srvname::text from pg_foreign_server where srvname = 'cstore_server'`).Scan(&server); err != nil && err != sql.ErrNoRows {
+		t.Fatal(err)
+	}
+	if !server.Valid {
+		t.Skip("cstore_server is not defined")
+	}
+
+	var data strings.Builder
+	data.WriteString("id,name,score,created\n")
+	for i := 1; i <= 50000; i++ {
+		fmt.Fprintf(&data, "%d,name %d,%d.5,2017-03-%02d\n", i, i, i%100, i%28+1)
+	}
+
+	r := &Request{
+		Path:             writeTempFile(t, "events.csv", data.String()),
+		Schema:           schema,
+		Delimiter:        ",",
+		Header:           true,
+		CStore:           true,
+		CStoreStripeRows: 10000,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 50000 {
+		t.Errorf("expected 50000 rows, got %d", res.Rows)
+	}
+
+	var count, sum int64
+	if err := db.QueryRow(fmt.Sprintf(`select count(*), sum(id) from "%s"."events"`, schema)).Scan(&count, &sum); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 50000 || sum != 50000*50001/2 {
+		t.Errorf("expected 50000 rows, got %d with an id sum of %d", count, sum)
+	}
+}
+
+func TestIntegrationProfileTable(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:         writeTempFile(t, "people.csv", "id,name,age\n1,Joe,30\n2,,40\n3,Sue,40\n"),
+		Schema:       schema,
+		Delimiter:    ",",
+		Header:       true,
+		ProfileTable: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reloading without a column replaces the rows and drops its row.
+	r.Path = writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,\n3,Sue\n")
+	r.Table = ""
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`select column_name, type, row_count, null_count, distinct_count, min_value, max_value from "%s"."people_profile" order by position`, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var (
+			name, typ              string
+			count, nulls, distinct int64
+			min, max               sql.NullString
+		)
+
+		if err := rows.Scan(&name, &typ, &count, &nulls, &distinct, &min, &max); err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, fmt.Sprintf("%s %s %d %d %d %s %s", name, typ, count, nulls, distinct, min.String, max.String))
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"id integer 3 0 3 1 3",
+		"name text 3 1 2 Joe Sue",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected profile rows %q, got %q", expected, got)
+	}
+}
+
+func TestIntegrationMatchColumns(t *testing.T) {
+	db, schema := testDB(t)
+
+	for _, stmt := range []string{
+		fmt.Sprintf(`create schema "%s"`, schema),
+		fmt.Sprintf(`create table "%s"."people" (
+			pk serial primary key,
+			id integer,
+			name text,
+			age integer,
+			source text not null default 'import'
+		)`, schema),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &Request{
+		Path:         writeTempFile(t, "people.csv", "id,name,age\n1,Joe,30\n2,Sue,40\n"),
+		Schema:       schema,
+		Delimiter:    ",",
+		Header:       true,
+		MatchColumns: true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`select pk, name, source from "%s"."people" order by id`, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var n int
+	for rows.Next() {
+		var (
+			pk           int
+			name, source string
+		)
+
+		if err := rows.Scan(&pk, &name, &source); err != nil {
+			t.Fatal(err)
+		}
+
+		n++
+		if pk != n || source != "import" {
+			t.Errorf("expected defaults for row %d, got pk %d and source %q", n, pk, source)
+		}
+	}
+
+	if n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+}
+
+func TestIntegrationDiffSchema(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name,age,dob\n1,Joe,30,2001-03-11 10:00:00\n2,Sue,40,1990-01-02 08:30:00\n"),
+		Schema:    schema,
+		Table:     "people",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	// The modified file drops dob, adds email, and has fractional ages.
+	r.Path = writeTempFile(t, "people.csv", "id,name,age,email\n3,Bob,30.5,bob@example.com\n")
+
+	res, err := profileSources(r, &fileSource{path: r.Path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := New(db).DiffSchema(schema, "people", res.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Diff{
+		Added:   []string{"email"},
+		Removed: []string{"dob"},
+		Changed: []TypeChange{
+			{Column: "age", From: "integer", To: "real"},
+		},
+	}
+
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %v, got %v", expected, diff)
+	}
+}
+
+func TestIntegrationVerify(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name,age\n1,Joe,30\n2,Sue,40\n"),
+		Schema:    schema,
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	r.VerifyRows = true
+
+	v, err := verifyDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Match() {
+		t.Errorf("expected the loaded file to match, got %s", v)
+	}
+
+	// A column was added, a type changed, and a row was added.
+	r.Path = writeTempFile(t, "people.csv", "id,name,age,email\n1,Joe,30.5,joe@example.com\n2,Sue,40,\n3,Bob,50,\n")
+
+	if v, err = verifyDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Match() {
+		t.Fatal("expected the changed file not to match")
+	}
+
+	expected := "+email, age: integer -> real, rows: 3 in file, 2 in table"
+	if s := v.String(); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
+
+func TestIntegrationEnumTypes(t *testing.T) {
+	db, schema := testDB(t)
+
+	load := func(statuses ...string) {
+		var data strings.Builder
+		data.WriteString("id,status\n")
+		for i := 0; i < 30; i++ {
+			fmt.Fprintf(&data, "%d,%s\n", i, statuses[i%len(statuses)])
+		}
+
+		r := &Request{
+			Path:      writeTempFile(t, "people.csv", data.String()),
+			Schema:    schema,
+			Delimiter: ",",
+			Header:    true,
+			EnumTypes: true,
+		}
+
+		if _, err := importDB(db, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	labels := func() []string {
+		rows, err := db.Query(`select e.enumlabel from pg_enum e
+			inner join pg_type t on t.oid = e.enumtypid
+			inner join pg_namespace n on n.oid = t.typnamespace
+			where n.nspname = $1 and t.typname = 'people_status'
+			order by e.enumsortorder`, schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		var values []string
+		for rows.Next() {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, v)
+		}
+
+		return values
+	}
+
+	load("active", "inactive")
+
+	var dataType, udtName string
+	if err := db.QueryRow(`select data_type, udt_name from information_schema.columns where table_schema = $1 and table_name = 'people' and column_name = 'status'`, schema).Scan(&dataType, &udtName); err != nil {
+		t.Fatal(err)
+	}
+
+	if dataType != "USER-DEFINED" || udtName != "people_status" {
+		t.Errorf("expected the people_status enum type, got %s %s", dataType, udtName)
+	}
+
+	if values := labels(); !reflect.DeepEqual(values, []string{"active", "inactive"}) {
+		t.Errorf("expected active and inactive, got %v", values)
+	}
+
+	// Reloading adds the new value.
+	load("active", "inactive", "pending")
+
+	if values := labels(); !reflect.DeepEqual(values, []string{"active", "inactive", "pending"}) {
+		t.Errorf("expected pending to be added, got %v", values)
+	}
+
+	var count int
+	if err := db.QueryRow(fmt.Sprintf(`select count(*) from "%s"."people" where status = 'pending'`, schema)).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 10 {
+		t.Errorf("expected 10 pending rows, got %d", count)
+	}
+}
+
+func TestIntegrationJSONArrays(t *testing.T) {
+	db, schema := testDB(t)
+
+	r := &Request{
+		Path:   writeTempFile(t, "posts.ldjson", `{"id": 1, "tags": ["a", "b \"c\""]}`+"\n"),
+		Schema: schema,
+	}
+
+	if _, err := importDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	var tags []string
+	row := db.QueryRow(fmt.Sprintf(`select tags from "%s"."posts"`, schema))
+	if err := row.Scan(pq.Array(&tags)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tags) != 2 || tags[0] != "a" || tags[1] != `b "c"` {
+		t.Errorf("expected tags to round-trip, got %q", tags)
+	}
+}
+
+func TestIntegrationAppendNew(t *testing.T) {
+	db, schema := testDB(t)
+
+	count := func() int {
+		var n int
+		row := db.QueryRow(fmt.Sprintf(`select count(*) from "%s"."people"`, schema))
+		if err := row.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	path := writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n")
+
+	// Loading the same file again adds no rows.
+	for i := 0; i < 2; i++ {
+		r := &Request{
+			Path:      path,
+			Schema:    schema,
+			Delimiter: ",",
+			Header:    true,
+			AppendNew: true,
+		}
+
+		if _, err := importDB(db, r); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := count(); n != 2 {
+			t.Fatalf("load %d: expected 2 rows, got %d", i+1, n)
+		}
+	}
+
+	r := &Request{
+		Path:      writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n3,Bob\n"),
+		Schema:    schema,
+		Delimiter: ",",
+		Header:    true,
+		AppendNew: true,
+	}
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Rows != 1 {
+		t.Errorf("expected 1 new row, got %d", res.Rows)
+	}
+
+	if n := count(); n != 3 {
+		t.Errorf("expected 3 rows, got %d", n)
+	}
+}
+
+func TestIntegrationPartitioned(t *testing.T) {
+	db, schema := testDB(t)
+
+	a := writeTempFile(t, "events_2023_01.csv", "id,kind\n1,open\n2,close\n")
+	c := writeTempFile(t, "events_2023_02.csv", "id,kind\n3,open\n")
+
+	r := &Request{
+		Schema:           schema,
+		Delimiter:        ",",
+		Header:           true,
+		PartitionPattern: `_(\d{4}_\d{2})\.`,
+	}
+
+	// Reloading replaces the table and its partitions.
+	for i := 0; i < 2; i++ {
+		if _, err := importFiles(db, []string{a, c}, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var total, feb int
+	if err := db.QueryRow(fmt.Sprintf(`select count(*) from "%s"."events"`, schema)).Scan(&total); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow(fmt.Sprintf(`select count(*) from "%s"."events_2023_02"`, schema)).Scan(&feb); err != nil {
+		t.Fatal(err)
+	}
+
+	if total != 3 || feb != 1 {
+		t.Errorf("expected 3 rows with 1 in the second partition, got %d and %d", total, feb)
+	}
+}
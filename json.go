@@ -0,0 +1,95 @@
+package sqlimporter
+
+import (
+	"io"
+	"strings"
+
+	"github.com/chop-dbhi/sql-importer/profile"
+	"github.com/chop-dbhi/sql-importer/profile/json"
+)
+
+// jsonRows reads JSON objects as rows of the profiled fields. Nested
+// objects are flattened and absent fields are read as empty values.
+type jsonRows struct {
+	r      *json.Reader
+	fields []string
+	arrays []bool
+	sep    string
+	depth  int
+	header bool
+
+	// Converts keys to the profiled field names.
+	name func(string) string
+}
+
+func newJSONRows(in io.Reader, format, sep string, depth int, name func(string) string, p *profile.Profile, s *Schema) (*jsonRows, error) {
+	r, err := json.NewReader(in, format)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(p.Fields))
+	arrays := make([]bool, len(p.Fields))
+
+	for n, f := range p.Fields {
+		fields[f.Index] = n
+		arrays[f.Index] = strings.HasSuffix(s.Fields[f.Index].Type, "[]")
+	}
+
+	return &jsonRows{
+		r:      r,
+		fields: fields,
+		arrays: arrays,
+		sep:    sep,
+		depth:  depth,
+		name:   name,
+	}, nil
+}
+
+// Read returns the field names followed by the values of each object.
+func (j *jsonRows) Read() ([]string, error) {
+	if !j.header {
+		j.header = true
+		return j.fields, nil
+	}
+
+	m, err := j.r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	flat := json.FlattenNames(m, j.sep, j.depth, j.name)
+
+	row := make([]string, len(j.fields))
+	for i, n := range j.fields {
+		v := flat[n]
+
+		if a, ok := v.([]interface{}); ok && j.arrays[i] {
+			row[i] = arrayLiteral(a)
+		} else {
+			row[i] = json.FormatValue(v)
+		}
+	}
+
+	return row, nil
+}
+
+var arrayEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// arrayLiteral encodes the scalar values as a Postgres array literal.
+func arrayLiteral(a []interface{}) string {
+	elems := make([]string, len(a))
+
+	for i, v := range a {
+		switch x := v.(type) {
+		case nil:
+			elems[i] = "NULL"
+		case string:
+			elems[i] = `"` + arrayEscaper.Replace(x) + `"`
+		default:
+			elems[i] = json.FormatValue(x)
+		}
+	}
+
+	return "{" + strings.Join(elems, ",") + "}"
+}
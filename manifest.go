@@ -0,0 +1,80 @@
+package sqlimporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ManifestName is the name of the manifest file read from a directory.
+const ManifestName = ".importrc"
+
+// Manifest sets the CSV dialect and type overrides of the files in a
+// directory, overriding the options given for the whole load. It is
+// stored as JSON, for example:
+//
+//	{
+//	  "delimiter": "|",
+//	  "header": false,
+//	  "null": ["\\N"],
+//	  "coerce": {"age": "integer"},
+//	  "text": ["zip"]
+//	}
+type Manifest struct {
+	Delimiter   string            `json:"delimiter"`
+	Header      *bool             `json:"header"`
+	NullTokens  []string          `json:"null"`
+	Coerce      map[string]string `json:"coerce"`
+	TextColumns []string          `json:"text"`
+}
+
+// LoadManifest reads the manifest in the directory. A nil manifest is
+// returned if the directory does not have one.
+func LoadManifest(dir string) (*Manifest, error) {
+	path := filepath.Join(dir, ManifestName)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest: %s", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("cannot decode manifest %s: %s", path, err)
+	}
+
+	return &m, nil
+}
+
+// Apply sets the options of the manifest on the request. Options not set
+// in the manifest are left as is.
+func (m *Manifest) Apply(r *Request) {
+	if m == nil {
+		return
+	}
+
+	if m.Delimiter != "" {
+		r.Delimiter = m.Delimiter
+	}
+
+	if m.Header != nil {
+		r.Header = *m.Header
+	}
+
+	if m.NullTokens != nil {
+		r.NullTokens = m.NullTokens
+	}
+
+	if m.Coerce != nil {
+		r.Coerce = m.Coerce
+	}
+
+	if m.TextColumns != nil {
+		r.TextColumns = m.TextColumns
+	}
+}
@@ -0,0 +1,64 @@
+package sqlimporter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestDelimiter(t *testing.T) {
+	path := writeTempFile(t, "people.csv", "name|age\nJoe|30\nSue|41\n")
+	dir := filepath.Dir(path)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestName), []byte(`{"delimiter": "|"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Request{
+		Path:      path,
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	m.Apply(r)
+
+	db, b := newFakeDB(t)
+
+	res, err := importDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Schema.Fields) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(res.Schema.Fields))
+	}
+
+	if rows := b.copied("public", "people"); len(rows) != 2 {
+		t.Errorf("expected 2 rows, got %d", len(rows))
+	}
+}
+
+func TestManifestMissing(t *testing.T) {
+	m, err := LoadManifest(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m != nil {
+		t.Error("expected no manifest")
+	}
+
+	// Applying a missing manifest leaves the request as is.
+	r := &Request{Delimiter: ","}
+	m.Apply(r)
+
+	if r.Delimiter != "," {
+		t.Errorf("expected delimiter to be unchanged, got %q", r.Delimiter)
+	}
+}
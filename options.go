@@ -0,0 +1,166 @@
+package sqlimporter
+
+// Option sets a field of a request.
+type Option func(*Request)
+
+// NewRequest returns a request for the path with the options applied. The
+// input is read from stdin if the path is empty. Unlike the zero Request,
+// the defaults match the command: the public schema and a comma-delimited
+// file with a header.
+func NewRequest(path string, opts ...Option) *Request {
+	r := &Request{
+		Path:      path,
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithDatabase sets the URL of the target database.
+func WithDatabase(url string) Option {
+	return func(r *Request) {
+		r.Database = url
+	}
+}
+
+// WithTable sets the target schema and table. The table name defaults to
+// the name of the file if empty.
+func WithTable(schema, table string) Option {
+	return func(r *Request) {
+		r.Schema = schema
+		r.Table = table
+	}
+}
+
+// WithDelimiter sets the CSV delimiter.
+func WithDelimiter(delim string) Option {
+	return func(r *Request) {
+		r.Delimiter = delim
+	}
+}
+
+// WithHeader sets whether the CSV file has a header.
+func WithHeader(header bool) Option {
+	return func(r *Request) {
+		r.Header = header
+	}
+}
+
+// WithCompression sets the compression of the input if it cannot be
+// detected from the file name.
+func WithCompression(compression string) Option {
+	return func(r *Request) {
+		r.Compression = compression
+	}
+}
+
+// WithAppend appends to the table rather than replacing it.
+func WithAppend() Option {
+	return func(r *Request) {
+		r.AppendTable = true
+	}
+}
+
+// WithAppendNew appends only the rows whose row hash is not in the table.
+func WithAppendNew() Option {
+	return func(r *Request) {
+		r.AppendNew = true
+	}
+}
+
+// WithUnlogged creates the table without write-ahead logging.
+func WithUnlogged() Option {
+	return func(r *Request) {
+		r.Unlogged = true
+	}
+}
+
+// WithIdentity adds an auto-incrementing primary key column.
+func WithIdentity(column string) Option {
+	return func(r *Request) {
+		r.IdentityColumn = column
+	}
+}
+
+// WithPrimaryKey makes the column the primary key.
+func WithPrimaryKey(column string) Option {
+	return func(r *Request) {
+		r.PrimaryKey = column
+	}
+}
+
+// WithRowHash adds a row hash column.
+func WithRowHash(h RowHash) Option {
+	return func(r *Request) {
+		r.RowHash = &h
+	}
+}
+
+// WithNullTokens sets the values loaded as nulls in addition to empty
+// strings.
+func WithNullTokens(tokens ...string) Option {
+	return func(r *Request) {
+		r.NullTokens = tokens
+	}
+}
+
+// WithTextColumns sets the glob patterns of columns typed as text.
+func WithTextColumns(patterns ...string) Option {
+	return func(r *Request) {
+		r.TextColumns = patterns
+	}
+}
+
+// WithCoerce coerces the column to the type. It may be given more than
+// once.
+func WithCoerce(column, typ string) Option {
+	return func(r *Request) {
+		if r.Coerce == nil {
+			r.Coerce = make(map[string]string)
+		}
+		r.Coerce[column] = typ
+	}
+}
+
+// WithRename renames the column. It may be given more than once.
+func WithRename(from, to string) Option {
+	return func(r *Request) {
+		if r.RenameColumns == nil {
+			r.RenameColumns = make(map[string]string)
+		}
+		r.RenameColumns[from] = to
+	}
+}
+
+// WithColumnMapping loads the source column into the target column. It
+// may be given more than once, the columns being loaded in the order
+// given and the others skipped.
+func WithColumnMapping(source, target string) Option {
+	return func(r *Request) {
+		r.ColumnMap = append(r.ColumnMap, ColumnMapping{Source: source, Target: target})
+	}
+}
+
+// WithLimits aborts the import of inputs with more rows, columns, or
+// distinct values of a column. Zero is unlimited.
+func WithLimits(rows int64, columns, values int) Option {
+	return func(r *Request) {
+		r.MaxRows = rows
+		r.MaxColumns = columns
+		r.MaxDistinctValues = values
+	}
+}
+
+// WithSQLFile writes a SQL script to the path instead of loading into the
+// database.
+func WithSQLFile(path string) Option {
+	return func(r *Request) {
+		r.SQLFile = path
+	}
+}
@@ -0,0 +1,75 @@
+package sqlimporter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewRequest(t *testing.T) {
+	r := NewRequest("people.csv")
+
+	exp := &Request{
+		Path:      "people.csv",
+		Schema:    "public",
+		Delimiter: ",",
+		Header:    true,
+	}
+
+	if !reflect.DeepEqual(r, exp) {
+		t.Errorf("expected defaults %+v, got %+v", exp, r)
+	}
+
+	r = NewRequest("people.csv",
+		WithDatabase("postgres://localhost/test"),
+		WithTable("staging", "people"),
+		WithDelimiter("|"),
+		WithHeader(false),
+		WithCompression("gzip"),
+		WithAppend(),
+		WithUnlogged(),
+		WithPrimaryKey("id"),
+		WithRowHash(RowHash{Algorithm: "md5"}),
+		WithNullTokens(`\N`),
+		WithTextColumns("zip", "*_code"),
+		WithCoerce("age", "integer"),
+		WithCoerce("dob", "date"),
+		WithRename("Pt ID", "patient_id"),
+		WithLimits(100, 10, 50),
+		WithSQLFile("people.sql"),
+	)
+
+	exp = &Request{
+		Path:        "people.csv",
+		Database:    "postgres://localhost/test",
+		Schema:      "staging",
+		Table:       "people",
+		Delimiter:   "|",
+		Header:      false,
+		Compression: "gzip",
+		AppendTable: true,
+		Unlogged:    true,
+		PrimaryKey:  "id",
+		RowHash:     &RowHash{Algorithm: "md5"},
+		NullTokens:  []string{`\N`},
+		TextColumns: []string{"zip", "*_code"},
+		Coerce:      map[string]string{"age": "integer", "dob": "date"},
+
+		RenameColumns: map[string]string{"Pt ID": "patient_id"},
+
+		MaxRows:           100,
+		MaxColumns:        10,
+		MaxDistinctValues: 50,
+
+		SQLFile: "people.sql",
+	}
+
+	if !reflect.DeepEqual(r, exp) {
+		t.Errorf("expected %+v, got %+v", exp, r)
+	}
+
+	r = NewRequest("", WithAppendNew(), WithIdentity("row_id"))
+
+	if !r.AppendNew || r.IdentityColumn != "row_id" || r.Path != "" {
+		t.Errorf("expected append new with identity, got %+v", r)
+	}
+}
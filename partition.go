@@ -0,0 +1,209 @@
+package sqlimporter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PartitionColumn is the column of a table partitioned by file name that
+// holds the partition key of each row.
+const PartitionColumn = "_partition"
+
+// partitionTableName returns the name of the partition of the table for
+// the key.
+func partitionTableName(tableName, key string) string {
+	return tableName + "_" + CleanIdentifier(key)
+}
+
+// ReplacePartitioned loads the data into a new table partitioned by list
+// on the PartitionColumn, with one partition per key, which replaces the
+// existing one. The last field of the schema must be the PartitionColumn.
+// The tables are dropped, created, and loaded within a single transaction
+// since the partitions cannot be renamed with the table. Unique
+// constraints are not created since they would have to include the key.
+// Cstore and unlogged tables, primary keys, and identity columns are not
+// supported.
+func (c *Client) ReplacePartitioned(schemaName, tableName string, tableSchema *Schema, keys []string, cr RowReader) (int64, error) {
+	return c.replacePartitionedTx(schemaName, tableName, tableSchema.copy(), keys, cr)
+}
+
+// replacePartitionedTx runs replacePartitioned in a transaction unless the
+// client is bound to one.
+func (c *Client) replacePartitionedTx(schemaName, tableName string, tableSchema *Schema, keys []string, cr RowReader) (int64, error) {
+	if c.tx != nil {
+		return c.replacePartitioned(schemaName, tableName, tableSchema, keys, cr)
+	}
+
+	tx, err := c.beginTx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	txc := c.inTx(tx)
+	defer c.addTimings(txc)
+
+	n, err := txc.replacePartitioned(schemaName, tableName, tableSchema, keys, cr)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
+
+func (c *Client) replacePartitioned(schemaName, tableName string, tableSchema *Schema, keys []string, cr RowReader) (int64, error) {
+	switch {
+	case tableSchema.Cstore:
+		return 0, errors.New("partitioned tables are not supported with cstore tables")
+	case tableSchema.Identity != "":
+		return 0, errors.New("identity columns are not supported with partitioned tables")
+	case tableSchema.Unlogged:
+		return 0, errors.New("unlogged tables are not supported with partitioned tables")
+	case len(keys) == 0:
+		return 0, errors.New("no partitions to create")
+	}
+
+	if n := len(tableSchema.Fields); n == 0 || tableSchema.Fields[n-1].Name != PartitionColumn {
+		return 0, fmt.Errorf("last column must be the partition column %s", PartitionColumn)
+	}
+
+	for _, f := range tableSchema.Fields {
+		if f.PrimaryKey {
+			return 0, errors.New("primary keys are not supported with partitioned tables")
+		}
+	}
+
+	if skip, err := c.skipExisting(schemaName, tableName); skip || err != nil {
+		return 0, err
+	}
+
+	if err := c.createSchema(schemaName); err != nil {
+		return 0, err
+	}
+
+	if err := c.createEnumTypes(schemaName, tableName, tableSchema); err != nil {
+		return 0, err
+	}
+
+	c.dropView(schemaName, tableName)
+	c.dropTable(schemaName, tableName)
+
+	columns, err := c.createPartitionedTable(schemaName, tableName, tableSchema, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	splits := [][]string{columns}
+
+	n, err := c.copyData(schemaName, tableName, tableSchema, splits, cr)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.fillDefaults(schemaName, tableName, tableSchema, splits); err != nil {
+		return 0, err
+	}
+
+	return n, c.analyzeTable(schemaName, tableName, splits)
+}
+
+// createPartitionedTable creates the parent table and its partitions and
+// returns the columns of the parent.
+func (c *Client) createPartitionedTable(schemaName, tableName string, tableSchema *Schema, keys []string) ([]string, error) {
+	defer c.timed(&c.timings.Create, time.Now())
+
+	if _, err := newRowHasher(tableSchema); err != nil {
+		return nil, err
+	}
+
+	// Unique constraints would have to include the partition key. They
+	// are dropped from a copy so the schema can be loaded into other
+	// tables.
+	parent := tableSchema.copy()
+	for _, f := range parent.Fields {
+		f.Unique = false
+	}
+
+	columns, columnSchemas := columnDefinitions(parent, c.IndexTablespace, c.quote)
+
+	if len(columns) > pgMaxColumns {
+		return nil, fmt.Errorf("partitioned tables do not support more than %d columns", pgMaxColumns)
+	}
+
+	names := make(map[string]string, len(keys))
+
+	for _, key := range keys {
+		name := partitionTableName(tableName, key)
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("partitions %q and %q have the same table name: %s", other, key, name)
+		}
+		names[name] = key
+	}
+
+	err := c.execTx(func(tx txn) error {
+		data := &tableData{
+			Schema:      schemaName,
+			Table:       tableName,
+			Columns:     strings.Join(columnSchemas, ","),
+			PartitionBy: c.quote(PartitionColumn),
+			Tablespace:  c.Tablespace,
+		}
+
+		if err := c.execTmpl(tx, "createTable", data, "error creating table"); err != nil {
+			return err
+		}
+
+		if err := c.setOwner(tx, "tableOwner", data); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			part := &tableData{
+				Schema: schemaName,
+				Table:  partitionTableName(tableName, key),
+				Parent: tableName,
+				Values: pq.QuoteLiteral(key),
+
+				Tablespace: c.Tablespace,
+			}
+
+			if err := c.execTmpl(tx, "createPartition", part, "error creating partition"); err != nil {
+				return err
+			}
+
+			if err := c.setOwner(tx, "tableOwner", part); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	tableSchema.Partitions = [][]string{columns}
+
+	return columns, nil
+}
+
+// execTmpl executes the statement of the template within the transaction.
+func (c *Client) execTmpl(tx txn, tmplName string, data *tableData, msg string) error {
+	var b bytes.Buffer
+	if err := executeTmpl(&b, tmplName, data, c.Quoting); err != nil {
+		return err
+	}
+
+	sql := b.String()
+	if _, err := tx.Exec(sql); err != nil {
+		return fmt.Errorf("%s: %w\n%s", msg, err, sql)
+	}
+
+	return nil
+}
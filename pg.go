@@ -3,13 +3,17 @@ package sqlimporter
 import (
 	"bytes"
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/chop-dbhi/sql-importer/profile"
 	"github.com/lib/pq"
@@ -21,6 +25,16 @@ const (
 
 	// Maximum number of entries in a "target list" (e.g. column list).
 	pgMaxTargetListSize = 1664
+
+	// Maximum number of columns allowed per table.
+	pgMaxColumns = 1600
+
+	// Layouts of dates and datetimes loaded into Postgres.
+	isoDate     = "2006-01-02"
+	isoDateTime = "2006-01-02 15:04:05.999999"
+
+	// SQL state of the too_many_columns error.
+	pgTooManyColumns = "54011"
 )
 
 var (
@@ -30,14 +44,25 @@ var (
 	sqlTmpl = template.New("sql")
 
 	queryTmpls = map[string]string{
-		"createSchema":      `create schema if not exists "{{.Schema}}"`,
-		"createTable":       `create table if not exists "{{.Schema}}"."{{.Table}}" ( {{.Columns}} )`,
-		"createView":        `create or replace view "{{.Schema}}"."{{.View}}" as select {{.Columns}} from "{{.Schema}}"."{{.Table}}" {{.Joins}}`,
-		"createCstoreTable": `create foreign table if not exists "{{.Schema}}"."{{.Table}}" ( {{.Columns}} ) server cstore_server options (compression 'pglz')`,
-		"dropTable":         `drop table if exists "{{.Schema}}"."{{.Table}}"`,
-		"dropView":          `drop view if exists "{{.Schema}}"."{{.View}}"`,
-		"renameTable":       `alter table "{{.Schema}}"."{{.TempTable}}" rename to "{{.Table}}"`,
-		"analyzeTable":      `analyze "{{.Schema}}"."{{.Table}}"`,
+		"createSchema":      `create schema if not exists {{.Ident .Schema}}`,
+		"createTable":       `create {{if .Temporary}}temporary {{else if .Unlogged}}unlogged {{end}}table if not exists {{.Ident .Schema}}.{{.Ident .Table}} ( {{.Columns}} ){{if .PartitionBy}} partition by list ({{.PartitionBy}}){{end}}{{if .Tablespace}} tablespace {{.Ident .Tablespace}}{{end}}`,
+		"createPartition":   `create {{if .Unlogged}}unlogged {{end}}table {{.Ident .Schema}}.{{.Ident .Table}} partition of {{.Ident .Schema}}.{{.Ident .Parent}} for values in ({{.Values}}){{if .Tablespace}} tablespace {{.Ident .Tablespace}}{{end}}`,
+		"createView":        `create or replace view {{.Ident .Schema}}.{{.Ident .View}} as select {{.Columns}} from {{.Ident .Schema}}.{{.Ident .Table}} {{.Joins}}`,
+		"createCstoreTable": `create foreign table if not exists {{.Ident .Schema}}.{{.Ident .Table}} ( {{.Columns}} ) server cstore_server options (compression 'pglz'{{if .StripeRows}}, stripe_row_count '{{.StripeRows}}'{{end}})`,
+		"dropTable":         `drop table if exists {{.Ident .Schema}}.{{.Ident .Table}}`,
+		"dropView":          `drop view if exists {{.Ident .Schema}}.{{.Ident .View}}`,
+		"renameTable":       `alter table {{.Ident .Schema}}.{{.Ident .TempTable}} rename to {{.Ident .Table}}`,
+		"analyzeTable":      `analyze {{if .Verbose}}verbose {{end}}{{.Ident .Schema}}.{{.Ident .Table}}`,
+		"statisticsTarget":  `set local default_statistics_target = {{.Target}}`,
+		"schemaOwner":       `alter schema {{.Ident .Schema}} owner to {{.Owner}}`,
+		"createSchemaOwned": `do $$ begin if not exists (select 1 from pg_namespace where nspname = {{.Values}}) then create schema {{.Ident .Schema}} authorization {{.Owner}}; end if; end $$`,
+		"tableOwner":        `alter {{if .Cstore}}foreign {{end}}table {{.Ident .Schema}}.{{.Ident .Table}} owner to {{.Owner}}`,
+		"viewOwner":         `alter view {{.Ident .Schema}}.{{.Ident .View}} owner to {{.Owner}}`,
+		"typeOwner":         `alter type {{.Ident .Schema}}.{{.Ident .Type}} owner to {{.Owner}}`,
+		"createEnumType":    `do $$ begin create type {{.Ident .Schema}}.{{.Ident .Type}} as enum ({{.Values}}); exception when duplicate_object then null; end $$`,
+		"addEnumValue":      `alter type {{.Ident .Schema}}.{{.Ident .Type}} add value if not exists {{.Values}}`,
+		"fillDefaults":      `update {{.Ident .Schema}}.{{.Ident .Table}} set {{.Columns}} where {{.Filter}}`,
+		"insertNew":         `insert into {{.Ident .Schema}}.{{.Ident .Table}} ({{.Columns}}) select {{.Columns}} from {{.Ident .Schema}}.{{.Ident .TempTable}} t where not exists (select 1 from {{.Ident .Schema}}.{{.Ident .Table}} x where x.{{.Hash}} = t.{{.Hash}})`,
 	}
 
 	// Map of profile types to SQL types.
@@ -50,6 +75,7 @@ var (
 		profile.DateType:     "date",
 		profile.DateTimeType: "timestamp",
 		profile.NullType:     "text",
+		profile.ObjectType:   "jsonb",
 	}
 )
 
@@ -107,21 +133,235 @@ func splitColumns(columns []string, n int) [][]string {
 	return colparts
 }
 
+const (
+	// FloatAuto uses double precision if a float field has more significant
+	// digits than real can represent and real otherwise.
+	FloatAuto   = "auto"
+	FloatReal   = "real"
+	FloatDouble = "double precision"
+
+	// Significant decimal digits guaranteed by the real type.
+	realPrecision = 6
+
+	// BigInt is the type of integer columns with values of more digits
+	// than intPrecision, the most that always fit in an integer.
+	BigInt       = "bigint"
+	intPrecision = 9
+)
+
 type Schema struct {
 	Cstore bool
 	Fields []*Field
+
+	// StripeRows is the number of rows of each stripe of a cstore table,
+	// which are inserted in batches of that size. It defaults to
+	// CStoreStripeRows.
+	StripeRows int
+
+	// Unlogged tables are not written to the write-ahead log, which makes
+	// loading faster. They are truncated after a crash and are not
+	// replicated, so are only suitable for data that can be reloaded.
+	Unlogged bool
+
+	// Identity is the name of an auto-incrementing primary key column
+	// prepended to the table. It is not loaded from the source.
+	Identity string
+
+	// RowHash adds a column containing a hash of the values of each row
+	// after the source columns if set.
+	RowHash *RowHash
+
+	// Partitions are the column names of each table the schema was split
+	// into when created. It is set by CreateTable and used by Load.
+	Partitions [][]string
+}
+
+// copy returns a copy of the schema and its fields, which loads change.
+func (s *Schema) copy() *Schema {
+	cp := *s
+	cp.Fields = make([]*Field, len(s.Fields))
+	for i, f := range s.Fields {
+		fc := *f
+		cp.Fields[i] = &fc
+	}
+	cp.Partitions = append([][]string(nil), s.Partitions...)
+	return &cp
+}
+
+// SchemaConfig controls how profiled fields are mapped to SQL types.
+type SchemaConfig struct {
+	// FloatType is the type used for float fields. It defaults to real.
+	FloatType string
+
+	// Coerce maps field names to the type they are coerced to regardless
+	// of the inferred type.
+	Coerce map[string]profile.ValueType
+
+	// TextPatterns are glob patterns, such as *_code, matched against
+	// field names. Matching fields are typed as text regardless of the
+	// inferred type.
+	TextPatterns []string
+
+	// PreserveEmpty are glob patterns of text columns whose empty strings
+	// are loaded as is. Empty strings are loaded as nulls otherwise.
+	PreserveEmpty []string
+
+	// NormalizeSpace are glob patterns of text columns whose values have
+	// runs of whitespace collapsed to single spaces and are trimmed. The
+	// columns are nullable unless empty strings are preserved.
+	NormalizeSpace []string
+
+	// NotNull and Nullable are field names whose nullability is forced
+	// regardless of whether nulls were observed.
+	NotNull  []string
+	Nullable []string
+
+	// EnumTypes makes text fields with the enum values of the profile
+	// enum types, if they have at most MaxEnumValues values.
+	EnumTypes     bool
+	MaxEnumValues int
+
+	// Defaults maps field names to the SQL expressions of the defaults
+	// of their columns, as returned by DefaultExpr.
+	Defaults map[string]string
+
+	// SQLTypes maps custom profile types, such as those of a
+	// profile.Detector, to the SQL types of their columns, such as
+	// char(7). Columns of custom types are text otherwise.
+	SQLTypes map[profile.ValueType]string
+}
+
+// defaultFunctions are the defaults that are expressions rather than
+// literals.
+var defaultFunctions = map[string]bool{
+	"now()":             true,
+	"current_date":      true,
+	"current_time":      true,
+	"current_timestamp": true,
+	"localtime":         true,
+	"localtimestamp":    true,
+	"gen_random_uuid()": true,
+}
+
+// DefaultExpr returns the SQL expression of a column default. Functions
+// such as now() and current_date are used as is and any other value is
+// quoted as a literal, so it cannot inject SQL. Single quotes around the
+// value, as in 'new', are optional.
+func DefaultExpr(v string) string {
+	if fn := strings.ToLower(strings.TrimSpace(v)); defaultFunctions[fn] {
+		return fn
+	}
+
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		v = strings.ReplaceAll(v[1:len(v)-1], "''", "'")
+	}
+
+	return pq.QuoteLiteral(v)
+}
+
+// containsName returns true if the names contain the name, ignoring case.
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.ToLower(n) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAny returns true if the name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+
+	return false
 }
 
 func NewSchema(p *profile.Profile) *Schema {
+	return NewSchemaWithConfig(p, nil)
+}
+
+func NewSchemaWithConfig(p *profile.Profile, c *SchemaConfig) *Schema {
+	if c == nil {
+		c = &SchemaConfig{}
+	}
+
 	fields := make([]*Field, len(p.Fields))
 
+	// Empty strings are loaded as nulls, so missing implies nullable.
 	for n, f := range p.Fields {
-		fields[f.Index] = &Field{
+		field := &Field{
 			Name:     n,
-			Type:     sqlTypeMap[f.Type],
+			Type:     c.sqlType(f),
 			Unique:   f.Unique,
 			Nullable: f.Nullable || f.Missing,
 		}
+
+		if len(f.Layouts) == 1 {
+			field.Layout = f.Layouts[0]
+		}
+
+		// Semantically text, such as codes or identifiers.
+		if matchAny(c.TextPatterns, n) {
+			field.Type = sqlTypeMap[profile.StringType]
+		}
+
+		// Coerced values may be loaded as nulls.
+		if t, ok := c.Coerce[n]; ok && t != f.Type {
+			field.Type = sqlTypeMap[t]
+			field.Coerce = t
+			field.Nullable = true
+			field.Unique = false
+		}
+
+		// Values not matching the type kept by the confidence of the
+		// profiler are loaded as nulls.
+		if f.Nonconforming > 0 && field.Coerce == profile.UnknownType && field.Type != sqlTypeMap[profile.StringType] {
+			field.Coerce = f.Type
+			field.Nullable = true
+		}
+
+		// Empty strings are only distinct from nulls in text columns.
+		if field.Type == sqlTypeMap[profile.StringType] && matchAny(c.PreserveEmpty, n) {
+			field.PreserveEmpty = true
+			field.Nullable = f.Nullable
+		}
+
+		// Values of only whitespace are empty once normalized, which
+		// were not seen as nulls while profiling. Values unique as
+		// profiled may be the same once normalized.
+		if field.Type == sqlTypeMap[profile.StringType] && matchAny(c.NormalizeSpace, n) {
+			field.NormalizeSpace = true
+			field.Nullable = field.Nullable || !field.PreserveEmpty
+			field.Unique = false
+		}
+
+		if c.EnumTypes && field.Type == sqlTypeMap[profile.StringType] && !field.PreserveEmpty {
+			if len(f.EnumValues) > 0 && len(f.EnumValues) <= c.MaxEnumValues {
+				field.Enum = f.EnumValues
+			}
+
+			// The enum has the values as loaded.
+			if field.NormalizeSpace {
+				field.Enum = normalizeValues(field.Enum)
+			}
+		}
+
+		if expr, ok := c.Defaults[n]; ok {
+			field.Default = expr
+		}
+
+		if containsName(c.NotNull, n) {
+			field.Nullable = false
+		} else if containsName(c.Nullable, n) {
+			field.Nullable = true
+		}
+
+		fields[f.Index] = field
 	}
 
 	return &Schema{
@@ -129,6 +369,91 @@ func NewSchema(p *profile.Profile) *Schema {
 	}
 }
 
+// RenameFields renames fields using the map of original to desired names.
+// The original names are matched case-insensitively and the desired names
+// are cleaned like other names. An error is returned if a renamed field
+// has the same column name as another field.
+func (s *Schema) RenameFields(names map[string]string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	renames := make(map[string]string, len(names))
+	for from, to := range names {
+		renames[strings.ToLower(from)] = to
+	}
+
+	renamed := make(map[string]bool)
+
+	for _, f := range s.Fields {
+		if to, ok := renames[f.Name]; ok {
+			f.Name = to
+			renamed[f.Name] = true
+		}
+	}
+
+	columns := make(map[string]string, len(s.Fields))
+
+	for _, f := range s.Fields {
+		name := CleanIdentifier(f.Name)
+
+		if other, ok := columns[name]; ok && (renamed[f.Name] || renamed[other]) {
+			return fmt.Errorf("renamed column %s collides with %s", f.Name, other)
+		}
+
+		columns[name] = f.Name
+	}
+
+	return nil
+}
+
+func (c *SchemaConfig) sqlType(f *profile.Field) string {
+	// Arrays of scalars are loaded as arrays of the element type, others
+	// as JSON.
+	if f.Type == profile.ArrayType {
+		switch f.ElemType {
+		case profile.ObjectType:
+			return sqlTypeMap[profile.ObjectType]
+		case profile.FloatType, profile.IntType:
+			return c.sqlType(&profile.Field{Type: f.ElemType, Precision: f.Precision}) + "[]"
+		case profile.NullType:
+			return sqlTypeMap[profile.StringType] + "[]"
+		}
+
+		return sqlTypeMap[f.ElemType] + "[]"
+	}
+
+	if f.Type == profile.IntType && f.Precision > intPrecision {
+		return BigInt
+	}
+
+	if f.Type != profile.FloatType {
+		if t, ok := sqlTypeMap[f.Type]; ok {
+			return t
+		}
+
+		if t, ok := c.SQLTypes[f.Type]; ok {
+			return t
+		}
+
+		// Custom types without a SQL type are loaded as text.
+		return sqlTypeMap[profile.StringType]
+	}
+
+	switch c.FloatType {
+	case FloatAuto:
+		if f.Precision > realPrecision {
+			return FloatDouble
+		}
+		return FloatReal
+
+	case FloatReal, FloatDouble:
+		return c.FloatType
+	}
+
+	return sqlTypeMap[f.Type]
+}
+
 // Field is a data definition on a schema.
 type Field struct {
 	Name     string
@@ -136,31 +461,516 @@ type Field struct {
 	Multiple bool
 	Unique   bool
 	Nullable bool
+
+	// Enum are the values of the enum type created for the field by the
+	// client, which replaces the type.
+	Enum []string
+
+	// If set, values that do not match the type are loaded as nulls.
+	// Import counts them in Coerced. The load methods of a Client load a
+	// copy of the schema, so they leave it as is.
+	Coerce  profile.ValueType
+	Coerced int64
+
+	// Layout is the date or datetime layout matched by all values while
+	// profiling. Values are parsed with each known layout if not set.
+	Layout string
+
+	// PreserveEmpty loads empty strings as is rather than as nulls.
+	PreserveEmpty bool
+
+	// NormalizeSpace collapses runs of whitespace in values to single
+	// spaces and trims them, so values of only whitespace are empty.
+	NormalizeSpace bool
+
+	// PrimaryKey makes the column the primary key of the table.
+	PrimaryKey bool
+
+	// Default is the SQL expression of the default of the column. Nulls
+	// loaded into a new table are replaced by the default.
+	Default string
 }
 
 type tableData struct {
-	Schema    string
-	TempTable string
-	Table     string
-	View      string
-	Columns   string
-	Joins     string
+	Schema     string
+	TempTable  string
+	Table      string
+	View       string
+	Columns    string
+	Joins      string
+	Target     int
+	Verbose    bool
+	Unlogged   bool
+	Temporary  bool
+	Cstore     bool
+	StripeRows int
+	Hash       string
+	Owner      string
+	Tablespace string
+
+	// Name and quoted values of an enum type.
+	Type   string
+	Values string
+
+	// Quoted partition key of a partitioned table and the parent table
+	// of a partition, whose bound is in Values.
+	PartitionBy string
+	Parent      string
+
+	// Condition of the rows updated.
+	Filter string
+
+	// quoting is the style the identifiers are quoted in by Ident.
+	quoting string
 }
 
-// TODO: fuzz test this.
-func cleanFieldName(n string) string {
+// Ident returns the quoted identifier for the templates.
+func (d *tableData) Ident(name string) string {
+	return quoteIdent(d.quoting, name)
+}
+
+// executeTmpl executes the template with the identifiers quoted in the
+// style.
+func executeTmpl(w io.Writer, name string, data *tableData, quoting string) error {
+	data.quoting = quoting
+	return sqlTmpl.ExecuteTemplate(w, name, data)
+}
+
+// CleanIdentifier returns the column or table name the name is loaded as,
+// such as for schemas built from a Profile to match the loaded columns.
+// The name is lowercased, each run of characters other than ASCII
+// letters, digits, underscores, hyphens, periods, and plus signs is
+// replaced by an underscore, and then each run of hyphens, periods, and
+// plus signs is too. Other letters, such as accented ones, are replaced
+// as well. Leading digits are kept, since the names are quoted, and only
+// an empty name is cleaned to an empty one. Distinct names may clean to
+// the same one, such as "Visit Date" and "visit_date".
+func CleanIdentifier(n string) string {
 	n = strings.ToLower(n)
 	n = badChars.ReplaceAllString(n, "_")
 	return sepChars.ReplaceAllString(n, "_")
 }
 
+// RowReader reads the rows to load. The first row is the header and is
+// skipped. It is satisfied by *csv.Reader.
+type RowReader interface {
+	Read() ([]string, error)
+}
+
+// rawReader is a RowReader whose rows differ from those of the input,
+// such as with columns dropped. Raw returns the last row as read from the
+// input, which is what is written to the rejects.
+type rawReader interface {
+	RowReader
+	Raw() []string
+}
+
+// rawRow returns the last row read from the reader as read from the input.
+func rawRow(cr RowReader, row []string) []string {
+	if rr, ok := cr.(rawReader); ok {
+		return rr.Raw()
+	}
+
+	return row
+}
+
+// AnalyzeOptions controls the analyze run on a table after it is loaded.
+type AnalyzeOptions struct {
+	// Target overrides default_statistics_target for the analyze. Lower
+	// targets sample fewer rows which is faster for very large tables.
+	Target int
+
+	// Verbose reports the progress of the analyze.
+	Verbose bool
+}
+
+// Client loads data into a Postgres database. A Client is safe for
+// concurrent use by multiple goroutines, such as to load the files of a
+// directory at once through one connection pool. Each load runs in its
+// own transactions and the timings are guarded. Its fields must not be
+// changed while loads run. The load methods load a copy of the schema, so
+// loads run at once may share one. CreateTable is the exception since it
+// sets the partitions and enum types of the schema for Load.
 type Client struct {
+	// NullTokens are values loaded as nulls in addition to empty strings.
+	NullTokens []string
+
+	// NullSentinel is the null marker of the copy statements rather than
+	// \N, the default of the COPY text format. Values equal to it fail the
+	// load since they would be loaded as nulls. It cannot be empty or
+	// contain a backslash, tab, or line ending.
+	NullSentinel string
+
+	// Analyze controls the analyze run after loading.
+	Analyze AnalyzeOptions
+
+	// OnExisting is the policy of Replace if the table exists, one of
+	// ExistingReplace, ExistingFail, or ExistingSkip. The table is
+	// replaced if not set.
+	OnExisting string
+
+	// StatementTimeout aborts statements that take longer, such as a
+	// copy waiting on a locked table. It is set with set local in each
+	// transaction, so it applies to creating, loading, and analyzing
+	// tables. It is rounded up to milliseconds. There is no timeout if
+	// zero.
+	StatementTimeout time.Duration
+
+	// Owner is the role made the owner of the schemas, tables, and views
+	// created by the client rather than the connecting user. Existing
+	// tables that are loaded into are altered too, but existing schemas,
+	// such as public, are not.
+	Owner string
+
+	// Rejects receives the rows with a null in a not null column or a
+	// value not matching the type of its column rather than failing the
+	// load. Values are only checked against the types if it is set,
+	// otherwise Postgres fails the load.
+	Rejects *RejectWriter
+
+	// Quoting is the style of quoting of the identifiers of the
+	// statements, QuoteAlways or QuoteMinimal. Identifiers are always
+	// quoted if not set.
+	Quoting string
+
+	// CheckCount counts the rows of the tables once copied and fails the
+	// load with ErrCountMismatch if they are not the rows read, to catch
+	// rows lost silently. The tables of a split table and its view are
+	// counted. Tables that are appended to are counted before the copy
+	// too, so rows inserted by other sessions meanwhile fail the check.
+	CheckCount bool
+
+	// Tablespace is the tablespace of the created tables and
+	// IndexTablespace that of the indexes of their primary keys and
+	// unique columns. The default tablespace is used if not set.
+	// Neither is supported with cstore tables.
+	Tablespace      string
+	IndexTablespace string
+
 	db *sql.DB
+
+	// tx is the transaction the statements of the client run within,
+	// if bound to one by inTx. A bound client is not safe for concurrent
+	// use since the statements of a transaction cannot be interleaved.
+	tx *sql.Tx
+
+	mu      sync.Mutex
+	timings Timings
 }
 
-// execTx calls a function within a transaction.
-func (c *Client) execTx(fn func(tx *sql.Tx) error) error {
+// Timings are the durations of the phases of an import. Creating includes
+// dropping and renaming tables when replacing them.
+type Timings struct {
+	Profile time.Duration `json:"profile"`
+	Create  time.Duration `json:"create"`
+	Copy    time.Duration `json:"copy"`
+	Analyze time.Duration `json:"analyze"`
+}
+
+// Timings returns the total durations of the phases of the loads by the
+// client. Profiling is not done by the client.
+func (c *Client) Timings() Timings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.timings
+}
+
+// timed adds the duration since start to the phase of the timings.
+func (c *Client) timed(phase *time.Duration, start time.Time) {
+	d := time.Since(start)
+
+	c.mu.Lock()
+	*phase += d
+	c.mu.Unlock()
+}
+
+// value returns the value to load for the field.
+func (c *Client) value(f *Field, v string) interface{} {
+	return fieldValue(f, v, c.NullTokens)
+}
+
+// fieldValue returns the value to load for the field or nil if
+// the value is loaded as a null.
+func fieldValue(f *Field, v string, nullTokens []string) interface{} {
+	if f.NormalizeSpace {
+		v = normalizeSpace(v)
+	}
+
+	if v == "" && f.PreserveEmpty {
+		return v
+	}
+
+	if isNull(v, nullTokens) {
+		return nil
+	}
+
+	// Values that do not conform to the coerced type are loaded as nulls.
+	if f.Coerce != profile.UnknownType && !profile.MatchType(v, f.Coerce) {
+		f.Coerced++
+		return nil
+	}
+
+	switch f.Type {
+	// Booleans such as Y and N are not recognized by Postgres.
+	case sqlTypeMap[profile.BoolType]:
+		if b, ok := profile.ParseBool(v); ok {
+			return strconv.FormatBool(b)
+		}
+
+	// Dates are formatted as ISO since Postgres may interpret layouts
+	// such as 01/02/2014 differently than the profiler.
+	case sqlTypeMap[profile.DateType]:
+		if t, ok := parseTime(f.Layout, v, profile.ParseDate); ok {
+			return t.Format(isoDate)
+		}
+
+	case sqlTypeMap[profile.DateTimeType]:
+		if t, ok := parseTime(f.Layout, v, profile.ParseDateTime); ok {
+			return t.Format(isoDateTime)
+		}
+		if t, ok := profile.ParseDate(v); ok {
+			return t.Format(isoDate)
+		}
+	}
+
+	return v
+}
+
+// normalizeSpace collapses the runs of whitespace of the value to single
+// spaces and trims it.
+func normalizeSpace(v string) string {
+	return strings.Join(strings.Fields(v), " ")
+}
+
+// normalizeValues returns the distinct normalized values, sorted. Values
+// empty once normalized are dropped since they are loaded as nulls.
+func normalizeValues(values []string) []string {
+	seen := make(map[string]bool, len(values))
+
+	var normalized []string
+	for _, v := range values {
+		if v = normalizeSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			normalized = append(normalized, v)
+		}
+	}
+
+	sort.Strings(normalized)
+
+	return normalized
+}
+
+// notNullError reports a null value of a field that is not nullable,
+// such as a field forced to be not null.
+func notNullError(f *Field, row int64) error {
+	return fmt.Errorf("null value in not null column %s at row %d", f.Name, row)
+}
+
+func sentinelError(f *Field, row int64) error {
+	return fmt.Errorf("value of column %s at row %d is the null sentinel", f.Name, row)
+}
+
+// validateNullSentinel checks the sentinel is sent as is in the copy data.
+// Values are escaped by the driver, so a sentinel with characters that are
+// escaped would not match the nulls.
+func validateNullSentinel(s string) error {
+	if s == "" {
+		return errors.New("null sentinel cannot be empty")
+	}
+
+	if strings.ContainsAny(s, "\\\t\n\r") {
+		return fmt.Errorf("null sentinel cannot contain a backslash, tab, or line ending: %q", s)
+	}
+
+	return nil
+}
+
+// copyIn returns the copy statement of the columns of the table, with the
+// null sentinel of the client if set.
+func (c *Client) copyIn(schemaName, tableName string, columns []string) (string, error) {
+	quoted := make([]string, len(columns))
+
+	for i, col := range columns {
+		quoted[i] = c.quote(col)
+	}
+
+	stmt := fmt.Sprintf("COPY %s.%s (%s) FROM STDIN", c.quote(schemaName), c.quote(tableName), strings.Join(quoted, ", "))
+
+	if c.NullSentinel == "" {
+		return stmt, nil
+	}
+
+	if err := validateNullSentinel(c.NullSentinel); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s WITH (NULL %s)", stmt, pq.QuoteLiteral(c.NullSentinel)), nil
+}
+
+// parseTime parses the value with the layout matched while profiling. The
+// parse function is used if there is no layout or it does not match.
+func parseTime(layout, v string, parse func(string) (time.Time, bool)) (time.Time, bool) {
+	if layout != "" {
+		if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+			return t, true
+		}
+	}
+
+	return parse(v)
+}
+
+func isNull(v string, tokens []string) bool {
+	if v == "" {
+		return true
+	}
+
+	for _, t := range tokens {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// txn is a transaction of the client, either a transaction of the
+// database or a savepoint of the transaction the client is bound to.
+type txn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+	Commit() error
+	Rollback() error
+}
+
+// savepointName is the name of the savepoints of a bound client. Names
+// may be reused since savepoints are released or rolled back in the
+// reverse order they were created.
+const savepointName = "sqlimporter"
+
+// savepoint is a transaction nested in the transaction of a bound client.
+// Committing releases the savepoint and rolling back undoes the
+// statements since it was created, leaving the transaction usable.
+type savepoint struct {
+	*sql.Tx
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+
+	s.done = true
+	_, err := s.Tx.Exec("release savepoint " + savepointName)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+
+	s.done = true
+	_, err := s.Tx.Exec("rollback to savepoint " + savepointName)
+	return err
+}
+
+// inTx returns a client with the same options whose statements run within
+// the transaction, so the transaction is committed or rolled back as a
+// whole by the caller. The statement timeout is not set since it applies
+// to the transaction as a whole, which is begun by the caller.
+func (c *Client) inTx(tx *sql.Tx) *Client {
+	return &Client{
+		NullTokens:       c.NullTokens,
+		NullSentinel:     c.NullSentinel,
+		Analyze:          c.Analyze,
+		OnExisting:       c.OnExisting,
+		StatementTimeout: c.StatementTimeout,
+		Owner:            c.Owner,
+		Rejects:          c.Rejects,
+		Quoting:          c.Quoting,
+		CheckCount:       c.CheckCount,
+		Tablespace:       c.Tablespace,
+		IndexTablespace:  c.IndexTablespace,
+
+		db: c.db,
+		tx: tx,
+	}
+}
+
+// quote quotes the identifier in the quoting style of the client.
+func (c *Client) quote(name string) string {
+	return quoteIdent(c.Quoting, name)
+}
+
+// ident returns the name of the object created for the identifier in
+// the quoting style of the client, to look it up in the catalog.
+func (c *Client) ident(name string) string {
+	return identName(c.Quoting, name)
+}
+
+// addTimings adds the timings of the other client to the client.
+func (c *Client) addTimings(other *Client) {
+	t := other.Timings()
+
+	c.mu.Lock()
+	c.timings.Profile += t.Profile
+	c.timings.Create += t.Create
+	c.timings.Copy += t.Copy
+	c.timings.Analyze += t.Analyze
+	c.mu.Unlock()
+}
+
+// query runs the query within the transaction of the client if bound to
+// one, so uncommitted tables are seen.
+func (c *Client) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if c.tx != nil {
+		return c.tx.Query(query, args...)
+	}
+
+	return c.db.Query(query, args...)
+}
+
+// begin starts a transaction with the statement timeout of the client or,
+// if the client is bound to a transaction, a savepoint.
+func (c *Client) begin() (txn, error) {
+	if c.tx != nil {
+		if _, err := c.tx.Exec("savepoint " + savepointName); err != nil {
+			return nil, fmt.Errorf("error creating savepoint: %s", err)
+		}
+
+		return &savepoint{Tx: c.tx}, nil
+	}
+
+	return c.beginTx()
+}
+
+// beginTx starts a transaction of the database with the statement timeout
+// of the client.
+func (c *Client) beginTx() (*sql.Tx, error) {
 	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.StatementTimeout > 0 {
+		// Rounded up since a timeout of 0 is no timeout.
+		ms := (c.StatementTimeout + time.Millisecond - 1) / time.Millisecond
+
+		sql := fmt.Sprintf("set local statement_timeout = %d", ms)
+		if _, err := tx.Exec(sql); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error setting statement timeout: %s", err)
+		}
+	}
+
+	return tx, nil
+}
+
+// execTx calls a function within a transaction.
+func (c *Client) execTx(fn func(tx txn) error) error {
+	tx, err := c.begin()
 	if err != nil {
 		return err
 	}
@@ -173,7 +983,46 @@ func (c *Client) execTx(fn func(tx *sql.Tx) error) error {
 	return tx.Commit()
 }
 
-func (c *Client) Replace(schemaName, tableName string, tableSchema *Schema, cr *csv.Reader) (int64, error) {
+// Policies of Replace if the table exists.
+const (
+	ExistingReplace = "replace"
+	ExistingFail    = "fail-if-exists"
+	ExistingSkip    = "skip-if-exists"
+)
+
+// ErrTableExists is returned by Replace if the table exists and the policy
+// is ExistingFail.
+var ErrTableExists = errors.New("table already exists")
+
+// ValidateOnExisting returns an error if the policy is not supported.
+func ValidateOnExisting(policy string) error {
+	switch policy {
+	case "", ExistingReplace, ExistingFail, ExistingSkip:
+		return nil
+	}
+
+	return fmt.Errorf("existing table policy not supported: %s", policy)
+}
+
+// TableExists returns true if the table or view exists.
+func (c *Client) TableExists(schemaName, tableName string) (bool, error) {
+	columns, err := c.tableColumns(schemaName, tableName)
+	return len(columns) > 0, err
+}
+
+// Replace loads the data into a new table that replaces the existing one.
+// If the table exists and the OnExisting policy is ExistingFail, an error
+// wrapping ErrTableExists is returned. If it is ExistingSkip, nothing is
+// loaded and zero rows are returned.
+func (c *Client) Replace(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return c.replace(schemaName, tableName, tableSchema.copy(), cr)
+}
+
+func (c *Client) replace(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	if skip, err := c.skipExisting(schemaName, tableName); skip || err != nil {
+		return 0, err
+	}
+
 	tempTableNameUid, _ := uuid.NewV4()
 	tempTableName := tempTableNameUid.String()
 	defer c.dropTable(schemaName, tempTableName)
@@ -182,16 +1031,24 @@ func (c *Client) Replace(schemaName, tableName string, tableSchema *Schema, cr *
 		return 0, err
 	}
 
+	if err := c.createEnumTypes(schemaName, tableName, tableSchema); err != nil {
+		return 0, err
+	}
+
 	splits, err := c.createTable(schemaName, tempTableName, tableSchema)
 	if err != nil {
 		return 0, err
 	}
 
-	n, err := c.copyData(schemaName, tempTableName, splits, cr)
+	n, err := c.copyData(schemaName, tempTableName, tableSchema, splits, cr)
 	if err != nil {
 		return 0, err
 	}
 
+	if err := c.fillDefaults(schemaName, tempTableName, tableSchema, splits); err != nil {
+		return 0, err
+	}
+
 	c.dropView(schemaName, tableName)
 	c.dropTable(schemaName, tableName)
 
@@ -199,35 +1056,330 @@ func (c *Client) Replace(schemaName, tableName string, tableSchema *Schema, cr *
 		return n, err
 	}
 
-	// Create a view if necessary and possible.
-	if len(splits) > 1 && len(tableSchema.Fields)+len(splits) <= pgMaxTargetListSize {
-		if err := c.createView(schemaName, tableName, tableName, splits); err != nil {
-			return n, err
-		}
+	if err := c.createPartitionView(schemaName, tableName, tableSchema, splits); err != nil {
+		return n, err
+	}
+
+	if err := c.checkViewCount(schemaName, tableName, tableSchema, splits, n); err != nil {
+		return n, err
 	}
 
 	return n, c.analyzeTable(schemaName, tableName, splits)
 }
 
-func (c *Client) Append(schemaName, tableName string, tableSchema *Schema, cr *csv.Reader) (int64, error) {
-	if err := c.createSchema(schemaName); err != nil {
+// skipExisting returns true if the table exists and is skipped by the
+// OnExisting policy or an error if it exists and the policy fails.
+func (c *Client) skipExisting(schemaName, tableName string) (bool, error) {
+	if err := ValidateOnExisting(c.OnExisting); err != nil {
+		return false, err
+	}
+
+	if c.OnExisting != ExistingFail && c.OnExisting != ExistingSkip {
+		return false, nil
+	}
+
+	exists, err := c.TableExists(schemaName, tableName)
+	if err != nil {
+		return false, err
+	}
+
+	if exists && c.OnExisting == ExistingFail {
+		return false, fmt.Errorf("%w: %s.%s", ErrTableExists, schemaName, tableName)
+	}
+
+	return exists, nil
+}
+
+// ReplaceTx is Replace within the transaction, so a failure leaves nothing
+// behind once it is rolled back and the table is swapped atomically once
+// it is committed, which is left to the caller. Enum types and tables
+// that are partitioned are not supported.
+func (c *Client) ReplaceTx(tx *sql.Tx, schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	txc := c.inTx(tx)
+	defer c.addTimings(txc)
+
+	return txc.replace(schemaName, tableName, tableSchema.copy(), cr)
+}
+
+// tempSchema is the alias of the temporary schema of the session.
+const tempSchema = "pg_temp"
+
+// LoadTemp loads the data into a temporary table to validate it without
+// persisting anything, such as to check the values fit the column types
+// and constraints. The table is created and loaded in a single
+// transaction that is rolled back, so it is discarded even if the
+// connection is returned to the pool. Tables too wide to be created
+// without partitioning are not supported.
+func (c *Client) LoadTemp(tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return c.loadTemp(tableName, tableSchema.copy(), cr)
+}
+
+func (c *Client) loadTemp(tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	if tableSchema.Cstore {
+		return 0, errors.New("temporary tables are not supported with cstore tables")
+	}
+
+	tx, err := c.begin()
+	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	splits, err := c.createTable(schemaName, tableName, tableSchema)
+	// The table is created and loaded as by Replace, but by a client bound
+	// to the transaction so rolling it back discards the table.
+	bound := c.tx
+	if bound == nil {
+		bound = tx.(*sql.Tx)
+	}
+
+	txc := c.inTx(bound)
+	defer c.addTimings(txc)
+
+	splits, err := txc.createTable(tempSchema, tableName, tableSchema)
 	if err != nil {
 		return 0, err
 	}
 
-	n, err := c.copyData(schemaName, tableName, splits, cr)
+	if len(splits) > 1 {
+		return 0, errors.New("too many columns for a temporary table")
+	}
+
+	return txc.copyData(tempSchema, tableName, tableSchema, splits, cr)
+}
+
+// Append creates the table if it does not exist and loads the data into it.
+func (c *Client) Append(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return c.appendTable(schemaName, tableName, tableSchema.copy(), cr)
+}
+
+func (c *Client) appendTable(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	if err := c.CreateTable(schemaName, tableName, tableSchema); err != nil {
+		return 0, err
+	}
+
+	return c.load(schemaName, tableName, tableSchema, cr)
+}
+
+// AppendColumns loads the data into an existing table with more columns
+// than the source, such as columns with defaults. Only the source columns
+// are copied and the other columns of the table take their defaults. It
+// fails if a source column is not in the table.
+func (c *Client) AppendColumns(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return c.appendColumns(schemaName, tableName, tableSchema.copy(), cr)
+}
+
+func (c *Client) appendColumns(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	target, err := c.tableColumns(schemaName, tableName)
 	if err != nil {
 		return 0, err
 	}
 
-	return n, c.analyzeTable(schemaName, tableName, splits)
+	if len(target) == 0 {
+		return 0, fmt.Errorf("table does not exist: %s.%s", schemaName, tableName)
+	}
+
+	exists := make(map[string]bool, len(target))
+	for _, col := range target {
+		exists[col] = true
+	}
+
+	columns, _ := columnDefinitions(tableSchema, c.IndexTablespace, c.quote)
+
+	for _, col := range columns {
+		if !exists[col] {
+			return 0, fmt.Errorf("column %s is not in table %s.%s", col, schemaName, tableName)
+		}
+	}
+
+	tableSchema.Partitions = [][]string{columns}
+
+	return c.load(schemaName, tableName, tableSchema, cr)
+}
+
+// tableColumns returns the column names of the table in order. No columns
+// are returned if the table does not exist.
+func (c *Client) tableColumns(schemaName, tableName string) ([]string, error) {
+	rows, err := c.query(tableColumnsQuery, c.ident(schemaName), c.ident(tableName))
+	if err != nil {
+		return nil, fmt.Errorf("error querying columns: %s", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, rows.Err()
+}
+
+const tableColumnsQuery = `select column_name from information_schema.columns where table_schema = $1 and table_name = $2 order by ordinal_position`
+
+// AppendNew appends the rows whose row hash is not in the table, such as
+// when the same file is loaded again with new rows. The data is loaded
+// into a temporary table and the new rows are inserted from it. The table
+// is created if it does not exist. The schema must have a row hash and
+// partitioned tables are not supported. The number of rows inserted is
+// returned.
+func (c *Client) AppendNew(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return c.appendNew(schemaName, tableName, tableSchema.copy(), cr)
+}
+
+func (c *Client) appendNew(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	if tableSchema.RowHash == nil {
+		return 0, errors.New("appending new rows requires a row hash")
+	}
+
+	if err := c.CreateTable(schemaName, tableName, tableSchema); err != nil {
+		return 0, err
+	}
+
+	if len(tableSchema.Partitions) > 1 {
+		return 0, errors.New("appending new rows is not supported for partitioned tables")
+	}
+
+	columns := tableSchema.Partitions[0]
+
+	tempTableNameUid, _ := uuid.NewV4()
+	tempTableName := tempTableNameUid.String()
+	defer c.dropTable(schemaName, tempTableName)
+
+	// The temporary table is not logged since it is dropped.
+	tempSchema := *tableSchema
+	tempSchema.Unlogged = !tableSchema.Cstore
+
+	splits, err := c.createTable(schemaName, tempTableName, &tempSchema)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := c.copyData(schemaName, tempTableName, &tempSchema, splits, cr); err != nil {
+		return 0, err
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = c.quote(col)
+	}
+
+	data := &tableData{
+		Schema:    schemaName,
+		Table:     tableName,
+		TempTable: tempTableName,
+		Columns:   strings.Join(quoted, ", "),
+		Hash:      c.quote(tableSchema.RowHash.column()),
+	}
+
+	var b bytes.Buffer
+	if err := executeTmpl(&b, "insertNew", data, c.Quoting); err != nil {
+		return 0, err
+	}
+
+	var n int64
+
+	start := time.Now()
+	err = c.execTx(func(tx txn) error {
+		sql := b.String()
+		res, err := tx.Exec(sql)
+		if err != nil {
+			return fmt.Errorf("error inserting new rows: %s\n%s", err, sql)
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	})
+	c.timed(&c.timings.Copy, start)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, c.analyzeTable(schemaName, tableName, tableSchema.Partitions)
+}
+
+// CreateTable creates the schema and the table without loading any data.
+// Tables with more columns than Postgres allows are split into multiple
+// tables joined by a view. The table is left as is if it already exists.
+func (c *Client) CreateTable(schemaName, tableName string, tableSchema *Schema) error {
+	if err := c.createSchema(schemaName); err != nil {
+		return err
+	}
+
+	if err := c.createEnumTypes(schemaName, tableName, tableSchema); err != nil {
+		return err
+	}
+
+	splits, err := c.createTable(schemaName, tableName, tableSchema)
+	if err != nil {
+		return err
+	}
+
+	return c.createPartitionView(schemaName, tableName, tableSchema, splits)
+}
+
+// Load copies the data into a table created by CreateTable with the same
+// schema and analyzes it.
+func (c *Client) Load(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return c.load(schemaName, tableName, tableSchema.copy(), cr)
+}
+
+func (c *Client) load(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	splits := tableSchema.Partitions
+	if splits == nil {
+		columns, _ := columnDefinitions(tableSchema, c.IndexTablespace, c.quote)
+		splits = [][]string{columns}
+	}
+
+	// Rows of the view of an existing split table before the copy.
+	var viewRows int64
+	if c.CheckCount && hasPartitionView(tableSchema, splits) {
+		var err error
+		if viewRows, err = c.RowCount(schemaName, tableName); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.copyData(schemaName, tableName, tableSchema, splits, cr)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.checkViewCount(schemaName, tableName, tableSchema, splits, viewRows+n); err != nil {
+		return n, err
+	}
+
+	return n, c.analyzeTable(schemaName, tableName, splits)
+}
+
+// createPartitionView creates a view joining the partitioned tables if the
+// table was split and the columns fit in a single select.
+func (c *Client) createPartitionView(schemaName, tableName string, tableSchema *Schema, splits [][]string) error {
+	if hasPartitionView(tableSchema, splits) {
+		return c.createView(schemaName, tableName, tableName, tableSchema, splits)
+	}
+
+	return nil
+}
+
+// hasPartitionView returns true if the table is split and the columns of
+// the partitions fit in the select of a view.
+func hasPartitionView(tableSchema *Schema, splits [][]string) bool {
+	return len(splits) > 1 && len(tableSchema.Fields)+len(splits) <= pgMaxTargetListSize
+}
+
+// partitionName returns the name of a partition of the table.
+func partitionName(tableName string, i int) string {
+	return fmt.Sprintf("%s_%d", tableName, i)
 }
 
 func (c *Client) dropView(schemaName, viewName string) error {
+	defer c.timed(&c.timings.Create, time.Now())
+
 	// Create the set of statements to
 	data := &tableData{
 		Schema: schemaName,
@@ -235,11 +1387,11 @@ func (c *Client) dropView(schemaName, viewName string) error {
 	}
 
 	var b bytes.Buffer
-	if err := sqlTmpl.ExecuteTemplate(&b, "dropView", data); err != nil {
+	if err := executeTmpl(&b, "dropView", data, c.Quoting); err != nil {
 		return err
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
 		sql := b.String()
 		_, err := tx.Exec(sql)
 		if err != nil {
@@ -251,6 +1403,8 @@ func (c *Client) dropView(schemaName, viewName string) error {
 }
 
 func (c *Client) dropTable(schemaName, tableName string) error {
+	defer c.timed(&c.timings.Create, time.Now())
+
 	// Create the set of statements to
 	data := &tableData{
 		Schema: schemaName,
@@ -258,11 +1412,11 @@ func (c *Client) dropTable(schemaName, tableName string) error {
 	}
 
 	var b bytes.Buffer
-	if err := sqlTmpl.ExecuteTemplate(&b, "dropTable", data); err != nil {
+	if err := executeTmpl(&b, "dropTable", data, c.Quoting); err != nil {
 		return err
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
 		sql := b.String()
 		_, err := tx.Exec(sql)
 		if err != nil {
@@ -274,28 +1428,47 @@ func (c *Client) dropTable(schemaName, tableName string) error {
 }
 
 func (c *Client) createSchema(schemaName string) error {
+	defer c.timed(&c.timings.Create, time.Now())
+
 	// Create the set of statements to
 	data := &tableData{
 		Schema: schemaName,
 	}
 
 	var b bytes.Buffer
-	if err := sqlTmpl.ExecuteTemplate(&b, "createSchema", data); err != nil {
+	if err := executeTmpl(&b, "createSchema", data, c.Quoting); err != nil {
 		return err
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
+		// Only the owner of a schema created by the client is set, so
+		// existing schemas such as public are left alone.
+		var exists bool
+		if c.Owner != "" {
+			if err := tx.QueryRow(schemaExistsQuery, c.ident(schemaName)).Scan(&exists); err != nil {
+				return fmt.Errorf("error checking schema: %s", err)
+			}
+		}
+
 		sql := b.String()
 		_, err := tx.Exec(sql)
 		if err != nil {
 			return fmt.Errorf("error creating schema: %s\n%s", err, sql)
 		}
 
-		return nil
+		if exists {
+			return nil
+		}
+
+		return c.setOwner(tx, "schemaOwner", data)
 	})
 }
 
-func (c *Client) createView(schemaName, viewName string, tableName string, tableColumns [][]string) error {
+const schemaExistsQuery = `select exists (select 1 from pg_namespace where nspname = $1)`
+
+func (c *Client) createView(schemaName, viewName string, tableName string, tableSchema *Schema, tableColumns [][]string) error {
+	defer c.timed(&c.timings.Create, time.Now())
+
 	var (
 		firstTable    string
 		rightTable    string
@@ -305,19 +1478,26 @@ func (c *Client) createView(schemaName, viewName string, tableName string, table
 	)
 
 	for i, cols := range tableColumns {
-		rightTable = fmt.Sprintf("%s_%d", tableName, i)
+		rightTable = partitionName(tableName, i)
 
 		if firstTable == "" {
 			firstTable = rightTable
 		}
 
+		// The identity column is in the first table.
+		if i == 0 && tableSchema.Identity != "" {
+			selectColumns = append(selectColumns, c.quote(schemaName)+"."+c.quote(rightTable)+"."+c.quote(CleanIdentifier(tableSchema.Identity)))
+		}
+
 		// Add columns to select statement.
 		for _, col := range cols {
-			selectColumns = append(selectColumns, fmt.Sprintf(`"%s"."%s"."%s"`, schemaName, rightTable, col))
+			selectColumns = append(selectColumns, c.quote(schemaName)+"."+c.quote(rightTable)+"."+c.quote(col))
 		}
 
 		if leftTable != "" {
-			joins = append(joins, fmt.Sprintf(`inner join "%s"."%s" on ("%s"."%s"."%s" = "%s"."%s"."%s")`, schemaName, rightTable, schemaName, leftTable, rowIdColumn, schemaName, rightTable, rowIdColumn))
+			right := c.quote(schemaName) + "." + c.quote(rightTable)
+			left := c.quote(schemaName) + "." + c.quote(leftTable)
+			joins = append(joins, fmt.Sprintf("inner join %s on (%s.%s = %s.%s)", right, left, c.quote(rowIdColumn), right, c.quote(rowIdColumn)))
 		}
 
 		leftTable = rightTable
@@ -332,47 +1512,148 @@ func (c *Client) createView(schemaName, viewName string, tableName string, table
 	}
 
 	var b bytes.Buffer
-	if err := sqlTmpl.ExecuteTemplate(&b, "createView", data); err != nil {
+	if err := executeTmpl(&b, "createView", data, c.Quoting); err != nil {
 		return err
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
 		sql := b.String()
 		_, err := tx.Exec(sql)
 		if err != nil {
 			return fmt.Errorf("error creating view: %s\n%s", err, sql)
 		}
 
-		return nil
+		return c.setOwner(tx, "viewOwner", data)
 	})
 }
 
-func (c *Client) createTable(schemaName, tableName string, tableSchema *Schema) ([][]string, error) {
+// columnDefinitions returns the cleaned column names and the column
+// definitions used to create a table for the schema.
+func columnDefinitions(tableSchema *Schema, indexSpace string, quote func(string) string) ([]string, []string) {
 	var (
 		columns       []string
 		columnSchemas []string
 	)
 
+	using := usingIndexTablespace(indexSpace, quote)
+
 	for _, f := range tableSchema.Fields {
 		// Cleaned column name.
-		name := cleanFieldName(f.Name)
+		name := CleanIdentifier(f.Name)
 		columns = append(columns, name)
 
 		var col string
 
+		typ := f.Type
+		if f.Default != "" {
+			typ += " default " + f.Default
+		}
+
 		// Create index.
 		// TODO: long text values cannot be indexed.
 		// https://dba.stackexchange.com/questions/25138/index-max-row-size-error.
 		// Should this check the max value length?
-		if f.Unique && f.Type != "text" {
-			col = "%s %s unique"
+		if f.PrimaryKey {
+			col = "%s %s primary key" + using
+		} else if f.Unique && f.Type != "text" {
+			col = "%s %s unique" + using
 		} else if !f.Nullable {
 			col = "%s %s not null"
 		} else {
 			col = "%s %s"
 		}
 
-		columnSchemas = append(columnSchemas, fmt.Sprintf(col, pq.QuoteIdentifier(name), f.Type))
+		columnSchemas = append(columnSchemas, fmt.Sprintf(col, quote(name), typ))
+	}
+
+	// The row hash is loaded after the source columns.
+	if h := tableSchema.RowHash; h != nil {
+		columns = append(columns, h.column())
+		columnSchemas = append(columnSchemas, h.definition(quote))
+	}
+
+	return columns, columnSchemas
+}
+
+// usingIndexTablespace returns the clause of a constraint creating its
+// index in the tablespace, if set.
+func usingIndexTablespace(space string, quote func(string) string) string {
+	if space == "" {
+		return ""
+	}
+
+	return " using index tablespace " + quote(space)
+}
+
+// columnTypes returns the SQL types of the columns of the tables of the
+// schema by name, including the row id of partitions and the row hash.
+func columnTypes(tableSchema *Schema) map[string]string {
+	types := map[string]string{
+		rowIdColumn: "integer",
+	}
+
+	for _, f := range tableSchema.Fields {
+		types[CleanIdentifier(f.Name)] = f.Type
+	}
+
+	if h := tableSchema.RowHash; h != nil {
+		types[h.column()] = "text"
+	}
+
+	return types
+}
+
+// identityDefinition returns the column definition of the identity column
+// after checking it does not conflict with the schema.
+func identityDefinition(tableSchema *Schema, columns []string, indexSpace string, quote func(string) string) (string, error) {
+	if tableSchema.Cstore {
+		return "", errors.New("identity columns are not supported with cstore tables")
+	}
+
+	name := CleanIdentifier(tableSchema.Identity)
+
+	for _, col := range columns {
+		if col == name {
+			return "", fmt.Errorf("identity column conflicts with column: %s", name)
+		}
+	}
+
+	for _, f := range tableSchema.Fields {
+		if f.PrimaryKey {
+			return "", fmt.Errorf("identity column conflicts with primary key column: %s", CleanIdentifier(f.Name))
+		}
+	}
+
+	return fmt.Sprintf("%s bigint generated always as identity primary key%s", quote(name), usingIndexTablespace(indexSpace, quote)), nil
+}
+
+func (c *Client) createTable(schemaName, tableName string, tableSchema *Schema) ([][]string, error) {
+	defer c.timed(&c.timings.Create, time.Now())
+
+	if tableSchema.Cstore && tableSchema.Unlogged {
+		return nil, errUnloggedCstore
+	}
+
+	if tableSchema.Cstore && (c.Tablespace != "" || c.IndexTablespace != "") {
+		return nil, errTablespaceCstore
+	}
+
+	if _, err := newRowHasher(tableSchema); err != nil {
+		return nil, err
+	}
+
+	if err := validatePrimaryKey(tableSchema); err != nil {
+		return nil, err
+	}
+
+	columns, columnSchemas := columnDefinitions(tableSchema, c.IndexTablespace, c.quote)
+
+	var identity string
+	if tableSchema.Identity != "" {
+		var err error
+		if identity, err = identityDefinition(tableSchema, columns, c.IndexTablespace, c.quote); err != nil {
+			return nil, err
+		}
 	}
 
 	// 250 - 1600 is max number of columns allowed per table, but this depends
@@ -387,14 +1668,20 @@ func (c *Client) createTable(schemaName, tableName string, tableSchema *Schema)
 		columnSplits := splitColumns(columns, size)
 		columnSchemaSplits := splitColumns(columnSchemas, size)
 
-		err := c.createTableSplits(schemaName, tableName, columnSchemaSplits, tableSchema.Cstore)
+		// The identity column is only added to the first table.
+		if identity != "" {
+			columnSchemaSplits[0] = append([]string{identity}, columnSchemaSplits[0]...)
+		}
+
+		err := c.createTableSplits(schemaName, tableName, columnSchemaSplits, tableSchema)
 
 		// Success.
 		if err == nil {
+			tableSchema.Partitions = columnSplits
 			return columnSplits, nil
 		}
 
-		if !strings.Contains(err.Error(), "pq: tables can have at most 1600 columns") {
+		if !isTooManyColumns(err) {
 			return nil, err
 		}
 	}
@@ -402,30 +1689,72 @@ func (c *Client) createTable(schemaName, tableName string, tableSchema *Schema)
 	return nil, errors.New("failed to partition columns")
 }
 
-func (c *Client) createTableSplits(schemaName, tableName string, splitColumns [][]string, cstore bool) error {
+// validatePrimaryKey checks the schema has at most one primary key column
+// and supports constraints.
+func validatePrimaryKey(tableSchema *Schema) error {
+	var keys []string
+
+	for _, f := range tableSchema.Fields {
+		if f.PrimaryKey {
+			keys = append(keys, CleanIdentifier(f.Name))
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if tableSchema.Cstore {
+		return errors.New("primary keys are not supported with cstore tables")
+	}
+
+	if len(keys) > 1 {
+		return fmt.Errorf("multiple primary key columns: %s", strings.Join(keys, ", "))
+	}
+
+	return nil
+}
+
+var errUnloggedCstore = errors.New("unlogged tables are not supported with cstore tables")
+
+var errTablespaceCstore = errors.New("tablespaces are not supported with cstore tables")
+
+// isTooManyColumns returns true if the error is due to exceeding the
+// maximum number of columns in a table. The error message is checked if
+// the error does not carry an SQL state.
+func isTooManyColumns(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pgTooManyColumns
+	}
+
+	return strings.Contains(err.Error(), "tables can have at most 1600 columns")
+}
+
+func (c *Client) createTableSplits(schemaName, tableName string, splitColumns [][]string, tableSchema *Schema) error {
 	// All columns fit in the table.
 	if len(splitColumns) == 1 {
-		return c.execTx(func(tx *sql.Tx) error {
-			return c.createSingleTable(tx, schemaName, tableName, splitColumns[0], cstore)
+		return c.execTx(func(tx txn) error {
+			return c.createSingleTable(tx, schemaName, tableName, splitColumns[0], tableSchema)
 		})
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
 		var partTables []string
 
 		// Multiple tables, so we need to add the rowIdColumn.
 		// A suffix is added to each table name. Then a view is created
 		// to join the tables to together.
 		for i, cols := range splitColumns {
-			partTableName := fmt.Sprintf("%s_%d", tableName, i)
+			partTableName := partitionName(tableName, i)
 
 			ncols := []string{
-				rowIdColumn + " integer not null unique",
+				rowIdColumn + " integer not null unique" + usingIndexTablespace(c.IndexTablespace, c.quote),
 			}
 			ncols = append(ncols, cols...)
 
 			// TODO: clean up partially created tables?
-			if err := c.createSingleTable(tx, schemaName, partTableName, ncols, cstore); err != nil {
+			if err := c.createSingleTable(tx, schemaName, partTableName, ncols, tableSchema); err != nil {
 				return err
 			}
 
@@ -436,33 +1765,92 @@ func (c *Client) createTableSplits(schemaName, tableName string, splitColumns []
 	})
 }
 
-func (c *Client) createSingleTable(tx *sql.Tx, schemaName, tableName string, columns []string, cstore bool) error {
+func (c *Client) createSingleTable(tx txn, schemaName, tableName string, columns []string, tableSchema *Schema) error {
 	// Create the set of statements to
 	data := &tableData{
-		Schema:  schemaName,
-		Table:   tableName,
-		Columns: strings.Join(columns, ","),
+		Schema:     schemaName,
+		Table:      tableName,
+		Columns:    strings.Join(columns, ","),
+		Unlogged:   tableSchema.Unlogged,
+		Temporary:  schemaName == tempSchema,
+		Cstore:     tableSchema.Cstore,
+		StripeRows: tableSchema.StripeRows,
+		Tablespace: c.Tablespace,
 	}
 
 	tmplName := "createTable"
-	if cstore {
+	if tableSchema.Cstore {
 		tmplName = "createCstoreTable"
 	}
 
 	var b bytes.Buffer
-	if err := sqlTmpl.ExecuteTemplate(&b, tmplName, data); err != nil {
+	if err := executeTmpl(&b, tmplName, data, c.Quoting); err != nil {
 		return err
 	}
 
 	sql := b.String()
 	_, err := tx.Exec(sql)
 	if err != nil {
-		return fmt.Errorf("error creating table: %s\n%s", err, sql)
+		return fmt.Errorf("error creating table: %w\n%s", err, sql)
 	}
-	return err
+
+	// Temporary tables are owned by the session.
+	if data.Temporary {
+		return nil
+	}
+
+	return c.setOwner(tx, "tableOwner", data)
+}
+
+// setOwner makes the owner of the client the owner of the object of the
+// template, if set.
+func (c *Client) setOwner(tx txn, tmplName string, data *tableData) error {
+	if c.Owner == "" {
+		return nil
+	}
+
+	data.Owner = c.quote(c.Owner)
+
+	var b bytes.Buffer
+	if err := executeTmpl(&b, tmplName, data, c.Quoting); err != nil {
+		return err
+	}
+
+	sql := b.String()
+	if _, err := tx.Exec(sql); err != nil {
+		return fmt.Errorf("error setting owner: %s\n%s", err, sql)
+	}
+
+	return nil
+}
+
+// roleName matches the names of roles that may own objects. Names are
+// limited to those that do not need quoting.
+var roleName = regexp.MustCompile(`^[a-z_][a-z0-9_$]{0,62}$`)
+
+// ValidateOwner returns an error if the role name is not valid.
+func ValidateOwner(role string) error {
+	if role != "" && !roleName.MatchString(role) {
+		return fmt.Errorf("invalid owner role name: %q", role)
+	}
+
+	return nil
+}
+
+// tablespaceName matches the names of tablespaces, which are identifiers
+// of at most 63 bytes.
+var tablespaceName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]{0,62}$`)
+
+// ValidateTablespace returns an error if the tablespace name is not valid.
+func ValidateTablespace(name string) error {
+	if name != "" && !tablespaceName.MatchString(name) {
+		return fmt.Errorf("invalid tablespace name: %q", name)
+	}
+
+	return nil
 }
 
-func (c *Client) renameSingleTable(tx *sql.Tx, schemaName, tempTableName, tableName string) error {
+func (c *Client) renameSingleTable(tx txn, schemaName, tempTableName, tableName string) error {
 	var b bytes.Buffer
 
 	// Create the set of statements to
@@ -479,7 +1867,7 @@ func (c *Client) renameSingleTable(tx *sql.Tx, schemaName, tempTableName, tableN
 
 	for _, name := range tmpls {
 		b.Reset()
-		if err := sqlTmpl.ExecuteTemplate(&b, name, data); err != nil {
+		if err := executeTmpl(&b, name, data, c.Quoting); err != nil {
 			return err
 		}
 
@@ -492,32 +1880,112 @@ func (c *Client) renameSingleTable(tx *sql.Tx, schemaName, tempTableName, tableN
 }
 
 func (c *Client) renameTable(schemaName, tempTableName, tableName string, tableParts int) error {
+	defer c.timed(&c.timings.Create, time.Now())
+
 	if tableParts == 1 {
-		return c.execTx(func(tx *sql.Tx) error {
+		return c.execTx(func(tx txn) error {
 			return c.renameSingleTable(tx, schemaName, tempTableName, tableName)
 		})
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
 		for i := 0; i < tableParts; i++ {
-			if err := c.renameSingleTable(tx, schemaName, fmt.Sprintf("%s_%d", tempTableName, i), fmt.Sprintf("%s_%d", tableName, i)); err != nil {
+			if err := c.renameSingleTable(tx, schemaName, partitionName(tempTableName, i), partitionName(tableName, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fillDefaults sets the nulls loaded into columns with defaults to the
+// defaults, since copied nulls are not defaulted. Each table is updated
+// once for all of its columns.
+func (c *Client) fillDefaults(schemaName, tableName string, tableSchema *Schema, tableColumns [][]string) error {
+	defaults := columnDefaults(tableSchema)
+	if len(defaults) == 0 {
+		return nil
+	}
+
+	defer c.timed(&c.timings.Copy, time.Now())
+
+	return c.execTx(func(tx txn) error {
+		for i, cols := range tableColumns {
+			data := &tableData{
+				Schema: schemaName,
+				Table:  tableName,
+			}
+
+			if len(tableColumns) > 1 {
+				data.Table = partitionName(tableName, i)
+			}
+
+			data.Columns, data.Filter = fillClauses(c.quote, defaults, cols)
+			if data.Columns == "" {
+				continue
+			}
+
+			var b bytes.Buffer
+			if err := executeTmpl(&b, "fillDefaults", data, c.Quoting); err != nil {
 				return err
 			}
+
+			sql := b.String()
+			if _, err := tx.Exec(sql); err != nil {
+				return fmt.Errorf("error filling defaults: %s\n%s", err, sql)
+			}
 		}
+
 		return nil
 	})
 }
 
+// columnDefaults returns the default expressions of the columns of the
+// schema with defaults.
+func columnDefaults(tableSchema *Schema) map[string]string {
+	defaults := make(map[string]string)
+	for _, f := range tableSchema.Fields {
+		if f.Default != "" {
+			defaults[CleanIdentifier(f.Name)] = f.Default
+		}
+	}
+
+	return defaults
+}
+
+// fillClauses returns the assignments and condition of the update that
+// sets the nulls of the columns to their defaults, or empty strings if
+// none of the columns has a default. The default expressions are used
+// since DEFAULT cannot be used in an expression.
+func fillClauses(quote func(string) string, defaults map[string]string, cols []string) (string, string) {
+	var sets, conds []string
+
+	for _, col := range cols {
+		expr, ok := defaults[col]
+		if !ok {
+			continue
+		}
+
+		q := quote(col)
+		sets = append(sets, fmt.Sprintf("%s = coalesce(%s, %s)", q, q, expr))
+		conds = append(conds, q+" is null")
+	}
+
+	return strings.Join(sets, ", "), strings.Join(conds, " or ")
+}
+
 func (c *Client) analyzeTable(schemaName, tableName string, tableColumns [][]string) error {
+	defer c.timed(&c.timings.Analyze, time.Now())
+
 	if len(tableColumns) == 1 {
-		return c.execTx(func(tx *sql.Tx) error {
+		return c.execTx(func(tx txn) error {
 			return c.analyzeSingleTable(tx, schemaName, tableName)
 		})
 	}
 
-	return c.execTx(func(tx *sql.Tx) error {
+	return c.execTx(func(tx txn) error {
 		for i := range tableColumns {
-			if err := c.analyzeSingleTable(tx, schemaName, fmt.Sprintf("%s_%d", tableName, i)); err != nil {
+			if err := c.analyzeSingleTable(tx, schemaName, partitionName(tableName, i)); err != nil {
 				return err
 			}
 		}
@@ -526,15 +1994,29 @@ func (c *Client) analyzeTable(schemaName, tableName string, tableColumns [][]str
 	})
 }
 
-func (c *Client) analyzeSingleTable(tx *sql.Tx, schemaName, tableName string) error {
+func (c *Client) analyzeSingleTable(tx txn, schemaName, tableName string) error {
 	// Create the set of statements to
 	data := &tableData{
-		Schema: schemaName,
-		Table:  tableName,
+		Schema:  schemaName,
+		Table:   tableName,
+		Target:  c.Analyze.Target,
+		Verbose: c.Analyze.Verbose,
+	}
+
+	if data.Target > 0 {
+		var b bytes.Buffer
+		if err := executeTmpl(&b, "statisticsTarget", data, c.Quoting); err != nil {
+			return err
+		}
+
+		sql := b.String()
+		if _, err := tx.Exec(sql); err != nil {
+			return fmt.Errorf("error setting statistics target: %s\n%s", err, sql)
+		}
 	}
 
 	var b bytes.Buffer
-	if err := sqlTmpl.ExecuteTemplate(&b, "analyzeTable", data); err != nil {
+	if err := executeTmpl(&b, "analyzeTable", data, c.Quoting); err != nil {
 		return err
 	}
 
@@ -546,48 +2028,170 @@ func (c *Client) analyzeSingleTable(tx *sql.Tx, schemaName, tableName string) er
 	return nil
 }
 
-func (c *Client) copyData(schemaName, tableName string, tableColumns [][]string, cr *csv.Reader) (int64, error) {
-	// Read and skip columns.
-	_, err := cr.Read()
+func (c *Client) copyData(schemaName, tableName string, tableSchema *Schema, tableColumns [][]string, cr RowReader) (int64, error) {
+	defer c.timed(&c.timings.Copy, time.Now())
+
+	hasher, err := newRowHasher(tableSchema)
 	if err != nil {
 		return 0, err
 	}
 
+	if err := c.readHeader(cr); err != nil {
+		return 0, err
+	}
+
 	singleTable := len(tableColumns) == 1
-	singleTableSize := len(tableColumns[0])
 
-	txs := make([]*sql.Tx, len(tableColumns))
+	// The partitions are copied concurrently, which a single connection
+	// does not support.
+	if !singleTable && c.tx != nil {
+		return 0, errors.New("partitioned tables are not supported within a transaction")
+	}
+
+	txs := make([]txn, len(tableColumns))
 	stmts := make([]*sql.Stmt, len(tableColumns))
+	tables := make([]string, len(tableColumns))
+	columns := make([][]string, len(tableColumns))
 
+	// Transactions are rolled back unless committed, so a read error
+	// (e.g. a truncated compressed file) leaves no partial data.
 	defer func() {
 		for i := range txs {
-			stmts[i].Close()
-			txs[i].Rollback()
+			if stmts[i] != nil {
+				stmts[i].Close()
+			}
+			if txs[i] != nil {
+				txs[i].Rollback()
+			}
 		}
 	}()
 
+	// Rows of the tables before the copy, if checked.
+	counts := make([]int64, len(tableColumns))
+
 	for i, cols := range tableColumns {
-		tx, err := c.db.Begin()
+		tx, err := c.begin()
 		if err != nil {
 			return 0, err
 		}
 
 		txs[i] = tx
 
-		targetTable := tableName
+		tables[i] = tableName
 		if !singleTable {
 			cols = append([]string{rowIdColumn}, cols...)
-			targetTable = fmt.Sprintf("%s_%d", tableName, i)
+			tables[i] = partitionName(tableName, i)
+		}
+
+		if c.CheckCount {
+			if counts[i], err = c.countRows(tx, schemaName, tables[i]); err != nil {
+				return 0, err
+			}
+		}
+
+		columns[i] = cols
+
+		// Rows of cstore tables are inserted in stripes.
+		if tableSchema.Cstore {
+			continue
+		}
+
+		query, err := c.copyIn(schemaName, tables[i], cols)
+		if err != nil {
+			return 0, err
 		}
 
-		stmt, err := tx.Prepare(pq.CopyInSchema(schemaName, targetTable, cols...))
+		stmt, err := tx.Prepare(query)
 		if err != nil {
-			return 0, fmt.Errorf("error preparing copy: %s", err)
+			return 0, fmt.Errorf("error preparing copy: %w", err)
 		}
 
 		stmts[i] = stmt
 	}
 
+	var sink rowSink = c.copySink(stmts...)
+	if tableSchema.Cstore {
+		sink = newStripeSink(txs, c.quote, schemaName, tables, columns, columnTypes(tableSchema), tableSchema.StripeRows)
+	}
+
+	n, err := c.copyRows(sink, tableSchema, tableColumns, hasher, cr)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.CheckCount {
+		for i, tx := range txs {
+			if err := c.checkCount(tx, schemaName, tables[i], counts[i]+n); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Commit transactions.
+	for _, tx := range txs {
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// readHeader reads and skips the columns. They are written to the
+// rejects if set.
+func (c *Client) readHeader(cr RowReader) error {
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+
+	if c.Rejects != nil {
+		if err := c.Rejects.WriteHeader(rawRow(cr, header)); err != nil {
+			return fmt.Errorf("error writing rejects header: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// rowValues sets the values to load of the row. An error is returned if a
+// value is null in a not null column or, if rows are rejected, does not
+// match the type of its column.
+func (c *Client) rowValues(values []interface{}, tableSchema *Schema, row []string, rowid int64) error {
+	for i, v := range row {
+		f := tableSchema.Fields[i]
+
+		if values[i] = c.value(f, v); values[i] == nil {
+			if !f.Nullable {
+				return notNullError(f, rowid)
+			}
+			continue
+		}
+
+		if c.NullSentinel != "" && values[i] == c.NullSentinel {
+			return sentinelError(f, rowid)
+		}
+
+		if c.Rejects != nil && !matchesType(f, v) {
+			return typeError(f, v, rowid)
+		}
+	}
+
+	return nil
+}
+
+// copyRows sends the rows to the sink of the tables and flushes it.
+func (c *Client) copyRows(sink rowSink, tableSchema *Schema, tableColumns [][]string, hasher *rowHasher, cr RowReader) (int64, error) {
+	singleTable := len(tableColumns) == 1
+
+	// Values of the columns of a row including the row hash.
+	var width int
+	for _, cols := range tableColumns {
+		width += len(cols)
+	}
+
+	values := make([]interface{}, width)
+
 	// Allocate buffer. Max width + 1 for row id.
 	// The actual bounds will need to be maintained.
 	cargs := make([]interface{}, len(tableColumns[0])+1)
@@ -605,23 +2209,31 @@ func (c *Client) copyData(schemaName, tableName string, tableColumns [][]string,
 		}
 
 		if err != nil {
-			return 0, fmt.Errorf("error reading record: %s", err)
+			return 0, fmt.Errorf("error reading record: %w", err)
 		}
 
 		rowid++
 
-		if singleTable {
-			for i, v := range row {
-				if v == "" {
-					cargs[i] = nil
-				} else {
-					cargs[i] = v
-				}
+		if err := c.rowValues(values, tableSchema, row, rowid); err != nil {
+			if c.Rejects == nil {
+				return 0, err
+			}
+
+			if err := c.Rejects.Write(rawRow(cr, row), err); err != nil {
+				return 0, fmt.Errorf("error writing rejected row: %s", err)
 			}
 
-			_, err = stmts[0].Exec(cargs[:singleTableSize]...)
+			continue
+		}
+
+		if hasher != nil {
+			values[len(tableSchema.Fields)] = hasher.sum(row)
+		}
+
+		if singleTable {
+			err = sink.Send(0, values)
 			if err != nil {
-				return 0, fmt.Errorf("error sending row: %s", err)
+				return 0, fmt.Errorf("error sending row: %w", err)
 			}
 		} else {
 			var low, hi int
@@ -630,20 +2242,13 @@ func (c *Client) copyData(schemaName, tableName string, tableColumns [][]string,
 				hi = low + len(cols)
 
 				cargs[0] = rowid
-
-				for j, v := range row[low:hi] {
-					if v == "" {
-						cargs[j+1] = nil
-					} else {
-						cargs[j+1] = v
-					}
-				}
+				copy(cargs[1:], values[low:hi])
 
 				low = hi
 
-				_, err = stmts[i].Exec(cargs[:len(cols)+1]...)
+				err = sink.Send(i, cargs[:len(cols)+1])
 				if err != nil {
-					return 0, fmt.Errorf("error sending row: %s: %v, %v", err, cols, cargs[:len(cols)+1])
+					return 0, fmt.Errorf("error sending row: %w: %v, %v", err, cols, cargs[:len(cols)+1])
 				}
 			}
 		}
@@ -651,23 +2256,8 @@ func (c *Client) copyData(schemaName, tableName string, tableColumns [][]string,
 		n++
 	}
 
-	// Empty exec to flush the buffer.
-	for _, stmt := range stmts {
-		_, err = stmt.Exec()
-		if err != nil {
-			return 0, fmt.Errorf("error executing copy: %s", err)
-		}
-	}
-
-	if err != nil {
-		return 0, err
-	}
-
-	// Commit transactions.
-	for _, tx := range txs {
-		if err := tx.Commit(); err != nil {
-			return 0, err
-		}
+	if err := sink.Flush(); err != nil {
+		return 0, fmt.Errorf("error executing copy: %w", err)
 	}
 
 	return n, nil
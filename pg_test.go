@@ -0,0 +1,567 @@
+package sqlimporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chop-dbhi/sql-importer/profile"
+	"github.com/lib/pq"
+)
+
+func TestNewSchemaFloatType(t *testing.T) {
+	prof := profile.NewProfile()
+	prof.Fields["low"] = &profile.Field{Name: "low", Index: 0, Type: profile.FloatType, Precision: 4}
+	prof.Fields["high"] = &profile.Field{Name: "high", Index: 1, Type: profile.FloatType, Precision: 12}
+
+	tests := map[string]struct {
+		FloatType string
+		Low       string
+		High      string
+	}{
+		"default": {"", "real", "real"},
+		"auto":    {FloatAuto, "real", "double precision"},
+		"real":    {FloatReal, "real", "real"},
+		"double":  {FloatDouble, "double precision", "double precision"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := NewSchemaWithConfig(prof, &SchemaConfig{
+				FloatType: test.FloatType,
+			})
+
+			if s.Fields[0].Type != test.Low {
+				t.Errorf("expected %s for low precision, got %s", test.Low, s.Fields[0].Type)
+			}
+
+			if s.Fields[1].Type != test.High {
+				t.Errorf("expected %s for high precision, got %s", test.High, s.Fields[1].Type)
+			}
+		})
+	}
+}
+
+func TestNewSchemaTextPatterns(t *testing.T) {
+	prof := profile.NewProfile()
+	prof.Fields["zip"] = &profile.Field{Name: "zip", Index: 0, Type: profile.IntType}
+	prof.Fields["ndc_code"] = &profile.Field{Name: "ndc_code", Index: 1, Type: profile.IntType}
+	prof.Fields["count"] = &profile.Field{Name: "count", Index: 2, Type: profile.IntType}
+
+	s := NewSchemaWithConfig(prof, &SchemaConfig{
+		TextPatterns: []string{"zip", "*_code"},
+	})
+
+	for i, exp := range []string{"text", "text", "integer"} {
+		if s.Fields[i].Type != exp {
+			t.Errorf("%s: expected %s, got %s", s.Fields[i].Name, exp, s.Fields[i].Type)
+		}
+	}
+}
+
+func TestCreateTableIdentity(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	schema := &Schema{
+		Identity: "id",
+		Fields: []*Field{
+			{Name: "name", Type: "text", Nullable: true},
+		},
+	}
+
+	cr := csv.NewReader(strings.NewReader("name\nJoe\nSue\n"))
+
+	if _, err := New(db).Replace("public", "people", schema, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, ok := b.table("public", "people")
+	if !ok {
+		t.Fatal("expected table to be created")
+	}
+
+	if !strings.Contains(ddl, `"id" bigint generated always as identity primary key`) {
+		t.Errorf("expected identity column, got: %s", ddl)
+	}
+
+	// The identity column is not copied.
+	for _, row := range b.copied("public", "people") {
+		if len(row) != 1 {
+			t.Errorf("expected 1 copied value, got %d", len(row))
+		}
+	}
+}
+
+func TestCreateTableIdentitySplit(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	schema := &Schema{
+		Identity: "id",
+	}
+
+	var header []string
+	for i := 0; i < 1500; i++ {
+		name := fmt.Sprintf("c%d", i)
+		header = append(header, name)
+		schema.Fields = append(schema.Fields, &Field{Name: name, Type: "integer", Nullable: true})
+	}
+
+	cr := csv.NewReader(strings.NewReader(strings.Join(header, ",") + "\n"))
+
+	if _, err := New(db).Replace("public", "wide", schema, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := b.table("public", "wide_0")
+	second, _ := b.table("public", "wide_1")
+
+	if !strings.Contains(first, `"id" bigint generated always`) {
+		t.Error("expected identity column in first table")
+	}
+
+	if strings.Contains(second, `"id" bigint generated always`) {
+		t.Error("expected no identity column in second table")
+	}
+
+	views := b.executed(`create or replace view "public"."wide"`)
+	if len(views) != 1 || !strings.Contains(views[0], `"public"."wide_0"."id"`) {
+		t.Errorf("expected identity column in view, got %v", views)
+	}
+}
+
+func TestCreateTableWithoutData(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	schema := &Schema{}
+
+	var header, row []string
+	for i := 0; i < 1500; i++ {
+		name := fmt.Sprintf("c%d", i)
+		header = append(header, name)
+		row = append(row, "1")
+		schema.Fields = append(schema.Fields, &Field{Name: name, Type: "integer", Nullable: true})
+	}
+
+	c := New(db)
+
+	if err := c.CreateTable("public", "wide", schema); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"wide_0", "wide_1"} {
+		if _, ok := b.table("public", name); !ok {
+			t.Errorf("expected table %s to be created", name)
+		}
+
+		if rows := b.copied("public", name); len(rows) != 0 {
+			t.Errorf("expected no rows in %s, got %d", name, len(rows))
+		}
+	}
+
+	if views := b.executed(`create or replace view "public"."wide"`); len(views) != 1 {
+		t.Errorf("expected view to be created, got %v", views)
+	}
+
+	if len(schema.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(schema.Partitions))
+	}
+
+	// Load into the created tables.
+	cr := csv.NewReader(strings.NewReader(strings.Join(header, ",") + "\n" + strings.Join(row, ",") + "\n"))
+
+	n, err := c.Load("public", "wide", schema, cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("expected 1 row, got %d", n)
+	}
+
+	if rows := b.copied("public", "wide_1"); len(rows) != 1 {
+		t.Errorf("expected 1 row in wide_1, got %d", len(rows))
+	}
+}
+
+func TestCreateTableTooManyColumnsCode(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	// Localized message so only the code identifies the error.
+	b.execErr = func(query string) error {
+		if strings.HasPrefix(query, "create table") && strings.Count(query, " integer") > 250 {
+			return &pq.Error{Code: "54011", Message: "les tables peuvent avoir au plus 1600 colonnes"}
+		}
+		return nil
+	}
+
+	schema := &Schema{}
+	for i := 0; i < 500; i++ {
+		schema.Fields = append(schema.Fields, &Field{Name: fmt.Sprintf("c%d", i), Type: "integer", Nullable: true})
+	}
+
+	splits, err := New(db).createTable("public", "wide", schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(splits) != 3 {
+		t.Errorf("expected 3 partitions, got %d", len(splits))
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, ok := b.table("public", fmt.Sprintf("wide_%d", i)); !ok {
+			t.Errorf("expected partition %d to be created", i)
+		}
+	}
+}
+
+func TestCreateTableOtherError(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	b.execErr = func(query string) error {
+		if strings.HasPrefix(query, "create table") {
+			return &pq.Error{Code: "42501", Message: "permission denied"}
+		}
+		return nil
+	}
+
+	schema := &Schema{
+		Fields: []*Field{{Name: "a", Type: "integer"}},
+	}
+
+	if _, err := New(db).createTable("public", "t", schema); err == nil || isTooManyColumns(err) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
+
+func TestAnalyzeOptions(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "name", Type: "text", Nullable: true},
+		},
+	}
+
+	c := New(db)
+	c.Analyze = AnalyzeOptions{Target: 10, Verbose: true}
+
+	cr := csv.NewReader(strings.NewReader("name\nJoe\n"))
+
+	if _, err := c.Append("public", "people", schema, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmts := b.executed("default_statistics_target"); len(stmts) != 1 || stmts[0] != "set local default_statistics_target = 10" {
+		t.Errorf("expected statistics target, got %v", stmts)
+	}
+
+	if stmts := b.executed("analyze"); len(stmts) != 1 || stmts[0] != `analyze verbose "public"."people"` {
+		t.Errorf("expected verbose analyze, got %v", stmts)
+	}
+}
+
+func TestCreateTableUnlogged(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	schema := &Schema{
+		Unlogged: true,
+		Fields: []*Field{
+			{Name: "name", Type: "text", Nullable: true},
+		},
+	}
+
+	c := New(db)
+
+	if err := c.CreateTable("public", "staging", schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if stmts := b.executed(`create unlogged table if not exists "public"."staging"`); len(stmts) != 1 {
+		t.Errorf("expected unlogged table, got %v", b.executed("create"))
+	}
+
+	schema.Cstore = true
+
+	if err := c.CreateTable("public", "staging_cstore", schema); err == nil {
+		t.Error("expected unlogged cstore table to fail")
+	}
+}
+
+func TestDefaultExpr(t *testing.T) {
+	tests := map[string]string{
+		"new":                     `'new'`,
+		"'new'":                   `'new'`,
+		"0":                       `'0'`,
+		"NOW()":                   "now()",
+		" current_date ":          "current_date",
+		"it's":                    `'it''s'`,
+		"'it''s'":                 `'it''s'`,
+		"x'; drop table t; --":    `'x''; drop table t; --'`,
+		"now(); drop table t; --": `'now(); drop table t; --'`,
+	}
+
+	for v, expected := range tests {
+		if expr := DefaultExpr(v); expr != expected {
+			t.Errorf("%q: expected %s, got %s", v, expected, expr)
+		}
+	}
+}
+
+func TestReplacePartitionedUnique(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	c := New(db)
+
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer", Unique: true},
+			{Name: PartitionColumn, Type: "text"},
+		},
+	}
+
+	cr := csv.NewReader(strings.NewReader("id,_partition\n1,a\n"))
+	if _, err := c.replacePartitionedTx("public", "events", schema, []string{"a"}, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unique constraints would have to include the partition key.
+	if ddl, _ := b.table("public", "events"); strings.Contains(ddl, "unique") {
+		t.Errorf("expected no unique constraint, got: %s", ddl)
+	}
+
+	if !schema.Fields[0].Unique {
+		t.Fatal("expected the schema to keep its unique field")
+	}
+
+	cr = csv.NewReader(strings.NewReader("id,_partition\n1,a\n"))
+	if _, err := c.Append("public", "other", schema, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	if ddl, _ := b.table("public", "other"); !strings.Contains(ddl, `"id" integer unique`) {
+		t.Errorf("expected a unique constraint, got: %s", ddl)
+	}
+}
+
+func TestAppendQuoteMinimal(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	c := New(db)
+	c.Quoting = QuoteMinimal
+
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+			{Name: "order", Type: "text"},
+		},
+	}
+
+	cr := csv.NewReader(strings.NewReader("id,order\n1,a\n"))
+	if _, err := c.Append("public", "Visits", schema, cr); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unquoted names of the table and the copy name the same table.
+	if _, ok := b.tables["public.visits"]; !ok {
+		t.Errorf("expected table public.visits, got: %v", b.tables)
+	}
+
+	if stmts := b.executed(`COPY public.visits (id, "order") FROM STDIN`); len(stmts) == 0 {
+		t.Errorf("expected copy into public.visits, got: %v", b.executed("COPY"))
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	var buf bytes.Buffer
+
+	c := New(db)
+	c.Rejects = NewRejectWriter(&buf, ',')
+
+	const loads = 8
+
+	errs := make([]error, loads)
+	wg := &sync.WaitGroup{}
+
+	// The loads share the schema, which they do not change.
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text", Nullable: true},
+			{Name: "age", Type: "integer", Coerce: profile.IntType, Nullable: true},
+			{Name: "status", Type: "text", Enum: []string{"new"}},
+		},
+	}
+
+	for i := 0; i < loads; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			// The rows with a null id are rejected and the ages that are
+			// not integers are coerced. The loads are long enough to
+			// overlap.
+			input := "id,name,age,status\n" + strings.Repeat("1,Joe,x,new\n,Bob,2,new\n", 1000)
+			cr := csv.NewReader(strings.NewReader(input))
+
+			table := fmt.Sprintf("people_%d", i)
+
+			load := c.Replace
+			if i%2 == 1 {
+				load = c.Append
+			}
+
+			var n int64
+			if n, errs[i] = load("public", table, schema, cr); errs[i] == nil && n != 1000 {
+				errs[i] = fmt.Errorf("%s: expected 1000 rows, got %d", table, n)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < loads; i++ {
+		table := fmt.Sprintf("people_%d", i)
+
+		if rows := b.copied("public", table); len(rows) != 1000 {
+			t.Errorf("expected 1000 rows in %s, got %v", table, rows)
+		}
+
+		// Each table has a column of its own enum type.
+		if ddl := b.executed(`"status" "public"."` + enumTypeName(table, "status") + `"`); len(ddl) != 1 {
+			t.Errorf("expected a column of the enum type of %s, got %v", table, ddl)
+		}
+	}
+
+	if f := schema.Fields[2]; f.Coerced != 0 || schema.Fields[3].Type != "text" || schema.Partitions != nil {
+		t.Errorf("expected the schema to be left as is, got %+v", schema)
+	}
+
+	if n := c.Rejects.Count(); n != 1000*loads {
+		t.Errorf("expected %d rejected rows, got %d", 1000*loads, n)
+	}
+
+	if err := c.Rejects.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The headers and rejected rows of the loads are interleaved, but
+	// each is written whole.
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1001*loads {
+		t.Errorf("expected %d rejects records, got %d", 1001*loads, len(records))
+	}
+
+	if c.Timings().Copy == 0 {
+		t.Error("expected copy timings of the loads")
+	}
+}
+
+func TestCleanIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"":             "",
+		"id":           "id",
+		"Visit Date":   "visit_date",
+		"visit.date":   "visit_date",
+		"a+-.b":        "a_b",
+		"a - b":        "a___b",
+		"1st_visit":    "1st_visit",
+		"2019":         "2019",
+		"%%%":          "_",
+		"...":          "_",
+		"_id_":         "_id_",
+		"Café":         "caf_",
+		"ÉCOLE":        "_cole",
+		"名前":           "_",
+		"naïve résumé": "na_ve_r_sum_",
+		"\xff\xfe":     "_",
+	}
+
+	for v, expected := range tests {
+		if n := CleanIdentifier(v); n != expected {
+			t.Errorf("%q: expected %q, got %q", v, expected, n)
+		}
+	}
+
+	// Distinct names may clean to the same one.
+	for _, v := range []string{"Visit Date", "visit-date", "VISIT_DATE", "visit+date", "visit$date"} {
+		if n := CleanIdentifier(v); n != "visit_date" {
+			t.Errorf("%q: expected visit_date, got %q", v, n)
+		}
+	}
+}
+
+func FuzzCleanIdentifier(f *testing.F) {
+	for _, v := range []string{"", "Visit Date", "1st", "%%%", "a+-.b", "Café", "名前", "\xff"} {
+		f.Add(v)
+	}
+
+	f.Fuzz(func(t *testing.T, v string) {
+		n := CleanIdentifier(v)
+
+		if (n == "") != (v == "") {
+			t.Fatalf("%q: expected an empty name only for an empty input, got %q", v, n)
+		}
+
+		for _, r := range n {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+				t.Fatalf("%q: unexpected character %q in %q", v, r, n)
+			}
+		}
+
+		if c := CleanIdentifier(n); c != n {
+			t.Fatalf("%q: expected %q to be clean, got %q", v, n, c)
+		}
+	})
+}
+
+func TestFieldValueFractionalSeconds(t *testing.T) {
+	f := &Field{Name: "seen", Type: sqlTypeMap[profile.DateTimeType]}
+
+	tests := map[string]string{
+		"2020-01-01T10:00:00.123Z":    "2020-01-01 10:00:00.123",
+		"2020-01-01T10:00:00.123456Z": "2020-01-01 10:00:00.123456",
+		"2020-01-01T10:00:00Z":        "2020-01-01 10:00:00",
+	}
+
+	for v, expected := range tests {
+		if got := fieldValue(f, v, nil); got != expected {
+			t.Errorf("%s: expected %s, got %v", v, expected, got)
+		}
+	}
+}
+
+func TestMatchesTypeIntegers(t *testing.T) {
+	tests := []struct {
+		Type     string
+		Value    string
+		Expected bool
+	}{
+		{"integer", "2147483647", true},
+		{"integer", "2155551234", false},
+		{BigInt, "2155551234", true},
+		{BigInt, "9223372036854775808", false},
+	}
+
+	for _, test := range tests {
+		if ok := matchesType(&Field{Type: test.Type}, test.Value); ok != test.Expected {
+			t.Errorf("%s %s: expected %t, got %t", test.Type, test.Value, test.Expected, ok)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package csv
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -9,27 +11,68 @@ import (
 )
 
 type Profiler struct {
-	Config    *profile.Config
+	Config *profile.Config
+
+	// Delimiter separates the fields. It must be ASCII, since fields are
+	// split on bytes and other bytes are part of multibyte characters.
 	Delimiter byte
 	Header    bool
 
+	// HeaderDelimiter is the delimiter of the header if it differs from
+	// the delimiter of the records. The Delimiter is used if zero.
+	HeaderDelimiter byte
+
+	// TypeHints is true if the header is followed by a line of the types
+	// of the fields, such as int,string,date. Fields with a hint are given
+	// its type if the values match it. Empty hints are inferred.
+	TypeHints bool
+
+	// HeaderOnly profiles only the header and the type hints, ignoring
+	// any records. Fields without a hint have an unknown type.
+	HeaderOnly bool
+
+	// Maximum size of a line in bytes.
+	MaxLineSize int
+
+	// Split splits the input into records, such as SplitRecords for
+	// records terminated by a byte other than a newline. It defaults to
+	// splitting by line.
+	Split bufio.SplitFunc
+
 	in io.Reader
 }
 
 func (x *Profiler) Profile() (*profile.Profile, error) {
 	p := profile.NewProfiler(x.Config)
-	cr := NewCSVReader(x.in, x.Delimiter)
 
-	// First record, may be the header.
+	sep := x.Delimiter
+	if x.Header && x.HeaderDelimiter != 0 {
+		sep = x.HeaderDelimiter
+	}
+
+	cr := NewCSVReader(x.in, sep)
+	if x.MaxLineSize > 0 {
+		cr.MaxLineSize = x.MaxLineSize
+	}
+	cr.Split = x.Split
+
+	// First record, may be the header. Blank lines are skipped, so
+	// the input is empty if there is none.
 	record, err := cr.Read()
+	if err == io.EOF || err == nil && len(record) == 0 {
+		return nil, profile.ErrNoColumns
+	}
 	if err != nil {
-		return nil, err
+		return nil, cr.parseError(err)
 	}
 
+	// Remaining records use the record delimiter.
+	cr.sep = x.Delimiter
+
 	header := make([]string, len(record))
 	if x.Header {
 		for i, n := range record {
-			header[i] = strings.ToLower(n)
+			header[i] = x.Config.FieldName(n)
 		}
 	} else {
 		for i, _ := range record {
@@ -41,57 +84,139 @@ func (x *Profiler) Profile() (*profile.Profile, error) {
 		p.InitField(c)
 	}
 
-	// Profile first record.
-	if !x.Header {
-		for i, field := range header {
-			val := record[i]
+	if err := profile.Err(p); err != nil {
+		return nil, err
+	}
 
-			// Treat empty strings as a null value.
-			if val == "" {
-				p.RecordType(field, nil, profile.NullType)
-			} else {
-				p.Record(field, val)
-			}
+	var hints []profile.ValueType
+	if x.Header && x.TypeHints {
+		if hints, err = readTypeHints(cr, len(header)); err != nil {
+			return nil, err
 		}
-
-		p.Incr()
 	}
 
-	// Continue with remaining records.
-	for {
-		err := cr.ScanLine(record)
-		if err == io.EOF {
+	// The first record was read already if it is not the header.
+	for n := int64(0); !x.HeaderOnly; n++ {
+		skip, stop := x.Config.Window(n)
+		if stop {
 			break
 		}
 
-		if err != nil {
-			return nil, err
+		if x.Header || n > 0 {
+			err := cr.ScanLine(record)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				return nil, cr.parseError(err)
+			}
 		}
 
-		for i, field := range header {
-			val := record[i]
+		if skip {
+			continue
+		}
 
-			// Treat empty strings as a null value.
-			if val == "" {
-				p.RecordType(field, nil, profile.NullType)
-			} else {
-				p.Record(field, val)
-			}
+		for i, field := range header {
+			p.Record(field, record[i])
 		}
 
 		p.Incr()
+
+		if err := profile.Err(p); err != nil {
+			return nil, err
+		}
 	}
 
 	pf := p.Profile()
 
-	// Set the index of the field.
-	for idx, name := range header {
-		pf.Fields[name].Index = idx
+	// Set the index of the field among those not excluded. Every record
+	// contains every field.
+	var idx int
+	for _, name := range header {
+		if f, ok := pf.Fields[name]; ok {
+			f.Index = idx
+			f.Count = pf.RecordCount
+			idx++
+		}
+	}
+
+	for i, t := range hints {
+		if f, ok := pf.Fields[header[i]]; ok {
+			if err := applyTypeHint(f, t); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return pf, nil
 }
 
+// Type names accepted in hints in addition to those of profile.ParseType.
+var typeHintAliases = map[string]profile.ValueType{
+	"int":       profile.IntType,
+	"text":      profile.StringType,
+	"bool":      profile.BoolType,
+	"timestamp": profile.DateTimeType,
+}
+
+// readTypeHints reads the line of type hints following the header.
+func readTypeHints(cr *CSVReader, n int) ([]profile.ValueType, error) {
+	record, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("type hints line is missing")
+	}
+	if err != nil {
+		return nil, cr.parseError(err)
+	}
+
+	if len(record) != n {
+		return nil, fmt.Errorf("expected %d type hints, got %d", n, len(record))
+	}
+
+	hints := make([]profile.ValueType, n)
+
+	for i, s := range record {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+
+		t, ok := typeHintAliases[s]
+		if !ok {
+			if t, ok = profile.ParseType(s); !ok || t == profile.ObjectType || t == profile.ArrayType {
+				return nil, fmt.Errorf("type hint not supported: %s", s)
+			}
+		}
+
+		hints[i] = t
+	}
+
+	return hints, nil
+}
+
+// applyTypeHint sets the type of the field to the hint if the values
+// match it, that is the inferred type generalizes to the hint.
+func applyTypeHint(f *profile.Field, t profile.ValueType) error {
+	if t == profile.UnknownType || f.Type == t {
+		return nil
+	}
+
+	// No values were profiled.
+	if f.Type == profile.UnknownType {
+		f.Type = t
+		return nil
+	}
+
+	if profile.GeneralizeType(f.Type, t) != t {
+		return fmt.Errorf("field %s: %s values do not match the type hint %s", f.Name, f.Type, t)
+	}
+
+	f.Type = t
+
+	return nil
+}
+
 func NewProfiler(r io.Reader) *Profiler {
 	return &Profiler{
 		Delimiter: ',',
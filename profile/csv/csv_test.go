@@ -2,6 +2,8 @@ package csv
 
 import (
 	"bytes"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/chop-dbhi/sql-importer/profile"
@@ -28,3 +30,177 @@ Joe,,2010-02-11
 		t.Errorf("expected date type, got %s", p.Fields["dob"].Type)
 	}
 }
+
+func TestProfilerHeaderDelimiter(t *testing.T) {
+	b := bytes.NewBufferString(`name|age|dob
+John,30,2013-03-11
+Jane,25,2008-02-24
+`)
+
+	pr := NewProfiler(b)
+	pr.HeaderDelimiter = '|'
+
+	p, err := pr.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(p.Fields))
+	}
+
+	if p.Fields["age"].Type != profile.IntType {
+		t.Errorf("expected int type, got %s", p.Fields["age"].Type)
+	}
+
+	if p.Fields["dob"].Type != profile.DateType {
+		t.Errorf("expected date type, got %s", p.Fields["dob"].Type)
+	}
+}
+
+func TestProfilerHeaderOnly(t *testing.T) {
+	b := bytes.NewBufferString(`zip,age,dob
+,int,date
+01234,thirty,2013-03-11
+`)
+
+	pr := NewProfiler(b)
+	pr.TypeHints = true
+	pr.HeaderOnly = true
+
+	p, err := pr.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.RecordCount != 0 {
+		t.Errorf("expected no records, got %d", p.RecordCount)
+	}
+
+	expected := map[string]profile.ValueType{
+		"zip": profile.UnknownType,
+		"age": profile.IntType,
+		"dob": profile.DateType,
+	}
+
+	for n, typ := range expected {
+		if f := p.Fields[n]; f.Type != typ {
+			t.Errorf("expected %s type for %s, got %s", typ, n, f.Type)
+		}
+	}
+}
+
+func TestProfilerTypeHints(t *testing.T) {
+	b := bytes.NewBufferString(`zip,age,dob
+string,,date
+01234,30,2013-03-11
+19104,25,2008-02-24
+`)
+
+	pr := NewProfiler(b)
+	pr.TypeHints = true
+
+	p, err := pr.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.RecordCount != 2 {
+		t.Errorf("expected 2 records, got %d", p.RecordCount)
+	}
+
+	if p.Fields["zip"].Type != profile.StringType {
+		t.Errorf("expected string type, got %s", p.Fields["zip"].Type)
+	}
+
+	if p.Fields["age"].Type != profile.IntType {
+		t.Errorf("expected inferred int type, got %s", p.Fields["age"].Type)
+	}
+
+	if p.Fields["dob"].Type != profile.DateType {
+		t.Errorf("expected date type, got %s", p.Fields["dob"].Type)
+	}
+
+	// Values that do not match the hint.
+	b = bytes.NewBufferString("name,age\nint,int\nJohn,30\n")
+
+	pr = NewProfiler(b)
+	pr.TypeHints = true
+
+	if _, err := pr.Profile(); err == nil || !strings.Contains(err.Error(), "type hint") {
+		t.Errorf("expected type hint error, got %v", err)
+	}
+}
+
+func TestProfilerNoColumns(t *testing.T) {
+	for _, s := range []string{"", "\n", "\r\n\n"} {
+		_, err := NewProfiler(bytes.NewBufferString(s)).Profile()
+		if err != profile.ErrNoColumns {
+			t.Errorf("%q: expected no columns error, got %v", s, err)
+		}
+	}
+}
+
+func TestProfilerMissing(t *testing.T) {
+	b := bytes.NewBufferString(`name,color,empty
+John,Blue,
+Jane,,
+Joe,Red,
+`)
+
+	pr := NewProfiler(b)
+	p, err := pr.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	color := p.Fields["color"]
+
+	if !color.Missing {
+		t.Error("expected color to be missing values")
+	}
+
+	if color.Nullable {
+		t.Error("expected color to not be nullable")
+	}
+
+	if color.Type != profile.StringType {
+		t.Errorf("expected string type, got %s", color.Type)
+	}
+
+	if p.Fields["empty"].Type != profile.NullType {
+		t.Errorf("expected null type for empty column, got %s", p.Fields["empty"].Type)
+	}
+}
+
+func TestProfilerLimits(t *testing.T) {
+	input := `id,name,color
+1,John,Blue
+2,Jane,Red
+3,Joe,Red
+`
+
+	tests := map[string]struct {
+		Config profile.Config
+		Err    error
+	}{
+		"records":          {profile.Config{MaxRecords: 3}, nil},
+		"records-exceeded": {profile.Config{MaxRecords: 2}, profile.ErrTooManyRecords},
+		"fields":           {profile.Config{MaxFields: 3}, nil},
+		"fields-exceeded":  {profile.Config{MaxFields: 2}, profile.ErrTooManyFields},
+		"values":           {profile.Config{MaxValues: 3}, nil},
+		"values-exceeded":  {profile.Config{MaxValues: 2}, profile.ErrTooManyValues},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pr := NewProfiler(bytes.NewBufferString(input))
+			pr.Config = &test.Config
+
+			_, err := pr.Profile()
+			if !errors.Is(err, test.Err) {
+				t.Errorf("expected error %v, got %v", test.Err, err)
+			}
+		})
+	}
+}
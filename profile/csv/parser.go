@@ -2,13 +2,15 @@ package csv
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
 )
 
 const (
 	// 8 times default scanner buffer size.
-	scanBufSize = 8 * 64 * 1024
+	DefaultMaxLineSize = 8 * 64 * 1024
 )
 
 var (
@@ -18,6 +20,40 @@ var (
 	csvErrExtraColumns      = errors.New("extra columns")
 )
 
+// ParseError is returned by the profiler if a record cannot be parsed. The
+// line and column are 1-based. Like LineNumber, the skipped blank lines
+// are not counted.
+type ParseError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns the error with the position of the current field.
+func (s *CSVReader) parseError(err error) error {
+	if _, ok := err.(*ParseError); ok || err == io.EOF {
+		return err
+	}
+
+	return &ParseError{
+		Line:   s.lineno,
+		Column: s.column,
+		Err:    err,
+	}
+}
+
 func clearRow(row []string) {
 	for i, _ := range row {
 		row[i] = ""
@@ -36,6 +72,16 @@ type CSVReader struct {
 	// handle the error.
 	ContinueOnError bool
 
+	// MaxLineSize is the maximum size of a line in bytes. It must be set
+	// before the first call to Scan.
+	MaxLineSize int
+
+	// Split splits the input into records. It defaults to splitting by
+	// line and must be set before the first call to Scan.
+	Split bufio.SplitFunc
+
+	started bool
+
 	sep    byte // values separator
 	eor    bool // true when the most recent field has been terminated by a newline (not a separator).
 	lineno int  // current line number (not record number)
@@ -50,9 +96,34 @@ type CSVReader struct {
 	token []byte
 	data  []byte
 
+	// True when the line ended with a separator, so an empty field
+	// remains to be returned as the last field of the record.
 	trail bool
 }
 
+// SplitRecords returns a split function for records terminated by the
+// separator rather than a newline, such as the ASCII record separator
+// (0x1e) or a null byte. The separator is dropped and the last record
+// need not be terminated.
+func SplitRecords(sep byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF {
+			return len(data), data, nil
+		}
+
+		// Request more data.
+		return 0, nil, nil
+	}
+}
+
 // DefaultReader creates a "standard" CSV reader.
 func DefaultCSVReader(rd io.Reader) *CSVReader {
 	return NewCSVReader(rd, ',')
@@ -67,9 +138,9 @@ func NewCSVReader(r io.Reader, sep byte) *CSVReader {
 		sc:  bufio.NewScanner(r),
 		sep: sep,
 		eor: true,
-	}
 
-	s.sc.Buffer(nil, scanBufSize)
+		MaxLineSize: DefaultMaxLineSize,
+	}
 
 	return s
 }
@@ -102,6 +173,12 @@ func (s *CSVReader) EndOfRecord() bool {
 // Err returns an error if one occurred during scanning.
 func (s *CSVReader) Err() error {
 	if err := s.sc.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return &ParseError{
+				Line: s.lineno + 1,
+				Err:  fmt.Errorf("exceeds the maximum line size of %d bytes", s.MaxLineSize),
+			}
+		}
 		return err
 	}
 
@@ -168,6 +245,14 @@ func (s *CSVReader) ScanLine(r []string) error {
 }
 
 func (s *CSVReader) Scan() bool {
+	if !s.started {
+		s.sc.Buffer(nil, s.MaxLineSize)
+		if s.Split != nil {
+			s.sc.Split(s.Split)
+		}
+		s.started = true
+	}
+
 	// Error.
 	if s.err != nil && !s.ContinueOnError {
 		return false
@@ -238,7 +323,8 @@ func (s *CSVReader) Scan() bool {
 }
 
 func (s *CSVReader) scanField(data []byte) (int, []byte, bool, error) {
-	// Special case.
+	// The previous field ended the line with a separator, such as the
+	// second one of "a,,". The empty field after it ends the record.
 	if s.trail {
 		s.column++
 		s.eor = true
@@ -300,6 +300,54 @@ func TestCSVExtraColumns(t *testing.T) {
 	}
 }
 
+func TestCSVEmptyFields(t *testing.T) {
+	tests := []struct {
+		in   string
+		toks []string
+	}{
+		{"a,,b", []string{"a", "", "b"}},
+		{"a,,", []string{"a", "", ""}},
+		{",,", []string{"", "", ""}},
+		{"a,,\n", []string{"a", "", ""}},
+		{",,\n,,", []string{"", "", "", "", "", ""}},
+		{`"a",,`, []string{"a", "", ""}},
+	}
+
+	for _, test := range tests {
+		cr := DefaultCSVReader(bytes.NewBufferString(test.in))
+
+		var i int
+
+		for ; cr.Scan(); i++ {
+			if i == len(test.toks) {
+				t.Errorf("%q: scan exceeded %d tokens", test.in, i)
+				break
+			}
+
+			if tok := cr.Text(); tok != test.toks[i] {
+				t.Errorf("%q: token %d: expected %q, got %q", test.in, i, test.toks[i], tok)
+			}
+
+			// Every record is three fields.
+			if eor := i%3 == 2; cr.EndOfRecord() != eor {
+				t.Errorf("%q: token %d: expected end of record %v", test.in, i, eor)
+			}
+
+			if c := i%3 + 1; cr.ColumnNumber() != c {
+				t.Errorf("%q: token %d: expected column %d, got %d", test.in, i, c, cr.ColumnNumber())
+			}
+		}
+
+		if err := cr.Err(); err != io.EOF {
+			t.Errorf("%q: unexpected error: %s", test.in, err)
+		}
+
+		if i != len(test.toks) {
+			t.Errorf("%q: expected %d tokens, got %d", test.in, len(test.toks), i)
+		}
+	}
+}
+
 var line = `"3","\PCORI\VITAL\TOBACCO\SMOKING\","Smoked Tobacco","N","FAE",,,,"concept_cd","CONCEPT_DIMENSION","concept_path","T","like","\PCORI\VITAL\TOBACCO\SMOKING\","CDMv2","This field is new to v3.0. Indicator for any form of tobacco that is smoked.Per Meaningful Use guidance, smoking status includes any form of tobacco that is smoked, but not all tobacco use. ""Light smoker"" is interpreted to mean less than 10 cigarettes per day, or an equivalent (but less concretely defined) quantity of cigar or pipe smoke. ""Heavy smoker"" is interpreted to mean greater than 10 cigarettes per day or an equivalent (but less concretely defined) quantity of cigar or pipe smoke. ","@","2015-08-20 312:14:14.0","2015-08-20 12:14:14.0","2015-08-20 12:14:14.0","PCORNET_CDM",,,"\PCORI\VITAL\TOBACCO\","SMOKING"` + "\n"
 
 func BenchmarkCSVReaderScan(b *testing.B) {
@@ -315,3 +363,90 @@ func BenchmarkCSVReaderScan(b *testing.B) {
 		}
 	}
 }
+
+func TestCSVSplitRecords(t *testing.T) {
+	for _, sep := range []byte{0, 0x1e} {
+		data := strings.Join([]string{"name,note", "Joe,\"a\nb\"", "", "Sue,c"}, string(sep))
+
+		cr := DefaultCSVReader(bytes.NewBufferString(data))
+		cr.Split = SplitRecords(sep)
+
+		var rows [][]string
+
+		for {
+			row, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatalf("%#x: unexpected error: %s", sep, err)
+			}
+
+			rows = append(rows, row)
+		}
+
+		// Newlines are part of the values and empty records are skipped.
+		exp := [][]string{
+			{"name", "note"},
+			{"Joe", "a\nb"},
+			{"Sue", "c"},
+		}
+
+		if len(rows) != len(exp) {
+			t.Fatalf("%#x: expected %d records, got %q", sep, len(exp), rows)
+		}
+
+		for i, row := range exp {
+			if !compareRows(row, rows[i]) {
+				t.Errorf("%#x: record %d: expected %q, got %q", sep, i, row, rows[i])
+			}
+		}
+	}
+}
+
+func TestCSVMaxLineSize(t *testing.T) {
+	long := strings.Repeat("x", DefaultMaxLineSize+1)
+	data := "name,value\nshort,1\nlong," + long + "\n"
+
+	cr := DefaultCSVReader(bytes.NewBufferString(data))
+	row := make([]string, 2)
+
+	var err error
+	for err == nil {
+		err = cr.ScanLine(row)
+	}
+
+	if err == io.EOF {
+		t.Fatal("expected line size error")
+	}
+
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected error to name the line, got: %s", err)
+	}
+
+	cr = DefaultCSVReader(bytes.NewBufferString(data))
+	cr.MaxLineSize = 2 * DefaultMaxLineSize
+
+	var n int
+	for {
+		err = cr.ScanLine(row)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		n++
+	}
+
+	if n != 3 {
+		t.Errorf("expected 3 lines, got %d", n)
+	}
+
+	if row[1] != long {
+		t.Errorf("expected long value of %d bytes, got %d", len(long), len(row[1]))
+	}
+}
@@ -1,43 +1,117 @@
 package json
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	"github.com/chop-dbhi/sql-importer/profile"
 )
 
+// DefaultSeparator joins the keys of nested objects into field names.
+const DefaultSeparator = "_"
+
 type analyzer struct {
-	p profile.Profiler
+	p        profile.Profiler
+	config   *profile.Config
+	sep      string
+	maxDepth int
+
+	// Fields in the order they were first seen and the number of
+	// records containing them.
+	order  []string
+	counts map[string]int64
+}
+
+// record records the value of a field in the current record.
+func (a *analyzer) record(fp string, value interface{}, t profile.ValueType) {
+	a.count(fp)
+	a.p.RecordType(fp, value, t)
+}
+
+// count counts the field as present in the current record.
+func (a *analyzer) count(fp string) {
+	n := a.config.FieldName(fp)
+
+	if _, ok := a.counts[n]; !ok {
+		a.order = append(a.order, n)
+	}
+
+	a.counts[n]++
+}
+
+// recordArray records the array with the type of its elements. Nested
+// objects or arrays are typed as objects.
+func (a *analyzer) recordArray(fp string, x []interface{}) {
+	a.count(fp)
+
+	elem := profile.NullType
+
+	for _, v := range x {
+		var t profile.ValueType
+
+		switch e := v.(type) {
+		case nil:
+			continue
+		case bool:
+			t = profile.BoolType
+		case string:
+			t = profile.StringType
+		case json.Number:
+			if _, err := e.Int64(); err == nil {
+				t = profile.IntType
+			} else if isInteger(e) {
+				t = profile.StringType
+			} else {
+				t = profile.FloatType
+			}
+		default:
+			t = profile.ObjectType
+		}
+
+		elem = profile.GeneralizeElemType(elem, t)
+	}
+
+	// Profilers that do not type arrays record them as their JSON text.
+	ar, ok := a.p.(profile.ArrayRecorder)
+	if !ok {
+		a.p.RecordType(fp, FormatValue(x), profile.StringType)
+		return
+	}
+
+	ar.RecordArray(fp, x, elem)
 }
 
-func (a *analyzer) parseField(path, field string, value interface{}) {
+func (a *analyzer) parseField(path, field string, value interface{}, depth int) error {
 	fp := fmt.Sprintf("%s%s", path, field)
 
 	switch x := value.(type) {
 	case nil:
-		a.p.RecordType(fp, nil, profile.NullType)
+		a.record(fp, nil, profile.NullType)
 
-	// Nested object.
+	// Nested object. Objects beyond the maximum depth are not flattened.
 	case map[string]interface{}:
-		a.parseMap(fp+"/", x)
+		if a.maxDepth > 0 && depth >= a.maxDepth {
+			a.record(fp, FormatValue(x), profile.ObjectType)
+		} else {
+			return a.parseMap(fp+a.sep, x, depth+1)
+		}
 
-	// Array.
+	// Arrays of scalars are typed by their elements.
 	case []interface{}:
-		for _, v := range x {
-			a.parseField(path, field, v)
-		}
+		a.recordArray(fp, x)
 
 	case bool:
-		a.p.RecordType(fp, x, profile.BoolType)
+		a.record(fp, x, profile.BoolType)
 
 	case string:
 		var t profile.ValueType
 
-		if _, ok := profile.ParseDate(x); ok {
+		if x == "" {
+			t = profile.NullType
+		} else if _, ok := profile.ParseDate(x); ok {
 			t = profile.DateType
 		} else if _, ok := profile.ParseDateTime(x); ok {
 			t = profile.DateTimeType
@@ -45,102 +119,167 @@ func (a *analyzer) parseField(path, field string, value interface{}) {
 			t = profile.StringType
 		}
 
-		a.p.RecordType(fp, x, t)
+		a.record(fp, x, t)
 
 	case json.Number:
 		if v, err := x.Int64(); err == nil {
-			a.p.RecordType(fp, v, profile.IntType)
+			a.record(fp, v, profile.IntType)
+		} else if isInteger(x) {
+			// Integers too large for int64 are kept as text rather than
+			// losing precision as floats.
+			a.record(fp, x.String(), profile.StringType)
 		} else if v, err := x.Float64(); err == nil {
-			a.p.RecordType(fp, v, profile.FloatType)
+			a.record(fp, v, profile.FloatType)
 		} else {
-			panic("could not parse JSON number")
+			return fmt.Errorf("field %s: could not parse JSON number: %s", fp, x)
 		}
 
 	default:
-		panic(fmt.Sprintf("unsupported type: %#T", value))
+		return fmt.Errorf("field %s: unsupported type %T: %v", fp, value, value)
 	}
-}
 
-// types are identified relative to the path.
-func (a *analyzer) parseMap(path string, m map[string]interface{}) {
-	for k, v := range m {
-		a.parseField(path, k, v)
-	}
+	return nil
 }
 
-func (a *analyzer) parseLDJSON(r io.Reader) error {
-	s := bufio.NewScanner(r)
-
-	// Initialize buffer and JSON decoder.
-	var b bytes.Buffer
-	dec := json.NewDecoder(&b)
-	dec.UseNumber()
+// isInteger returns true if the number is an integer, regardless of size.
+func isInteger(x json.Number) bool {
+	s := strings.TrimPrefix(x.String(), "-")
+	if s == "" {
+		return false
+	}
 
-	for s.Scan() {
-		line := bytes.TrimSpace(s.Bytes())
-		if len(line) == 0 {
-			continue
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
 		}
+	}
 
-		b.Reset()
-		b.Write(line)
+	return true
+}
 
-		var m map[string]interface{}
-		if err := dec.Decode(&m); err != nil {
+// types are identified relative to the path. Keys are visited in sorted
+// order so fields are ordered consistently.
+func (a *analyzer) parseMap(path string, m map[string]interface{}, depth int) error {
+	for _, k := range sortedKeys(m) {
+		if err := a.parseField(path, k, m[k], depth); err != nil {
 			return err
 		}
+	}
 
-		a.parseMap("", m)
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
+}
+
+type Profiler struct {
+	Config *profile.Config
+
+	// Format is either json or ldjson.
+	Format string
+
+	// Separator joins the keys of nested objects, such as address_zip.
+	// It defaults to DefaultSeparator.
+	Separator string
 
-	return s.Err()
+	// MaxDepth is the number of levels of nested objects that are
+	// flattened. Objects nested deeper are profiled as objects. There
+	// is no limit if zero.
+	MaxDepth int
+
+	in io.Reader
 }
 
-func (a *analyzer) parseJSON(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	dec.UseNumber()
+func (x *Profiler) Profile() (*profile.Profile, error) {
+	p := profile.NewProfiler(x.Config)
 
-	tok, err := dec.Token()
-	if err != nil {
-		return err
+	a := analyzer{
+		p:        p,
+		config:   x.Config,
+		sep:      x.Separator,
+		maxDepth: x.MaxDepth,
+		counts:   make(map[string]int64),
 	}
 
-	if tok != json.Delim('[') {
-		return fmt.Errorf("expected array, got: %v", tok)
+	if a.sep == "" {
+		a.sep = DefaultSeparator
 	}
 
-	// More elements in the array.
-	for dec.More() {
-		var m map[string]interface{}
-		if err := dec.Decode(&m); err != nil {
-			return err
+	r, err := NewReader(x.in, x.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	var records int64
+
+	for n := int64(0); ; n++ {
+		skip, stop := x.Config.Window(n)
+		if stop {
+			break
 		}
 
-		a.parseMap("", m)
-	}
+		m, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 
-	return nil
-}
+		if skip {
+			continue
+		}
 
-func Profile(config *profile.Config, in io.Reader, format string) (*profile.Profile, error) {
-	p := profile.NewProfiler(config)
+		if err := a.parseMap("", m, 0); err != nil {
+			return nil, err
+		}
+		p.Incr()
+		records++
 
-	a := analyzer{
-		p: p,
+		if err := profile.Err(p); err != nil {
+			return nil, err
+		}
 	}
 
-	var err error
+	// Fields absent from some records are loaded as nulls.
+	for _, n := range a.order {
+		if a.counts[n] < records {
+			p.Record(n, "")
+		}
+	}
 
-	switch format {
-	case "ldjson":
-		err = a.parseLDJSON(in)
-	case "json":
-		err = a.parseJSON(in)
+	pf := p.Profile()
+
+	// Set the index of the field in the order first seen and the
+	// number of records containing it.
+	var idx int
+	for _, n := range a.order {
+		if f, ok := pf.Fields[n]; ok {
+			f.Index = idx
+			f.Count = a.counts[n]
+			idx++
+		}
 	}
 
-	if err != nil {
-		return nil, err
+	return pf, nil
+}
+
+func NewProfiler(r io.Reader, format string) *Profiler {
+	return &Profiler{
+		Format: format,
+		in:     r,
 	}
+}
 
-	return p.Profile(), nil
+// Profile profiles the input using the default separator.
+func Profile(config *profile.Config, in io.Reader, format string) (*profile.Profile, error) {
+	p := NewProfiler(in, format)
+	p.Config = config
+	return p.Profile()
 }
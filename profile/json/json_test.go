@@ -2,7 +2,10 @@ package json
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
+
+	"github.com/chop-dbhi/sql-importer/profile"
 )
 
 func TestProfileJSON(t *testing.T) {
@@ -36,3 +39,212 @@ func TestProfileLDJSON(t *testing.T) {
 		t.Errorf("expected 3 fields, got %d", len(p.Fields))
 	}
 }
+
+func TestProfileFieldCounts(t *testing.T) {
+	b := bytes.NewBufferString(`
+		{"id": 1, "name": "John", "address": {"zip": "19104"}}
+		{"id": 2, "name": "Jane"}
+		{"id": 3, "color": "Red"}
+		{"id": 4, "name": "Joe"}
+		`)
+
+	p, err := Profile(nil, b, "ldjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.RecordCount != 4 {
+		t.Errorf("expected 4 records, got %d", p.RecordCount)
+	}
+
+	counts := map[string]int64{
+		"id":          4,
+		"name":        3,
+		"color":       1,
+		"address_zip": 1,
+	}
+
+	for n, c := range counts {
+		f, ok := p.Fields[n]
+		if !ok {
+			t.Errorf("expected field %s", n)
+			continue
+		}
+
+		if f.Count != c {
+			t.Errorf("%s: expected count %d, got %d", n, c, f.Count)
+		}
+	}
+
+	sparse := p.SparseFields(0.5)
+	if len(sparse) != 2 || sparse[0] != "address_zip" || sparse[1] != "color" {
+		t.Errorf("expected address/zip and color to be sparse, got %v", sparse)
+	}
+}
+
+func TestProfileArrays(t *testing.T) {
+	b := bytes.NewBufferString(`
+		{"tags": ["a", "b"], "scores": [1, 2.5], "mixed": [1, "a"], "nested": [{"a": 1}]}
+		{"tags": [], "scores": [3], "mixed": [true], "nested": [[1]]}
+		`)
+
+	p, err := Profile(nil, b, "ldjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elems := map[string]profile.ValueType{
+		"tags":   profile.StringType,
+		"scores": profile.FloatType,
+		"mixed":  profile.ObjectType,
+		"nested": profile.ObjectType,
+	}
+
+	for n, e := range elems {
+		f := p.Fields[n]
+
+		if f.Type != profile.ArrayType {
+			t.Errorf("%s: expected array, got %s", n, f.Type)
+		}
+
+		if f.ElemType != e {
+			t.Errorf("%s: expected %s elements, got %s", n, e, f.ElemType)
+		}
+	}
+}
+
+func TestProfileSeparator(t *testing.T) {
+	data := `[{"address": {"zip": "19104", "geo": {"lat": 39.9}}}]`
+
+	p, err := Profile(nil, bytes.NewBufferString(data), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []string{"address_zip", "address_geo_lat"} {
+		if _, ok := p.Fields[n]; !ok {
+			t.Errorf("expected field %s", n)
+		}
+	}
+
+	x := NewProfiler(bytes.NewBufferString(data), "json")
+	x.Separator = "."
+
+	p, err = x.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.Fields["address.geo.lat"]; !ok {
+		t.Error("expected field address.geo.lat")
+	}
+}
+
+func TestProfileMaxDepth(t *testing.T) {
+	data := `[{"id": 1, "address": {"zip": "19104", "geo": {"lat": 39.9, "lng": -75.2}}}]`
+
+	x := NewProfiler(bytes.NewBufferString(data), "json")
+	x.MaxDepth = 1
+
+	p, err := x.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f, ok := p.Fields["address_zip"]; !ok || f.Type != profile.StringType {
+		t.Error("expected address_zip to be flattened")
+	}
+
+	f, ok := p.Fields["address_geo"]
+	if !ok {
+		t.Fatal("expected address_geo field")
+	}
+
+	if f.Type != profile.ObjectType {
+		t.Errorf("expected address_geo to be an object, got %s", f.Type)
+	}
+
+	if _, ok := p.Fields["address_geo_lat"]; ok {
+		t.Error("expected address_geo_lat to not be flattened")
+	}
+}
+
+func TestProfileJSONObject(t *testing.T) {
+	b := bytes.NewBufferString(`
+		{"name": "John", "color": "Blue"}
+	`)
+
+	p, err := Profile(nil, b, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.RecordCount != 1 {
+		t.Errorf("expected 1 record, got %d", p.RecordCount)
+	}
+
+	if len(p.Fields) != 2 {
+		t.Errorf("expected 2 fields, got %d", len(p.Fields))
+	}
+}
+
+func TestProfileJSONArrayOfArrays(t *testing.T) {
+	b := bytes.NewBufferString(`[["John", "Blue"], ["Jane", "Red"]]`)
+
+	_, err := Profile(nil, b, "json")
+	if err == nil || err.Error() != "expected an array of objects, got an array of arrays" {
+		t.Errorf("expected array of arrays error, got %v", err)
+	}
+}
+
+func TestProfileJSONTrailingData(t *testing.T) {
+	for _, in := range []string{
+		`{"name": "John"} {"name": "Jane"}`,
+		`[{"name": "John"}] x`,
+		`[{"name": "John"}`,
+	} {
+		if _, err := Profile(nil, bytes.NewBufferString(in), "json"); err == nil {
+			t.Errorf("expected error for %s", in)
+		}
+	}
+
+	// Whitespace may follow the value.
+	if _, err := Profile(nil, bytes.NewBufferString("[{\"name\": \"John\"}]\n\n"), "json"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestProfileBigInteger(t *testing.T) {
+	b := bytes.NewBufferString(`[{"id": 12345678901234567890, "n": 1}, {"id": 1, "n": -98765432109876543210}]`)
+
+	p, err := Profile(nil, b, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []string{"id", "n"} {
+		if typ := p.Fields[n].Type; typ != profile.StringType {
+			t.Errorf("%s: expected string, got %s", n, typ)
+		}
+	}
+}
+
+func TestParseFieldErrors(t *testing.T) {
+	tests := []map[string]interface{}{
+		// Not produced by the decoder.
+		{"count": 5},
+		{"address": map[string]interface{}{"zip": json.Number("1x")}},
+	}
+
+	for _, m := range tests {
+		a := analyzer{
+			p:      profile.NewProfiler(nil),
+			sep:    DefaultSeparator,
+			counts: make(map[string]int64),
+		}
+
+		if err := a.parseMap("", m, 0); err == nil {
+			t.Errorf("expected error for %v", m)
+		}
+	}
+}
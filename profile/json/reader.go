@@ -0,0 +1,243 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reader reads the objects of a JSON array or of newline-delimited JSON.
+// A JSON document containing a single object is read as one object. Data
+// other than whitespace after the array or object is an error.
+type Reader struct {
+	format string
+
+	// Newline-delimited JSON.
+	scanner *bufio.Scanner
+
+	// JSON array or object.
+	in      *bufio.Reader
+	dec     *json.Decoder
+	started bool
+	single  bool
+	done    bool
+}
+
+// NewReader returns a reader for the format, either json or ldjson.
+func NewReader(in io.Reader, format string) (*Reader, error) {
+	r := &Reader{
+		format: format,
+	}
+
+	switch format {
+	case "ldjson":
+		r.scanner = bufio.NewScanner(in)
+	case "json":
+		r.in = bufio.NewReader(in)
+	default:
+		return nil, fmt.Errorf("unsupported JSON format: %s", format)
+	}
+
+	return r, nil
+}
+
+// Read returns the next object. Numbers are decoded as json.Number. io.EOF
+// is returned when there are no more objects.
+func (r *Reader) Read() (map[string]interface{}, error) {
+	if r.scanner != nil {
+		return r.readLine()
+	}
+
+	return r.readElement()
+}
+
+func (r *Reader) readLine() (map[string]interface{}, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			return nil, err
+		}
+
+		return m, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+func (r *Reader) readElement() (map[string]interface{}, error) {
+	if !r.started {
+		r.started = true
+
+		c, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		r.dec = json.NewDecoder(r.in)
+		r.dec.UseNumber()
+
+		switch c {
+		case '{':
+			r.single = true
+
+		case '[':
+			if _, err := r.dec.Token(); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, fmt.Errorf("expected an array of objects or an object, got: %q", c)
+		}
+	}
+
+	if r.done {
+		return nil, io.EOF
+	}
+
+	if r.single {
+		var m map[string]interface{}
+		if err := r.dec.Decode(&m); err != nil {
+			return nil, err
+		}
+
+		if err := r.end(); err != io.EOF {
+			return nil, err
+		}
+
+		return m, nil
+	}
+
+	// No more elements in the array.
+	if !r.dec.More() {
+		return nil, r.end()
+	}
+
+	var v interface{}
+	if err := r.dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return x, nil
+	case []interface{}:
+		return nil, errors.New("expected an array of objects, got an array of arrays")
+	}
+
+	return nil, fmt.Errorf("expected an array of objects, got an element: %s", FormatValue(v))
+}
+
+// end consumes the end of the array, if any, and returns io.EOF if only
+// whitespace follows the top-level value, which would otherwise be
+// silently ignored.
+func (r *Reader) end() error {
+	r.done = true
+
+	if !r.single {
+		t, err := r.dec.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if t != json.Delim(']') {
+			return fmt.Errorf("expected the end of the array, got: %v", t)
+		}
+	}
+
+	r.in = bufio.NewReader(io.MultiReader(r.dec.Buffered(), r.in))
+
+	c, err := r.peek()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("unexpected data after the top-level JSON value: %q", c)
+}
+
+// peek returns the first byte that is not whitespace.
+func (r *Reader) peek() (byte, error) {
+	for {
+		c, err := r.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		return c, r.in.UnreadByte()
+	}
+}
+
+// Flatten returns the values of the object keyed by the same field names
+// used in the profile. The keys of nested objects are joined by the
+// separator and objects nested deeper than the maximum depth are kept as
+// values.
+func Flatten(m map[string]interface{}, sep string, maxDepth int) map[string]interface{} {
+	return FlattenNames(m, sep, maxDepth, strings.ToLower)
+}
+
+// FlattenNames flattens the object like Flatten with the keys converted
+// by the name function, such as profile.Config.FieldName.
+func FlattenNames(m map[string]interface{}, sep string, maxDepth int, name func(string) string) map[string]interface{} {
+	flat := make(map[string]interface{})
+	flatten(flat, "", sep, maxDepth, 0, m, name)
+	return flat
+}
+
+func flatten(flat map[string]interface{}, path, sep string, maxDepth, depth int, m map[string]interface{}, name func(string) string) {
+	for k, v := range m {
+		fp := name(path + k)
+
+		if x, ok := v.(map[string]interface{}); ok && (maxDepth == 0 || depth < maxDepth) {
+			flatten(flat, fp+sep, sep, maxDepth, depth+1, x, name)
+			continue
+		}
+
+		flat[fp] = v
+	}
+}
+
+// FormatValue encodes a decoded JSON value as a string. Nulls are encoded
+// as empty strings and arrays and objects as JSON.
+func FormatValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case json.Number:
+		return x.String()
+	}
+
+	b, _ := json.Marshal(v)
+	return string(b)
+}
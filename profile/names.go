@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// SnakeCase inserts underscores at the word boundaries of camelCase and
+// PascalCase names and lowercases them, so FirstName becomes first_name.
+// A run of capitals is treated as an acronym, so HTTPStatus becomes
+// http_status. Other separators are left as is.
+func SnakeCase(s string) string {
+	rs := []rune(s)
+
+	var b strings.Builder
+	b.Grow(len(s) + 4)
+
+	for i, r := range rs {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rs[i-1]
+
+			// The start of a word after a lowercase letter or digit, or
+			// the last capital of an acronym followed by a lowercase.
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(rs) && unicode.IsLower(rs[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// FieldName returns the name of the field as profiled. Names are
+// lowercased and converted to snake_case first if SnakeCase is set.
+func (c *Config) FieldName(n string) string {
+	if c != nil && c.SnakeCase {
+		return SnakeCase(n)
+	}
+
+	return strings.ToLower(n)
+}
+
+// fieldPattern returns the include or exclude pattern matched against the
+// field names. Patterns with wildcards are only lowercased since
+// converting them to snake_case could split them at the wildcards.
+func (c *Config) fieldPattern(p string) string {
+	if strings.ContainsAny(p, `*?[\`) {
+		return strings.ToLower(p)
+	}
+
+	return c.FieldName(p)
+}
+
+// matchField returns true if the name matches any of the patterns.
+// Malformed patterns match nothing.
+func matchField(patterns []string, n string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, n); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,34 @@
+package profile
+
+import "testing"
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		// camelCase
+		"firstName": "first_name",
+		"userId":    "user_id",
+		"zip5Code":  "zip5_code",
+
+		// PascalCase
+		"FirstName": "first_name",
+		"LastVisit": "last_visit",
+
+		// Acronym runs
+		"HTTPStatus": "http_status",
+		"userID":     "user_id",
+		"MyHTTP":     "my_http",
+		"ID":         "id",
+
+		// Unchanged apart from case.
+		"first_name": "first_name",
+		"first name": "first name",
+		"Pt-ID":      "pt-id",
+		"":           "",
+	}
+
+	for in, exp := range tests {
+		if out := SnakeCase(in); out != exp {
+			t.Errorf("%q: expected %q, got %q", in, exp, out)
+		}
+	}
+}
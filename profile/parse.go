@@ -24,41 +24,58 @@ var (
 		"2006-01-02T15:04:05Z",
 		"2006-01-02T15:04:05Z07:00",
 	}
+
+	// Boolean values recognized in addition to those of strconv.ParseBool.
+	boolVariants = map[string]bool{
+		"y":   true,
+		"yes": true,
+		"n":   false,
+		"no":  false,
+	}
 )
 
 func ParseBool(s string) (bool, bool) {
 	s = strings.TrimSpace(s)
 
 	b, err := strconv.ParseBool(s)
-	if err != nil {
-		return false, false
+	if err == nil {
+		return b, true
 	}
 
-	return b, true
+	b, ok := boolVariants[strings.ToLower(s)]
+	return b, ok
 }
 
 func ParseDate(s string) (time.Time, bool) {
-	s = strings.TrimSpace(s)
-
-	for _, layout := range dateFormats {
-		if v, err := time.Parse(layout, s); err == nil {
-			return v, true
-		}
-	}
+	v, _, ok := ParseDateLayout(s)
+	return v, ok
+}
 
-	return time.Time{}, false
+// ParseDateLayout parses a date and returns the layout that matched.
+func ParseDateLayout(s string) (time.Time, string, bool) {
+	return parseLayouts(s, dateFormats)
 }
 
 func ParseDateTime(s string) (time.Time, bool) {
+	v, _, ok := ParseDateTimeLayout(s)
+	return v, ok
+}
+
+// ParseDateTimeLayout parses a datetime and returns the layout that matched.
+func ParseDateTimeLayout(s string) (time.Time, string, bool) {
+	return parseLayouts(s, dateTimeFormats)
+}
+
+func parseLayouts(s string, layouts []string) (time.Time, string, bool) {
 	s = strings.TrimSpace(s)
 
-	for _, layout := range dateTimeFormats {
+	for _, layout := range layouts {
 		if v, err := time.Parse(layout, s); err == nil {
-			return v, true
+			return v, layout, true
 		}
 	}
 
-	return time.Time{}, false
+	return time.Time{}, "", false
 }
 
 func ParseFloat(s string) (float64, bool) {
@@ -76,3 +93,25 @@ func ParseInt(s string) (int64, bool) {
 	}
 	return i, true
 }
+
+// MatchType returns true if the value can be parsed as the type.
+func MatchType(s string, t ValueType) bool {
+	var ok bool
+
+	switch t {
+	case IntType:
+		_, ok = ParseInt(s)
+	case FloatType:
+		_, ok = ParseFloat(s)
+	case BoolType:
+		_, ok = ParseBool(s)
+	case DateType:
+		_, ok = ParseDate(s)
+	case DateTimeType:
+		_, ok = ParseDateTime(s)
+	case StringType:
+		ok = true
+	}
+
+	return ok
+}
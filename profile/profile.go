@@ -1,5 +1,10 @@
 package profile
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Field stores aggregation information and statistics for a field.
 type Field struct {
 	// Name of this field.
@@ -12,6 +17,9 @@ type Field struct {
 	// type counts array.
 	Type ValueType `json:"type"`
 
+	// Type of the elements if the field is an array.
+	ElemType ValueType `json:"elem_type,omitempty"`
+
 	// True if the field contains null values.
 	Nullable bool `json:"nullable"`
 
@@ -21,8 +29,47 @@ type Field struct {
 	// True if all values are unique.
 	Unique bool `json:"unique"`
 
+	// True if uniqueness was not tracked for all values, such as past
+	// the MaxUniqueValues of the profiler, so Unique is false without a
+	// duplicate having been seen.
+	UniqueUnknown bool `json:"unique_unknown,omitempty"`
+
 	// If true, at least one value has been detected to have a leading zero.
 	LeadingZeros bool `json:"leading_zeros"`
+
+	// Layouts of the date and datetime values that were parsed.
+	Layouts []string `json:"layouts,omitempty"`
+
+	// Examples of values that caused the type to be generalized, such
+	// as the values making an otherwise integer field a string. They are
+	// only kept if enabled in the profiler config.
+	Examples []string `json:"examples,omitempty"`
+
+	// Maximum number of significant digits of numeric values.
+	Precision int `json:"precision"`
+
+	// Number of non-null values that do not match the type, which was
+	// kept since enough other values do per the confidence of the
+	// profiler. They are loaded as nulls.
+	Nonconforming int64 `json:"nonconforming,omitempty"`
+
+	// Distinct values of an enum-like field, such as a status, sorted.
+	// They are only kept if enabled in the profiler config and the field
+	// has few distinct values relative to its number of values.
+	EnumValues []string `json:"enum_values,omitempty"`
+
+	// Number of records containing the field. Fields of JSON objects
+	// may be present in only some of the records.
+	Count int64 `json:"count"`
+
+	// Number of null values, including empty strings since they are
+	// loaded as nulls unless preserved.
+	NullCount int64 `json:"null_count"`
+
+	// Number of distinct non-null values if counted by the profiler, or
+	// -1 if there were too many to hold. Fields of merged profiles are
+	// not counted since their values are not kept.
+	DistinctCount int64 `json:"distinct_count,omitempty"`
 }
 
 type Profile struct {
@@ -33,8 +80,149 @@ type Profile struct {
 	Fields map[string]*Field `json:"fields"`
 }
 
+// SparseFields returns the names of the fields present in less than the
+// fraction of records, sorted by name. Many sparse fields usually signal
+// records of inconsistent shapes.
+func (p *Profile) SparseFields(fraction float64) []string {
+	if p.RecordCount == 0 {
+		return nil
+	}
+
+	var names []string
+	for n, f := range p.Fields {
+		if float64(f.Count)/float64(p.RecordCount) < fraction {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
 func NewProfile() *Profile {
 	return &Profile{
 		Fields: make(map[string]*Field),
 	}
 }
+
+// Merge returns the profile of the records of both profiles. The profiles
+// must have the same fields at the same indexes, such as files with the
+// same header. Since the values are not kept, fields of the merged profile
+// are not unique. The examples and enum values of the fields are limited
+// by the config, as in the profiles.
+func Merge(a, b *Profile, c *Config) (*Profile, error) {
+	var maxExamples, maxEnumValues int
+	if c != nil {
+		maxExamples, maxEnumValues = c.MaxExamples, c.MaxEnumValues
+	}
+
+	if len(a.Fields) != len(b.Fields) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(a.Fields), len(b.Fields))
+	}
+
+	m := NewProfile()
+	m.RecordCount = a.RecordCount + b.RecordCount
+
+	for n, af := range a.Fields {
+		bf, ok := b.Fields[n]
+		if !ok {
+			return nil, fmt.Errorf("field %s is missing", n)
+		}
+
+		if af.Index != bf.Index {
+			return nil, fmt.Errorf("field %s is at index %d, expected %d", n, bf.Index, af.Index)
+		}
+
+		m.Fields[n] = mergeField(af, bf, maxExamples, maxEnumValues)
+	}
+
+	return m, nil
+}
+
+func mergeField(a, b *Field, maxExamples, maxEnumValues int) *Field {
+	f := *a
+
+	// A field without values, such as that of a header-only file, does
+	// not constrain the type of the other.
+	switch {
+	case a.Type == UnknownType:
+		f.Type, f.ElemType = b.Type, b.ElemType
+	case b.Type == UnknownType:
+		f.Type, f.ElemType = a.Type, a.ElemType
+	default:
+		f.Type = GeneralizeType(a.Type, b.Type)
+		if f.Type == ArrayType {
+			f.ElemType = GeneralizeElemType(a.ElemType, b.ElemType)
+		} else {
+			f.ElemType = UnknownType
+		}
+	}
+
+	f.Nullable = a.Nullable || b.Nullable
+	f.Missing = a.Missing || b.Missing
+
+	// Values are not compared across profiles, so fields unique in each
+	// may not be unique together.
+	f.Unique = false
+	f.UniqueUnknown = (a.Unique || a.UniqueUnknown) && (b.Unique || b.UniqueUnknown)
+	f.LeadingZeros = a.LeadingZeros || b.LeadingZeros
+	f.Count = a.Count + b.Count
+	f.NullCount = a.NullCount + b.NullCount
+	f.DistinctCount = 0
+
+	if b.Precision > f.Precision {
+		f.Precision = b.Precision
+	}
+
+	layouts := make(map[string]struct{})
+	for _, l := range a.Layouts {
+		layouts[l] = struct{}{}
+	}
+	for _, l := range b.Layouts {
+		layouts[l] = struct{}{}
+	}
+
+	// Both fields must be enum-like for the merged field to be, and it is
+	// not if their values together are too many.
+	f.EnumValues = nil
+	if len(a.EnumValues) > 0 && len(b.EnumValues) > 0 {
+		values := make(map[string]struct{})
+		for _, v := range append(append([]string(nil), a.EnumValues...), b.EnumValues...) {
+			values[v] = struct{}{}
+		}
+		if maxEnumValues <= 0 || len(values) <= maxEnumValues {
+			for v := range values {
+				f.EnumValues = append(f.EnumValues, v)
+			}
+			sort.Strings(f.EnumValues)
+		}
+	}
+
+	// Sorted so the merge does not depend on the order of the profiles.
+	f.Examples = append(append([]string(nil), a.Examples...), b.Examples...)
+	sort.Strings(f.Examples)
+	if len(f.Examples) > maxExamples {
+		f.Examples = f.Examples[:maxExamples]
+	}
+
+	f.Layouts = nil
+	for l := range layouts {
+		f.Layouts = append(f.Layouts, l)
+	}
+	sort.Strings(f.Layouts)
+
+	// Leading zeros make the field a string.
+	if f.LeadingZeros {
+		f.Type = StringType
+	}
+
+	// Values of any type are strings.
+	if f.Type == StringType {
+		f.Nonconforming = 0
+	} else {
+		f.Nonconforming = a.Nonconforming + b.Nonconforming
+	}
+
+	return &f
+}
@@ -1,6 +1,11 @@
 package profile
 
 import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,6 +36,16 @@ func TestProfilerRecord(t *testing.T) {
 			BoolType,
 			true,
 		},
+		"bool-y": {
+			"Y",
+			BoolType,
+			true,
+		},
+		"bool-no": {
+			"no",
+			BoolType,
+			false,
+		},
 		"date-1": {
 			"2014-02-01",
 			DateType,
@@ -66,3 +81,556 @@ func TestProfilerRecord(t *testing.T) {
 		})
 	}
 }
+
+func TestSignificantDigits(t *testing.T) {
+	tests := map[string]int{
+		"1.20":      3,
+		"-0.00123":  3,
+		"123456789": 9,
+		"1.5e10":    2,
+		"+3.14159":  6,
+	}
+
+	for s, exp := range tests {
+		if n := significantDigits(s); n != exp {
+			t.Errorf("%s: expected %d digits, got %d", s, exp, n)
+		}
+	}
+}
+
+func TestProfilerRecordSigned(t *testing.T) {
+	tests := map[string]ValueType{
+		"+5":  IntType,
+		"-5":  IntType,
+		"0":   IntType,
+		"-0":  IntType,
+		"+05": StringType,
+		"-05": StringType,
+		"+":   StringType,
+		"-":   StringType,
+	}
+
+	for raw, typ := range tests {
+		t.Run(raw, func(t *testing.T) {
+			p := NewProfiler(nil)
+			p.Record("test", raw)
+
+			assertType(t, typ, p.Profile().Fields["test"].Type)
+		})
+	}
+}
+
+func TestProfilerLayouts(t *testing.T) {
+	p := NewProfiler(nil)
+
+	for _, v := range []string{"01/02/2014", "12/31/2014", ""} {
+		p.Record("visited", v)
+	}
+
+	for _, v := range []string{"2014-01-02", "01/02/2014"} {
+		p.Record("mixed", v)
+	}
+
+	f := p.Profile().Fields["visited"]
+	if len(f.Layouts) != 1 || f.Layouts[0] != "01/02/2006" {
+		t.Errorf("expected 01/02/2006 layout, got %v", f.Layouts)
+	}
+
+	f = p.Profile().Fields["mixed"]
+	if len(f.Layouts) != 2 {
+		t.Errorf("expected 2 layouts, got %v", f.Layouts)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := NewProfiler(nil)
+	a.Record("id", "1")
+	a.Record("id", "2")
+	a.Record("day", "01/02/2014")
+
+	b := NewProfiler(nil)
+	b.Record("id", "2.5")
+	b.Record("day", "")
+
+	m, err := Merge(a.Profile(), b.Profile(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := m.Fields["id"]
+	if id.Type != FloatType {
+		t.Errorf("expected float, got %s", id.Type)
+	}
+
+	if id.Unique {
+		t.Error("expected merged field to not be unique")
+	}
+
+	day := m.Fields["day"]
+	if day.Type != DateType || !day.Missing {
+		t.Errorf("expected missing date, got %s missing=%v", day.Type, day.Missing)
+	}
+
+	// The merge does not depend on the order of the profiles.
+	if r, _ := Merge(b.Profile(), a.Profile(), nil); !reflect.DeepEqual(r.Fields, m.Fields) {
+		t.Errorf("expected merge to be commutative\ngot: %+v\nexp: %+v", r.Fields, m.Fields)
+	}
+
+	// A field without values does not generalize the type.
+	e := NewProfile()
+	for n, f := range a.Profile().Fields {
+		e.Fields[n] = &Field{Name: n, Index: f.Index}
+	}
+
+	for _, m := range []*Profile{mustMerge(t, a.Profile(), e), mustMerge(t, e, a.Profile())} {
+		if f := m.Fields["id"]; f.Type != IntType {
+			t.Errorf("expected int id merged with an empty field, got %s", f.Type)
+		}
+		if f := m.Fields["day"]; f.Type != DateType {
+			t.Errorf("expected date day merged with an empty field, got %s", f.Type)
+		}
+	}
+
+	c := NewProfiler(nil)
+	c.Record("name", "Joe")
+	c.Record("day", "")
+
+	if _, err := Merge(a.Profile(), c.Profile(), nil); err == nil {
+		t.Error("expected profiles with different fields to fail")
+	}
+}
+
+func TestProfilerReset(t *testing.T) {
+	config := &Config{Exclude: []string{"skip"}}
+
+	record := func(p Profiler, rows [][2]string) {
+		for _, r := range rows {
+			p.Record("id", r[0])
+			p.Record("skip", r[1])
+			p.Incr()
+		}
+	}
+
+	p := NewProfiler(config)
+	record(p, [][2]string{{"a", "1"}, {"b", "2"}, {"b", "3"}})
+
+	p.(Resetter).Reset()
+	record(p, [][2]string{{"1", "x"}, {"2", "y"}})
+
+	fresh := NewProfiler(config)
+	record(fresh, [][2]string{{"1", "x"}, {"2", "y"}})
+
+	if got, exp := p.Profile(), fresh.Profile(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected reset profile to match a new one\ngot: %+v\nexp: %+v", got, exp)
+	}
+
+	if _, ok := p.Profile().Fields["skip"]; ok {
+		t.Error("expected excluded field to remain excluded after reset")
+	}
+}
+
+func TestProfilerPatterns(t *testing.T) {
+	p := NewProfiler(&Config{
+		Include: []string{"ID", "dx_*", "*_tmp"},
+		Exclude: []string{"*_TMP"},
+	})
+
+	for _, n := range []string{"id", "Dx_Code", "name", "dx_tmp", "Load_Tmp"} {
+		p.Record(n, "1")
+	}
+	p.Incr()
+
+	var names []string
+	for n := range p.Profile().Fields {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	if got := strings.Join(names, ","); got != "dx_code,id" {
+		t.Errorf("expected dx_code and id, got %s", got)
+	}
+}
+
+func TestProfilerAllText(t *testing.T) {
+	p := NewProfiler(&Config{AllText: true, NullTokens: []string{`\N`}})
+
+	for _, v := range []string{"1", "2013-03-11", "", `\N`} {
+		p.Record("value", v)
+		p.Incr()
+	}
+
+	f := p.Profile().Fields["value"]
+
+	if f.Type != StringType {
+		t.Errorf("expected string type, got %s", f.Type)
+	}
+
+	if !f.Nullable || !f.Missing {
+		t.Error("expected nulls and empty strings to be tracked")
+	}
+
+	if f.Unique {
+		t.Error("expected uniqueness not to be tracked")
+	}
+
+	p = NewProfiler(&Config{AllText: true, TrackUnique: true})
+	p.Record("value", "1")
+	p.Record("value", "2")
+
+	if !p.Profile().Fields["value"].Unique {
+		t.Error("expected uniqueness to be tracked")
+	}
+}
+
+func TestProfilerMaxUniqueValues(t *testing.T) {
+	record := func(c *Config, values ...string) *Field {
+		p := NewProfiler(c)
+
+		for _, v := range values {
+			p.Record("value", v)
+			p.Incr()
+		}
+
+		return p.Profile().Fields["value"]
+	}
+
+	// Past the cap, the values are not known to be unique or not.
+	if f := record(&Config{MaxUniqueValues: 2}, "1", "2", "3", "1"); f.Unique || !f.UniqueUnknown {
+		t.Errorf("expected unknown uniqueness, got unique=%v unknown=%v", f.Unique, f.UniqueUnknown)
+	}
+
+	// A duplicate seen before the cap is definite.
+	if f := record(&Config{MaxUniqueValues: 2}, "1", "1", "2", "3"); f.Unique || f.UniqueUnknown {
+		t.Errorf("expected non-unique, got unique=%v unknown=%v", f.Unique, f.UniqueUnknown)
+	}
+
+	if f := record(&Config{MaxUniqueValues: 3}, "1", "2", "3"); !f.Unique || f.UniqueUnknown {
+		t.Errorf("expected unique, got unique=%v unknown=%v", f.Unique, f.UniqueUnknown)
+	}
+}
+
+func TestProfilerCounts(t *testing.T) {
+	record := func(c *Config, values ...string) *Field {
+		p := NewProfiler(c)
+
+		for _, v := range values {
+			p.Record("value", v)
+			p.Incr()
+		}
+
+		return p.Profile().Fields["value"]
+	}
+
+	// Null tokens and empty strings are nulls and not distinct values.
+	f := record(&Config{NullTokens: []string{"NA"}, CountDistinct: true}, "a", "b", "", "a", "NA", "c")
+	if f.NullCount != 2 || f.DistinctCount != 3 {
+		t.Errorf("expected 2 nulls and 3 distinct values, got %d and %d", f.NullCount, f.DistinctCount)
+	}
+
+	// Past the cap, the distinct values are not known.
+	if f := record(&Config{CountDistinct: true, MaxUniqueValues: 2}, "a", "a", "b", "c"); f.DistinctCount != -1 {
+		t.Errorf("expected unknown distinct count, got %d", f.DistinctCount)
+	}
+
+	if f := record(&Config{}, "a", "b"); f.DistinctCount != 0 {
+		t.Errorf("expected distinct values not counted, got %d", f.DistinctCount)
+	}
+}
+
+// Codes such as E11.9 are classified by a custom detector.
+var codeType = NewType("code")
+
+var codePattern = regexp.MustCompile(`^[A-Z]\d{2}\.\d$`)
+
+func detectCode(v string) (ValueType, bool) {
+	return codeType, codePattern.MatchString(v)
+}
+
+func TestProfilerDetector(t *testing.T) {
+	p := NewProfiler(&Config{Detectors: []Detector{detectCode}})
+
+	for _, v := range []string{"E11.9", "I10.0", ""} {
+		p.Record("diagnosis", v)
+		p.Record("other", v)
+	}
+
+	p.Record("other", "none")
+
+	fields := p.Profile().Fields
+
+	assertType(t, codeType, fields["diagnosis"].Type)
+	assertType(t, StringType, fields["other"].Type)
+
+	if s := codeType.String(); s != "code" {
+		t.Errorf("expected code, got %q", s)
+	}
+
+	if typ, ok := ParseType("Code"); !ok || typ != codeType {
+		t.Errorf("expected to parse code type, got %s", typ)
+	}
+
+	// Detectors only apply to the profilers they are set on.
+	p = NewProfiler(nil)
+	p.Record("diagnosis", "E11.9")
+
+	assertType(t, StringType, p.Profile().Fields["diagnosis"].Type)
+}
+
+func TestProfilerMaxIntDigits(t *testing.T) {
+	record := func(c *Config, values ...string) *Field {
+		p := NewProfiler(c)
+
+		for _, v := range values {
+			p.Record("value", v)
+			p.Incr()
+		}
+
+		return p.Profile().Fields["value"]
+	}
+
+	long := []string{"1234567890123456789", "-9876543210987654321", "42"}
+
+	if f := record(&Config{MaxIntDigits: 18}, long...); f.Type != StringType {
+		t.Errorf("expected string type, got %s", f.Type)
+	}
+
+	if f := record(&Config{MaxIntDigits: 18}, "123456789012345678", "42"); f.Type != IntType {
+		t.Errorf("expected integer type, got %s", f.Type)
+	}
+
+	// Decimals are not identifiers.
+	if f := record(&Config{MaxIntDigits: 18}, "1234567890123456789.5"); f.Type != FloatType {
+		t.Errorf("expected float type, got %s", f.Type)
+	}
+
+	// Values too long for an int64 are parsed as floats without a limit.
+	if f := record(&Config{}, long...); f.Type != FloatType {
+		t.Errorf("expected float type, got %s", f.Type)
+	}
+}
+
+func TestProfilerConfidence(t *testing.T) {
+	record := func(c *Config) *Field {
+		p := NewProfiler(c)
+
+		for i := 0; i < 999; i++ {
+			p.Record("value", strconv.Itoa(i))
+			p.Incr()
+		}
+
+		p.Record("value", "unknown")
+		p.Incr()
+
+		return p.Profile().Fields["value"]
+	}
+
+	f := record(&Config{Confidence: 0.99})
+
+	if f.Type != IntType {
+		t.Errorf("expected integer type, got %s", f.Type)
+	}
+
+	if f.Nonconforming != 1 {
+		t.Errorf("expected 1 nonconforming value, got %d", f.Nonconforming)
+	}
+
+	// Every value must match by default.
+	f = record(&Config{})
+
+	if f.Type != StringType {
+		t.Errorf("expected string type, got %s", f.Type)
+	}
+
+	if f.Nonconforming != 0 {
+		t.Errorf("expected no nonconforming values, got %d", f.Nonconforming)
+	}
+
+	// Below the threshold.
+	p := NewProfiler(&Config{Confidence: 0.99})
+	for _, v := range []string{"1", "2", "a", "b"} {
+		p.Record("value", v)
+	}
+
+	if f := p.Profile().Fields["value"]; f.Type != StringType {
+		t.Errorf("expected string type below the threshold, got %s", f.Type)
+	}
+
+	// Integers count toward a float type.
+	p = NewProfiler(&Config{Confidence: 0.75})
+	for _, v := range []string{"1", "2", "3.5", "a"} {
+		p.Record("value", v)
+	}
+
+	if f := p.Profile().Fields["value"]; f.Type != FloatType || f.Nonconforming != 1 {
+		t.Errorf("expected float type with 1 nonconforming value, got %s with %d", f.Type, f.Nonconforming)
+	}
+}
+
+// Fields and typical values of a benchmarked record.
+var (
+	benchmarkFields = []string{"count", "score", "active", "dob", "updated", "name", "zip"}
+	benchmarkValues = []string{"1024", "3.14", "true", "2013-03-11", "2013-03-11 10:30:00", "Joe", "19104"}
+)
+
+func benchmarkProfiler(b *testing.B, config *Config) {
+	for i := 0; i < b.N; i++ {
+		p := NewProfiler(config)
+
+		for j := 0; j < 1000; j++ {
+			for k, v := range benchmarkValues {
+				p.Record(benchmarkFields[k], v)
+			}
+			p.Incr()
+		}
+	}
+}
+
+func BenchmarkProfilerInfer(b *testing.B) {
+	benchmarkProfiler(b, &Config{})
+}
+
+func BenchmarkProfilerAllText(b *testing.B) {
+	benchmarkProfiler(b, &Config{AllText: true})
+}
+
+func TestProfilerEnums(t *testing.T) {
+	p := NewProfiler(&Config{MaxEnumValues: 5})
+
+	statuses := []string{"active", "inactive", "pending"}
+
+	for i := 0; i < 1000; i++ {
+		p.Record("status", statuses[i%3])
+		p.Record("id", strconv.Itoa(i))
+		p.Incr()
+	}
+
+	// A few distinct values that are not repeated.
+	for _, v := range []string{"a", "b", "c"} {
+		p.Record("code", v)
+	}
+
+	f := p.Profile().Fields
+
+	if !reflect.DeepEqual(f["status"].EnumValues, statuses) {
+		t.Errorf("expected enum values %v, got %v", statuses, f["status"].EnumValues)
+	}
+
+	if f["id"].EnumValues != nil {
+		t.Errorf("expected id not to be enum-like, got %v", f["id"].EnumValues)
+	}
+
+	if f["code"].EnumValues != nil {
+		t.Errorf("expected unrepeated values not to be enum-like, got %v", f["code"].EnumValues)
+	}
+
+	// Not detected by default.
+	p = NewProfiler(&Config{})
+	for i := 0; i < 10; i++ {
+		p.Record("status", statuses[i%3])
+	}
+
+	if v := p.Profile().Fields["status"].EnumValues; v != nil {
+		t.Errorf("expected no enum values, got %v", v)
+	}
+}
+
+func TestMergeEnums(t *testing.T) {
+	c := &Config{MaxEnumValues: 3}
+
+	record := func(values ...string) *Profile {
+		p := NewProfiler(c)
+		for i := 0; i < 10; i++ {
+			p.Record("status", values[i%len(values)])
+			p.Incr()
+		}
+		return p.Profile()
+	}
+
+	m, err := Merge(record("active", "pending"), record("active", "inactive"), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := m.Fields["status"].EnumValues; !reflect.DeepEqual(v, []string{"active", "inactive", "pending"}) {
+		t.Errorf("expected merged enum values, got %v", v)
+	}
+
+	// Each has at most 3 values but together they have 4.
+	if m, err = Merge(record("active", "pending"), record("closed", "inactive"), c); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := m.Fields["status"].EnumValues; v != nil {
+		t.Errorf("expected too many values not to be enum-like, got %v", v)
+	}
+}
+
+func TestProfilerExamples(t *testing.T) {
+	p := NewProfiler(&Config{MaxExamples: 2})
+
+	for _, v := range []string{"1", "2", "n/a", "3", "unknown", "4"} {
+		p.Record("id", v)
+	}
+
+	for _, v := range []string{"1", "2.5", "3"} {
+		p.Record("amount", v)
+	}
+
+	// Nulls do not have a type to generalize.
+	p.Record("name", "")
+	p.Record("name", "Joe")
+
+	f := p.Profile().Fields
+
+	if f["id"].Type != StringType {
+		t.Errorf("expected string type, got %s", f["id"].Type)
+	}
+
+	// Values after the type is the most general are not examples.
+	if !reflect.DeepEqual(f["id"].Examples, []string{"n/a"}) {
+		t.Errorf("expected n/a example, got %v", f["id"].Examples)
+	}
+
+	if !reflect.DeepEqual(f["amount"].Examples, []string{"2.5"}) {
+		t.Errorf("expected 2.5 example, got %v", f["amount"].Examples)
+	}
+
+	if len(f["name"].Examples) != 0 {
+		t.Errorf("expected no examples, got %v", f["name"].Examples)
+	}
+
+	// Disabled by default.
+	p = NewProfiler(nil)
+	p.Record("id", "1")
+	p.Record("id", "n/a")
+
+	if ex := p.Profile().Fields["id"].Examples; len(ex) != 0 {
+		t.Errorf("expected no examples, got %v", ex)
+	}
+
+	// Merged examples are limited as well.
+	a := NewProfiler(&Config{MaxExamples: 1})
+	a.Record("id", "1")
+	a.Record("id", "unknown")
+
+	b := NewProfiler(&Config{MaxExamples: 1})
+	b.Record("id", "2")
+	b.Record("id", "n/a")
+
+	m, err := Merge(a.Profile(), b.Profile(), &Config{MaxExamples: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ex := m.Fields["id"].Examples; !reflect.DeepEqual(ex, []string{"n/a"}) {
+		t.Errorf("expected n/a example, got %v", ex)
+	}
+}
+
+func mustMerge(t *testing.T, a, b *Profile) *Profile {
+	m, err := Merge(a, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
@@ -1,23 +1,92 @@
 package profile
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // hasLeadingZeros checks if a valid integer value contains leading zeros.
 // This is often an indicator that this is not an integer, but an identfier.
+// A sign preceding the digits is ignored and zero itself is not considered
+// to have leading zeros.
 func hasLeadingZeros(s string) bool {
-	if s == "" {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+
+	if len(s) < 2 {
 		return false
 	}
 
 	return s[0] == '0'
 }
 
+// significantDigits returns the number of significant digits in a numeric
+// value, ignoring the sign, decimal point, exponent, and leading zeros.
+func significantDigits(s string) int {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		s = s[:i]
+	}
+
+	var n int
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		// Leading zeros are not significant.
+		if n == 0 && c == '0' {
+			continue
+		}
+
+		n++
+	}
+
+	return n
+}
+
+// isInteger returns true if the value is digits with an optional sign,
+// regardless of whether it fits in an integer type.
+func isInteger(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Errors returned by Err when the input exceeds a limit of the Config.
+var (
+	ErrTooManyRecords = errors.New("too many records")
+	ErrTooManyFields  = errors.New("too many fields")
+	ErrTooManyValues  = errors.New("too many distinct values")
+)
+
+// ErrNoColumns is returned when the input is empty or has no fields.
+var ErrNoColumns = errors.New("no columns detected")
+
 type profiler struct {
 	Config  *Config
 	Count   int64
-	Include map[string]struct{}
-	Exclude map[string]struct{}
+	Include []string
+	Exclude []string
+	Nulls   map[string]struct{}
 	Fields  map[string]*profilerField
+
+	// First limit that was exceeded.
+	err error
 }
 
 // Profiler is an interface for profiling data.
@@ -39,30 +108,164 @@ type Profiler interface {
 	Profile() *Profile
 }
 
+// ArrayRecorder is implemented by profilers that type arrays by their
+// elements, such as those returned by NewProfiler.
+type ArrayRecorder interface {
+	// RecordArray records an array value with the type of its elements.
+	RecordArray(field string, value interface{}, elem ValueType)
+}
+
+// ErrReporter is implemented by profilers that enforce limits, such as
+// those returned by NewProfiler.
+type ErrReporter interface {
+	// Err returns an error if a limit of the config was exceeded.
+	// Profiling should be aborted once it is set.
+	Err() error
+}
+
+// Resetter is implemented by profilers that can be reused, such as those
+// returned by NewProfiler.
+type Resetter interface {
+	// Reset clears the recorded fields and count so the profiler can be
+	// reused for another input with the same config.
+	Reset()
+}
+
+// Err returns the error of the profiler if it is an ErrReporter.
+func Err(p Profiler) error {
+	if r, ok := p.(ErrReporter); ok {
+		return r.Err()
+	}
+
+	return nil
+}
+
 type Config struct {
-	// Include are the fields to explicitly include.
+	// Include are the fields to explicitly include and Exclude the fields
+	// to explicitly exclude. They are names or glob patterns, such as
+	// tmp_* or *_internal, matched case-insensitively.
 	Include []string
-
-	// Exclude are the fields to explicitly exclude.
 	Exclude []string
+
+	// NullTokens are raw values recorded as nulls, such as \N.
+	NullTokens []string
+
+	// SnakeCase converts camelCase and PascalCase field names to
+	// snake_case, such as FirstName to first_name, rather than only
+	// lowercasing them. Include and Exclude are converted too.
+	SnakeCase bool
+
+	// Limits protecting against inputs that would consume too many
+	// resources. Distinct values are held in memory while a field is
+	// unique. Zero is unlimited.
+	MaxRecords int64
+	MaxFields  int
+	MaxValues  int
+
+	// Offset is the number of records skipped before those profiled and
+	// Limit the most records profiled after them, such as to profile a
+	// slice of a large input. Skipped records are not counted. There is
+	// no limit if zero.
+	Offset int64
+	Limit  int64
+
+	// MaxUniqueValues caps the distinct values held to track the
+	// uniqueness of a field. Past the cap, tracking stops and the
+	// uniqueness of the field is unknown rather than aborting as with
+	// MaxValues. Zero is unlimited.
+	MaxUniqueValues int
+
+	// CountDistinct counts the distinct non-null values of each field
+	// into its DistinctCount. The values are held until there are more
+	// than MaxUniqueValues, past which the count is unknown.
+	CountDistinct bool
+
+	// AllText types the values recorded with Record as strings without
+	// detecting their types, which speeds up profiling files known to be
+	// text. Nulls and empty strings are still tracked. Uniqueness is only
+	// tracked if TrackUnique is also set since holding the distinct values
+	// is the other main cost of profiling.
+	AllText     bool
+	TrackUnique bool
+
+	// MaxExamples is the number of values kept per field that caused
+	// the type of the field to be generalized, such as a stray word in
+	// an integer field. No examples are kept if zero.
+	MaxExamples int
+
+	// Confidence is the fraction of the non-null values of a field that
+	// must match a type other than string for the field to keep it, such
+	// as 0.99 to type a field as integer despite a few stray words. The
+	// values not matching are counted in Nonconforming. Every value must
+	// match if zero or one.
+	Confidence float64
+
+	// MaxEnumValues is the most distinct values of an enum-like field,
+	// such as a status or a category, whose values are kept in
+	// EnumValues. Fields whose values are mostly unique are not
+	// enum-like. Enums are not detected if zero.
+	MaxEnumValues int
+
+	// MaxIntDigits is the most digits of an integer value. Longer values,
+	// such as phone and account numbers, are identifiers that would
+	// overflow the integer types, so they are strings. There is no limit
+	// if zero.
+	MaxIntDigits int
+
+	// Detectors classify values of custom types, such as diagnosis codes.
+	// They are consulted in order before the built-in types.
+	Detectors []Detector
+}
+
+// confident returns true if fields may keep a type not matched by all
+// values.
+func (c *Config) confident() bool {
+	return c.Confidence > 0 && c.Confidence < 1
+}
+
+// Window returns whether the record at the zero-based index n is skipped
+// since it precedes the Offset, or is past the Limit so the records from
+// n on are not profiled.
+func (c *Config) Window(n int64) (skip, stop bool) {
+	if c == nil {
+		return false, false
+	}
+
+	if n < c.Offset {
+		return true, false
+	}
+
+	return false, c.Limit > 0 && n >= c.Offset+c.Limit
 }
 
 func (p *profiler) Incr() {
 	p.Count++
+
+	if max := p.Config.MaxRecords; max > 0 && p.Count > max && p.err == nil {
+		p.err = fmt.Errorf("%w: limit of %d", ErrTooManyRecords, max)
+	}
+}
+
+func (p *profiler) Err() error {
+	return p.err
+}
+
+func (p *profiler) Reset() {
+	p.Count = 0
+	p.Fields = make(map[string]*profilerField)
+	p.err = nil
 }
 
 // field returns the field profile if it should be profiled.
 func (p *profiler) field(n string) (*profilerField, bool) {
-	n = strings.ToLower(n)
+	n = p.Config.FieldName(n)
 
-	if _, ok := p.Exclude[n]; ok {
+	if matchField(p.Exclude, n) {
 		return nil, false
 	}
 
-	if len(p.Include) > 0 {
-		if _, ok := p.Include[n]; !ok {
-			return nil, false
-		}
+	if len(p.Include) > 0 && !matchField(p.Include, n) {
+		return nil, false
 	}
 
 	// Initialize and get field profile.
@@ -70,6 +273,21 @@ func (p *profiler) field(n string) (*profilerField, bool) {
 	if !ok {
 		f = newProfilerField(n)
 		p.Fields[n] = f
+
+		if p.Config.confident() {
+			f.Confidence = p.Config.Confidence
+		}
+
+		f.MaxIntDigits = p.Config.MaxIntDigits
+		f.Detectors = p.Config.Detectors
+
+		if p.Config.CountDistinct {
+			f.Distinct = make(map[string]struct{})
+		}
+
+		if max := p.Config.MaxFields; max > 0 && len(p.Fields) > max && p.err == nil {
+			p.err = fmt.Errorf("%w: limit of %d", ErrTooManyFields, max)
+		}
 	}
 
 	return f, true
@@ -96,19 +314,85 @@ func (p *profiler) Record(n string, v string) {
 		return
 	}
 
-	// Still in the unique state.
-	if f.Unique {
-		// Duplicate value.
-		if _, ok := f.Values[v]; ok {
-			f.Unique = false
-			f.Values = nil
-		} else {
-			f.Values[v] = struct{}{}
+	// Empty strings are tracked separately from nulls and do not
+	// contribute to the type or uniqueness of the field.
+	if v == "" {
+		f.Missing = true
+		f.NullCount++
+		return
+	}
+
+	if _, ok := p.Nulls[v]; ok {
+		f.Types[NullType] = struct{}{}
+		f.NullCount++
+		return
+	}
+
+	p.trackEnum(f, v)
+	p.trackDistinct(f, v)
+
+	if p.Config.AllText {
+		p.recordText(f, v)
+		return
+	}
+
+	p.trackUnique(f, v)
+
+	// Short circuit. Already most general type. The types of all values
+	// are counted if the field may keep a type not matched by all of them.
+	if _, ok := f.Types[StringType]; ok && f.Confidence == 0 {
+		return
+	}
+
+	prev := p.exampleType(f)
+	recordValue(f, v)
+	p.trackExample(f, prev, v)
+}
+
+// recordText records the value as a string without detecting its type.
+func (p *profiler) recordText(f *profilerField, v string) {
+	f.Types[StringType] = struct{}{}
+
+	if p.Config.TrackUnique {
+		p.trackUnique(f, v)
+	} else {
+		f.stopUnique()
+	}
+}
+
+// exampleType returns the type of the field before a value is recorded if
+// examples are still being kept and the field has a type other than null.
+func (p *profiler) exampleType(f *profilerField) ValueType {
+	if len(f.Examples) >= p.Config.MaxExamples {
+		return UnknownType
+	}
+
+	if t := f.Type(); t != NullType {
+		return t
+	}
+
+	return UnknownType
+}
+
+// trackExample keeps the value as an example if it generalized the type
+// of the field.
+func (p *profiler) trackExample(f *profilerField, prev ValueType, v string) {
+	if prev != UnknownType && f.Type() != prev {
+		f.Examples = append(f.Examples, v)
+	}
+}
+
+// recordValue detects the type of the value.
+func recordValue(f *profilerField, v string) {
+	for _, d := range f.Detectors {
+		if t, ok := d(v); ok {
+			f.addType(t)
+			return
 		}
 	}
 
-	// Short circuit. Already most general type.
-	if _, ok := f.Types[StringType]; ok {
+	if f.MaxIntDigits > 0 && isInteger(v) && significantDigits(v) > f.MaxIntDigits {
+		f.addType(StringType)
 		return
 	}
 
@@ -117,31 +401,35 @@ func (p *profiler) Record(n string, v string) {
 			f.LeadingZeros = true
 		}
 
-		f.Types[IntType] = struct{}{}
+		f.trackPrecision(v)
+		f.addType(IntType)
 		return
 	}
 
 	if _, ok := ParseFloat(v); ok {
-		f.Types[FloatType] = struct{}{}
+		f.trackPrecision(v)
+		f.addType(FloatType)
 		return
 	}
 
 	if _, ok := ParseBool(v); ok {
-		f.Types[BoolType] = struct{}{}
+		f.addType(BoolType)
 		return
 	}
 
-	if _, ok := ParseDate(v); ok {
-		f.Types[DateType] = struct{}{}
+	if _, layout, ok := ParseDateLayout(v); ok {
+		f.Layouts[layout] = struct{}{}
+		f.addType(DateType)
 		return
 	}
 
-	if _, ok := ParseDateTime(v); ok {
-		f.Types[DateTimeType] = struct{}{}
+	if _, layout, ok := ParseDateTimeLayout(v); ok {
+		f.Layouts[layout] = struct{}{}
+		f.addType(DateTimeType)
 		return
 	}
 
-	f.Types[StringType] = struct{}{}
+	f.addType(StringType)
 }
 
 func (p *profiler) RecordType(n string, v interface{}, t ValueType) {
@@ -150,38 +438,258 @@ func (p *profiler) RecordType(n string, v interface{}, t ValueType) {
 		return
 	}
 
-	f.Types[t] = struct{}{}
+	prev := UnknownType
+	if _, ok := f.Types[t]; !ok && v != nil {
+		prev = p.exampleType(f)
+	}
+
+	if t == NullType || v == nil {
+		f.Types[t] = struct{}{}
+	} else {
+		f.addType(t)
+	}
+
+	if prev != UnknownType {
+		p.trackExample(f, prev, fmt.Sprint(v))
+	}
+
+	// Nulls do not contribute to the uniqueness of the field.
+	if t == NullType || v == nil {
+		f.NullCount++
+		return
+	}
+
+	// Objects are not indexed.
+	if t == ObjectType {
+		f.Unique = false
+		f.Values = nil
+		f.stopDistinct()
+		return
+	}
+
+	raw := fmt.Sprint(v)
+	p.trackUnique(f, raw)
+	p.trackEnum(f, raw)
+	p.trackDistinct(f, raw)
+
+	if t == IntType || t == FloatType {
+		f.trackPrecision(raw)
+	}
+}
+
+func (p *profiler) RecordArray(n string, v interface{}, elem ValueType) {
+	f, ok := p.field(n)
+	if !ok {
+		return
+	}
+
+	f.Types[ArrayType] = struct{}{}
+	f.ElemTypes[elem] = struct{}{}
+
+	// Arrays are not indexed.
+	f.Unique = false
+	f.Values = nil
+	f.stopDistinct()
+}
+
+// trackUnique tracks the uniqueness of the field and checks the number of
+// distinct values held against the limit.
+func (p *profiler) trackUnique(f *profilerField, v string) {
+	f.trackUnique(v)
+
+	if max := p.Config.MaxUniqueValues; max > 0 && len(f.Values) > max {
+		f.stopUnique()
+	}
+
+	if max := p.Config.MaxValues; max > 0 && len(f.Values) > max && p.err == nil {
+		p.err = fmt.Errorf("%w in field %s: limit of %d", ErrTooManyValues, f.Name, max)
+	}
+}
+
+// trackDistinct counts the distinct values of the field until there are
+// more than MaxUniqueValues.
+func (p *profiler) trackDistinct(f *profilerField, v string) {
+	if f.Distinct == nil {
+		return
+	}
+
+	f.Distinct[v] = struct{}{}
+
+	if max := p.Config.MaxUniqueValues; max > 0 && len(f.Distinct) > max {
+		f.stopDistinct()
+	}
+}
+
+// trackEnum keeps the distinct values of the field until there are more
+// than the enum limit.
+func (p *profiler) trackEnum(f *profilerField, v string) {
+	max := p.Config.MaxEnumValues
+	if max <= 0 || f.NotEnum {
+		return
+	}
+
+	if f.Enum == nil {
+		f.Enum = make(map[string]struct{})
+	}
+
+	f.Enum[v] = struct{}{}
+	f.EnumCount++
+
+	if len(f.Enum) > max {
+		f.Enum = nil
+		f.NotEnum = true
+	}
 }
 
 // Field stores aggregation information and statistics for a field.
 type profilerField struct {
 	Name         string
 	Types        map[ValueType]struct{}
+	ElemTypes    map[ValueType]struct{}
+	Layouts      map[string]struct{}
 	Values       map[string]struct{}
+	Examples     []string
+	Counts       map[ValueType]int64
+	Confidence   float64
+	MaxIntDigits int
+	Detectors    []Detector
+	Enum         map[string]struct{}
+	EnumCount    int64
+	NotEnum      bool
 	Unique       bool
+	Missing      bool
 	LeadingZeros bool
+	Precision    int
+	NullCount    int64
+
+	// UniqueUnknown is set if tracking the uniqueness stopped before a
+	// duplicate was seen.
+	UniqueUnknown bool
+
+	// Distinct values of the field if they are counted. DistinctUnknown
+	// is set if counting stopped.
+	Distinct        map[string]struct{}
+	DistinctUnknown bool
+}
+
+func (p *profilerField) trackUnique(v string) {
+	// Still in the unique state.
+	if !p.Unique {
+		return
+	}
+
+	// Duplicate value.
+	if _, ok := p.Values[v]; ok {
+		p.Unique = false
+		p.Values = nil
+	} else {
+		p.Values[v] = struct{}{}
+	}
+}
+
+// stopUnique stops tracking the uniqueness of the field, which is unknown
+// unless a duplicate was already seen.
+func (p *profilerField) stopUnique() {
+	if p.Unique {
+		p.Unique = false
+		p.UniqueUnknown = true
+	}
+
+	p.Values = nil
+}
+
+// stopDistinct stops counting the distinct values of the field, whose
+// count is then unknown.
+func (p *profilerField) stopDistinct() {
+	if p.Distinct != nil {
+		p.Distinct = nil
+		p.DistinctUnknown = true
+	}
+}
+
+// addType records a non-null value of the type.
+func (p *profilerField) addType(t ValueType) {
+	p.Types[t] = struct{}{}
+	p.Counts[t]++
+}
+
+func (p *profilerField) trackPrecision(v string) {
+	if n := significantDigits(v); n > p.Precision {
+		p.Precision = n
+	}
 }
 
 func (p *profilerField) Field() *Field {
 	_, nullable := p.Types[NullType]
-	_, missing := p.Values[""]
+
+	var layouts []string
+	for l := range p.Layouts {
+		layouts = append(layouts, l)
+	}
+	sort.Strings(layouts)
+
+	typ, nonconforming := p.confidentType()
 
 	f := Field{
-		Name:         p.Name,
-		Type:         p.Type(),
-		Nullable:     nullable,
-		Missing:      missing,
-		Unique:       p.Unique,
-		LeadingZeros: p.LeadingZeros,
+		Name:          p.Name,
+		Layouts:       layouts,
+		Examples:      p.Examples,
+		Type:          typ,
+		Nonconforming: nonconforming,
+		ElemType:      p.ElemType(),
+		Nullable:      nullable,
+		Missing:       p.Missing,
+		Unique:        p.Unique,
+		UniqueUnknown: p.UniqueUnknown,
+		LeadingZeros:  p.LeadingZeros,
+		Precision:     p.Precision,
+		EnumValues:    p.enumValues(),
+		NullCount:     p.NullCount,
+	}
+
+	if p.DistinctUnknown {
+		f.DistinctCount = -1
+	} else {
+		f.DistinctCount = int64(len(p.Distinct))
 	}
 
 	return &f
 }
 
-// Type returns the most specific type this field satisfies.
+// enumValues returns the sorted distinct values of the field if it is
+// enum-like, which requires each value to be repeated on average.
+func (p *profilerField) enumValues() []string {
+	if len(p.Enum) == 0 || p.EnumCount < 2*int64(len(p.Enum)) {
+		return nil
+	}
+
+	values := make([]string, 0, len(p.Enum))
+	for v := range p.Enum {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	return values
+}
+
+// Type returns the most specific type this field satisfies. If the field
+// has a confidence, it is the most specific type satisfied by at least
+// that fraction of the non-null values.
 func (f *profilerField) Type() ValueType {
+	t, _ := f.confidentType()
+	return t
+}
+
+// confidentType returns the type of the field and the number of non-null
+// values that do not match it.
+func (f *profilerField) confidentType() (ValueType, int64) {
 	if f.LeadingZeros {
-		return StringType
+		return StringType, 0
+	}
+
+	// Only empty strings were observed.
+	if len(f.Types) == 0 && f.Missing {
+		return NullType, 0
 	}
 
 	var g ValueType
@@ -194,15 +702,79 @@ func (f *profilerField) Type() ValueType {
 		}
 	}
 
+	// Only the generalization to string discards the type of the values.
+	if g != StringType || f.Confidence == 0 {
+		return g, 0
+	}
+
+	var total int64
+	for _, n := range f.Counts {
+		total += n
+	}
+
+	// The candidate matching the most values, such as float over integer
+	// if a few values are floats. Ties are broken by the type order so
+	// the result does not depend on map iteration.
+	best, matched := StringType, int64(0)
+
+	for c := range f.Counts {
+		if !scalarType(c) {
+			continue
+		}
+
+		var n int64
+		for t, count := range f.Counts {
+			if GeneralizeType(t, c) == c {
+				n += count
+			}
+		}
+
+		if n > matched || (n == matched && c < best) {
+			best, matched = c, n
+		}
+	}
+
+	if best == StringType || float64(matched) < f.Confidence*float64(total) {
+		return g, 0
+	}
+
+	return best, total - matched
+}
+
+// scalarType returns true if the type is a number, boolean, or date that
+// a field may keep despite values not matching it.
+func scalarType(t ValueType) bool {
+	switch t {
+	case IntType, FloatType, BoolType, DateType, DateTimeType:
+		return true
+	}
+
+	return false
+}
+
+// ElemType returns the type of the elements if the field is an array.
+func (f *profilerField) ElemType() ValueType {
+	if f.Type() != ArrayType {
+		return UnknownType
+	}
+
+	g := NullType
+	for t := range f.ElemTypes {
+		g = GeneralizeElemType(g, t)
+	}
+
 	return g
 }
 
 func newProfilerField(name string) *profilerField {
 	return &profilerField{
-		Name:   name,
-		Types:  make(map[ValueType]struct{}),
-		Values: make(map[string]struct{}),
-		Unique: true,
+		Name:      name,
+		Types:     make(map[ValueType]struct{}),
+		ElemTypes: make(map[ValueType]struct{}),
+		Layouts:   make(map[string]struct{}),
+		Values:    make(map[string]struct{}),
+		Counts:    make(map[ValueType]int64),
+		Unique:    true,
 	}
 }
 
@@ -216,19 +788,19 @@ func NewProfiler(c *Config) Profiler {
 		Fields: make(map[string]*profilerField),
 	}
 
-	if len(p.Config.Exclude) > 0 {
-		p.Exclude = make(map[string]struct{})
+	for _, f := range p.Config.Exclude {
+		p.Exclude = append(p.Exclude, c.fieldPattern(f))
+	}
 
-		for _, f := range p.Config.Exclude {
-			p.Exclude[strings.ToLower(f)] = struct{}{}
-		}
+	for _, f := range p.Config.Include {
+		p.Include = append(p.Include, c.fieldPattern(f))
 	}
 
-	if len(p.Config.Include) > 0 {
-		p.Include = make(map[string]struct{})
+	if len(p.Config.NullTokens) > 0 {
+		p.Nulls = make(map[string]struct{})
 
-		for _, f := range p.Config.Include {
-			p.Include[strings.ToLower(f)] = struct{}{}
+		for _, t := range p.Config.NullTokens {
+			p.Nulls[t] = struct{}{}
 		}
 	}
 
@@ -2,7 +2,9 @@ package profile
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 )
 
 const (
@@ -16,6 +18,7 @@ const (
 	DateType
 	DateTimeType
 	ObjectType
+	ArrayType
 )
 
 // ValueType is a type of value.
@@ -41,9 +44,51 @@ func (v ValueType) String() string {
 		return "datetime"
 	case ObjectType:
 		return "object"
+	case ArrayType:
+		return "array"
 	}
 
-	return ""
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+
+	return customTypes.names[v]
+}
+
+// Detector detects a custom type of a value, such as a domain specific
+// code, returning false if the value is not of a custom type. Detectors
+// are set in the Config of a profiler.
+type Detector func(string) (ValueType, bool)
+
+// Names of the custom types.
+var customTypes = struct {
+	sync.RWMutex
+	names map[ValueType]string
+}{
+	names: make(map[ValueType]string),
+}
+
+// NewType returns a new value type with the name, such as icd10, for
+// the values classified by a Detector. Values of custom types are only
+// generalized to strings. The type only names the values, so it does not
+// change the types detected unless a Detector returning it is set in the
+// Config of a profiler. It panics if the name is taken or there are too
+// many types.
+func NewType(name string) ValueType {
+	customTypes.Lock()
+	defer customTypes.Unlock()
+
+	if _, ok := parseType(name); ok {
+		panic(fmt.Sprintf("profile: type already exists: %s", name))
+	}
+
+	t := ArrayType + ValueType(len(customTypes.names)) + 1
+	if t <= ArrayType {
+		panic("profile: too many types")
+	}
+
+	customTypes.names[t] = strings.ToLower(name)
+
+	return t
 }
 
 func (v ValueType) MarshalJSON() ([]byte, error) {
@@ -56,6 +101,27 @@ func (v *ValueType) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	*v, _ = ParseType(s)
+
+	return nil
+}
+
+// ParseType returns the type for its string representation, including the
+// names of custom types.
+func ParseType(s string) (ValueType, bool) {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+
+	return parseType(s)
+}
+
+func parseType(s string) (ValueType, bool) {
+	for t, name := range customTypes.names {
+		if strings.EqualFold(s, name) {
+			return t, true
+		}
+	}
+
 	var t ValueType
 
 	switch strings.ToLower(s) {
@@ -77,11 +143,13 @@ func (v *ValueType) UnmarshalJSON(b []byte) error {
 		t = DateTimeType
 	case "object":
 		t = ObjectType
+	case "array":
+		t = ArrayType
+	default:
+		return UnknownType, false
 	}
 
-	*v = t
-
-	return nil
+	return t, true
 }
 
 var typeGeneralizationMap = map[[2]ValueType]ValueType{
@@ -126,3 +194,22 @@ func GeneralizeType(t1, t2 ValueType) ValueType {
 	// Everything can be generalized to a string.
 	return StringType
 }
+
+// GeneralizeElemType takes the types of two array elements and returns
+// the type of an array containing both. Only numbers are generalized,
+// other arrays of mixed types are generalized to objects.
+func GeneralizeElemType(t1, t2 ValueType) ValueType {
+	if t1 == t2 || t2 == NullType {
+		return t1
+	}
+
+	if t1 == NullType {
+		return t2
+	}
+
+	if (t1 == IntType && t2 == FloatType) || (t1 == FloatType && t2 == IntType) {
+		return FloatType
+	}
+
+	return ObjectType
+}
@@ -0,0 +1,131 @@
+package sqlimporter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ProfileTableSuffix is appended to the name of a table to name its
+// profile table.
+const ProfileTableSuffix = "_profile"
+
+// The profile table has a row per column of the table keyed by the column
+// name. The type, nullability, and uniqueness are those of the schema and
+// the counts and bounds are computed from the loaded table. Bounds of
+// boolean and JSON columns are compared as text.
+const createProfileTableQuery = `create table if not exists %s (
+	column_name text primary key,
+	position integer not null,
+	type text not null,
+	is_nullable boolean not null,
+	is_unique boolean not null,
+	row_count bigint not null,
+	null_count bigint not null,
+	distinct_count bigint not null,
+	min_value text,
+	max_value text,
+	updated_at timestamptz not null
+)`
+
+// The statistics of a batch of columns are computed by a single scan of
+// the table into one row, which is unnested into a row per column by the
+// values of the columns.
+const upsertProfileQuery = `insert into %[1]s (column_name, position, type, is_nullable, is_unique, row_count, null_count, distinct_count, min_value, max_value, updated_at)
+select v.column_name, v.position, v.type, v.is_nullable, v.is_unique, s.row_count, s.row_count - v.non_null, v.distinct_count, v.min_value, v.max_value, now()
+from (select count(*) as row_count, %[3]s from %[2]s) s
+cross join lateral (values %[4]s) v(column_name, position, type, is_nullable, is_unique, non_null, distinct_count, min_value, max_value)
+on conflict (column_name) do update set
+	position = excluded.position,
+	type = excluded.type,
+	is_nullable = excluded.is_nullable,
+	is_unique = excluded.is_unique,
+	row_count = excluded.row_count,
+	null_count = excluded.null_count,
+	distinct_count = excluded.distinct_count,
+	min_value = excluded.min_value,
+	max_value = excluded.max_value,
+	updated_at = excluded.updated_at`
+
+// profileColumnAggregates is the number of aggregates of each column in
+// the upsert, which is the size of its target list with the row count.
+const profileColumnAggregates = 4
+
+// profileBatchSize is the most columns profiled by a single scan.
+const profileBatchSize = (pgMaxTargetListSize - 1) / profileColumnAggregates
+
+const deleteProfileQuery = `delete from %s where column_name <> all($1)`
+
+// WriteProfile writes the statistics of the columns of the loaded table
+// into its profile table in the same schema, named with the
+// ProfileTableSuffix. The profile table is created if it does not exist.
+// On reload the rows of the columns are replaced and the rows of columns
+// no longer in the schema are deleted, so it always describes the table
+// as loaded, including rows appended by earlier loads.
+func (c *Client) WriteProfile(schemaName, tableName string, tableSchema *Schema) error {
+	if len(tableSchema.Partitions) > 1 && !hasPartitionView(tableSchema, tableSchema.Partitions) {
+		return errors.New("profile tables are not supported for partitioned tables without a view")
+	}
+
+	defer c.timed(&c.timings.Analyze, time.Now())
+
+	profileTable := c.quote(schemaName) + "." + c.quote(tableName+ProfileTableSuffix)
+	sourceTable := c.quote(schemaName) + "." + c.quote(tableName)
+
+	return c.execTx(func(tx txn) error {
+		sql := fmt.Sprintf(createProfileTableQuery, profileTable)
+		if _, err := tx.Exec(sql); err != nil {
+			return fmt.Errorf("error creating profile table: %s\n%s", err, sql)
+		}
+
+		names := make([]string, len(tableSchema.Fields))
+		for i, f := range tableSchema.Fields {
+			names[i] = CleanIdentifier(f.Name)
+		}
+
+		for start := 0; start < len(names); start += profileBatchSize {
+			end := start + profileBatchSize
+			if end > len(names) {
+				end = len(names)
+			}
+
+			var (
+				aggs   []string
+				values []string
+				args   []interface{}
+			)
+
+			for i := start; i < end; i++ {
+				f := tableSchema.Fields[i]
+				column := c.quote(names[i])
+
+				// Types without an ordering are compared as text.
+				bound := column
+				if f.Type == "boolean" || f.Type == "jsonb" {
+					bound = column + "::text"
+				}
+
+				aggs = append(aggs, fmt.Sprintf("count(%[2]s) as n%[1]d, count(distinct %[2]s) as d%[1]d, min(%[3]s)::text as lo%[1]d, max(%[3]s)::text as hi%[1]d", i, column, bound))
+
+				p := len(args)
+				values = append(values, fmt.Sprintf("($%d::text, $%d::integer, $%d::text, $%d::boolean, $%d::boolean, s.n%[6]d, s.d%[6]d, s.lo%[6]d, s.hi%[6]d)", p+1, p+2, p+3, p+4, p+5, i))
+				args = append(args, names[i], i+1, f.Type, f.Nullable, f.Unique)
+			}
+
+			sql := fmt.Sprintf(upsertProfileQuery, profileTable, sourceTable, strings.Join(aggs, ", "), strings.Join(values, ", "))
+			if _, err := tx.Exec(sql, args...); err != nil {
+				return fmt.Errorf("error writing profile of columns %s to %s: %s", names[start], names[end-1], err)
+			}
+		}
+
+		sql = fmt.Sprintf(deleteProfileQuery, profileTable)
+		if _, err := tx.Exec(sql, pq.Array(names)); err != nil {
+			return fmt.Errorf("error deleting profiles of dropped columns: %s", err)
+		}
+
+		return nil
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -14,29 +15,103 @@ import (
 
 var bom = []byte{0xef, 0xbb, 0xbf}
 
-// UniversalReader wraps an io.Reader to replace carriage returns with newlines.
-// This is used with the csv.Reader so it can properly delimit lines.
+// UniversalReader wraps an io.Reader to normalize line endings to newlines.
+// Windows line endings (\r\n) are collapsed and carriage returns used by
+// classic Mac files are replaced, so the csv.Reader can properly delimit lines.
+// A byte order mark at the start of the stream is removed, even if it is
+// split across reads as a decompressor may return it.
 type UniversalReader struct {
 	r io.Reader
+
+	// If true, line endings are passed through as is, such as for files
+	// with carriage returns in quoted values. Only the BOM is removed.
+	KeepLineEndings bool
+
+	// True once the start of the stream has been checked for a BOM.
+	started bool
+
+	// Bytes read while checking for a BOM that were not part of one and
+	// the error of the read, returned before reading further.
+	head []byte
+	err  error
+
+	// True if the last byte read was a carriage return, so a newline
+	// at the start of the next read completes a \r\n.
+	cr bool
 }
 
 func (r *UniversalReader) Read(buf []byte) (int, error) {
-	n, err := r.r.Read(buf)
-
-	// Detect and remove BOM.
-	if bytes.HasPrefix(buf, bom) {
-		copy(buf, buf[len(bom):])
-		n -= len(bom)
+	if !r.started {
+		r.started = true
+		r.skipBOM()
 	}
 
-	// Replace carriage returns with newlines
-	for i, b := range buf {
-		if b == '\r' {
-			buf[i] = '\n'
+	for {
+		n, err := r.read(buf)
+
+		if r.KeepLineEndings {
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		// Replace carriage returns with newlines and drop the newline
+		// following a carriage return.
+		var j int
+		for _, b := range buf[:n] {
+			if b == '\n' && r.cr {
+				r.cr = false
+				continue
+			}
+
+			r.cr = b == '\r'
+			if r.cr {
+				b = '\n'
+			}
+
+			buf[j] = b
+			j++
 		}
+
+		// Avoid returning an empty read if only a newline was dropped.
+		if j > 0 || n == 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+// skipBOM reads the start of the stream until it matches or differs from
+// a BOM, since a short read may return a part of it. The bytes that are
+// not part of a BOM are kept in head.
+func (r *UniversalReader) skipBOM() {
+	var b [3]byte
+	var n int
+
+	for n < len(bom) && bytes.HasPrefix(bom, b[:n]) && r.err == nil {
+		var m int
+		m, r.err = r.r.Read(b[n:])
+		n += m
 	}
 
-	return n, err
+	if !bytes.Equal(b[:n], bom) {
+		r.head = append([]byte(nil), b[:n]...)
+	}
+}
+
+// read returns the bytes kept in head before reading from the stream.
+func (r *UniversalReader) read(buf []byte) (int, error) {
+	if len(r.head) > 0 {
+		n := copy(buf, r.head)
+		r.head = r.head[n:]
+		return n, nil
+	}
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return r.r.Read(buf)
 }
 
 func (r *UniversalReader) Close() error {
@@ -47,29 +122,45 @@ func (r *UniversalReader) Close() error {
 }
 
 func NewUniversalReader(r io.Reader) *UniversalReader {
-	return &UniversalReader{r}
+	return &UniversalReader{r: r}
+}
+
+// normalizeCompression returns the canonical name of the compression type.
+func normalizeCompression(t string) (string, error) {
+	switch t {
+	case "":
+		return "", nil
+	case "gzip", "gz":
+		return "gzip", nil
+	case "bzip2", "bz2":
+		return "bzip2", nil
+	}
+
+	return "", fmt.Errorf("compression type not supported: %s", t)
 }
 
 // Decompress takes a compression type and a reader and returns
-// reader that will be decompressed if the type is supported.
-func Decompress(t string, r io.Reader) (io.Reader, error) {
-	if t == "" {
-		return r, nil
+// reader that will be decompressed if the type is supported. Closing
+// the returned reader releases the decompressor, but does not close r.
+func Decompress(t string, r io.Reader) (io.ReadCloser, error) {
+	t, err := normalizeCompression(t)
+	if err != nil {
+		return nil, err
 	}
 
 	switch t {
-	case "gzip", "gz":
+	case "gzip":
 		gr, err := gzip.NewReader(r)
 		if err != nil {
 			return nil, err
 		}
 		return gr, nil
 
-	case "bz2", "bzip2":
-		return bzip2.NewReader(r), nil
+	case "bzip2":
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
 	}
 
-	return nil, fmt.Errorf("compression type not supported: %s", t)
+	return ioutil.NopCloser(r), nil
 }
 
 // DetectType attempts to detect the file format and compression types by looking at the
@@ -101,15 +192,48 @@ func DetectType(url string) (string, string) {
 
 		case "ldjson":
 			format = "ldjson"
+
+		case "tar":
+			format = "tar"
+
+		case "tgz":
+			format = "tar"
+			compression = "gzip"
 		}
 	}
 
 	return format, compression
 }
 
+// SniffLen is the number of bytes of the decompressed content read by
+// SniffType.
+const SniffLen = 512
+
+// SniffType detects the file format from the start of the decompressed
+// content for files whose extensions do not name it, such as a gzipped
+// file named data.gz. Content starting with an array is json and with an
+// object is ldjson. Anything else is assumed to be csv. An empty string is
+// returned if the content is empty.
+func SniffType(b []byte) string {
+	b = bytes.TrimLeft(bytes.TrimPrefix(b, bom), " \t\r\n")
+
+	if len(b) == 0 {
+		return ""
+	}
+
+	switch b[0] {
+	case '[':
+		return "json"
+	case '{':
+		return "ldjson"
+	}
+
+	return "csv"
+}
+
 func detectCompression(name string) string {
 	switch filepath.Ext(name) {
-	case ".gzip", ".gz":
+	case ".gzip", ".gz", ".tgz":
 		return "gzip"
 	case ".bzip2", ".bz2":
 		return "bzip2"
@@ -123,7 +247,8 @@ type Reader struct {
 	Name        string
 	Compression string
 
-	reader io.Reader
+	reader *UniversalReader
+	decomp io.Closer
 	file   *os.File
 }
 
@@ -132,60 +257,85 @@ func (r *Reader) Read(buf []byte) (int, error) {
 	return r.reader.Read(buf)
 }
 
-// Close implements the io.Closer interface.
-func (r *Reader) Close() {
+// KeepLineEndings disables the normalization of line endings. It must be
+// called before the first read.
+func (r *Reader) KeepLineEndings() {
+	r.reader.KeepLineEndings = true
+}
+
+// Close implements the io.Closer interface. Closing releases the decompressor
+// and returns its error if the compressed stream was truncated or corrupt.
+func (r *Reader) Close() error {
+	var err error
+
+	if r.decomp != nil {
+		err = r.decomp.Close()
+		r.decomp = nil
+	}
+
 	if r.file != nil {
-		r.file.Close()
+		if ferr := r.file.Close(); err == nil {
+			err = ferr
+		}
+		r.file = nil
 	}
+
+	return err
 }
 
 // Open a reader by name with optional compression. If no name is specified, STDIN
 // is used.
 func Open(name, compr string) (*Reader, error) {
-	r := new(Reader)
-
 	if compr == "" {
 		compr = detectCompression(name)
 	}
 
-	// Validate Compressionession method before working with files.
-	switch compr {
-	case "bzip2", "gzip", "":
-	default:
-		return nil, fmt.Errorf("unknown compression type %s", compr)
+	// Validate compression method before working with files.
+	compr, err := normalizeCompression(compr)
+	if err != nil {
+		return nil, err
 	}
 
 	if name == "" {
-		r.reader = os.Stdin
-	} else {
-		file, err := os.Open(name)
+		return New(os.Stdin, compr)
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
 
-		r.file = file
-		r.reader = file
+	r, err := New(file, compr)
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
 
-	// Apply the Compressionession decoder.
-	switch compr {
-	case "gzip":
-		reader, err := gzip.NewReader(r.reader)
+	r.Name = name
+	r.file = file
 
-		if err != nil {
-			r.Close()
-			return nil, err
-		}
+	return r, nil
+}
 
-		r.reader = reader
-	case "bzip2":
-		r.reader = bzip2.NewReader(r.reader)
+// New wraps a stream with optional compression. Closing the reader does not
+// close the stream.
+func New(in io.Reader, compr string) (*Reader, error) {
+	compr, err := normalizeCompression(compr)
+	if err != nil {
+		return nil, err
 	}
 
-	r.Compression = compr
+	// Apply the decompression decoder.
+	dr, err := Decompress(compr, in)
+	if err != nil {
+		return nil, err
+	}
 
-	r.reader = &UniversalReader{r.reader}
+	r := &Reader{
+		Compression: compr,
+		decomp:      dr,
+		reader:      &UniversalReader{r: dr},
+	}
 
 	return r, nil
 }
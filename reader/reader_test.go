@@ -2,14 +2,22 @@ package reader
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestUniversalReader(t *testing.T) {
 	s := "\xef\xbb\xbfhello world!\r"
 
 	r := bytes.NewBufferString(s)
-	ur := &UniversalReader{r}
+	ur := &UniversalReader{r: r}
 
 	buf := make([]byte, 20)
 	n, err := ur.Read(buf)
@@ -32,3 +40,301 @@ func TestUniversalReader(t *testing.T) {
 		t.Errorf("expected '%v', got '%v'", exp, string(buf[:n]))
 	}
 }
+
+func TestUniversalReaderLineEndings(t *testing.T) {
+	tests := map[string]string{
+		"unix":    "a,b\n1,2\n",
+		"windows": "a,b\r\n1,2\r\n",
+		"mac":     "a,b\r1,2\r",
+		"mixed":   "a,b\r\n1,2\r3,4\n\r\n",
+	}
+
+	exp := map[string]string{
+		"unix":    "a,b\n1,2\n",
+		"windows": "a,b\n1,2\n",
+		"mac":     "a,b\n1,2\n",
+		"mixed":   "a,b\n1,2\n3,4\n\n",
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Reading a byte at a time splits \r\n across reads.
+			for _, r := range []io.Reader{strings.NewReader(s), iotest.OneByteReader(strings.NewReader(s))} {
+				b, err := ioutil.ReadAll(NewUniversalReader(r))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(b) != exp[name] {
+					t.Errorf("expected %q, got %q", exp[name], b)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressionTypes(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("a,b\n"))
+	gw.Close()
+
+	// bzip2 has no writer in the standard library. This is "a,b\n".
+	bz := []byte("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x03\x43\x3a\xe0\x00\x00\x01\x51\x00\x00\x10\x00\x04\x30\x00\x20\x00\x21\x9a\x68\x33\x4d\x17\x3c\x5d\xc9\x14\xe1\x42\x40\x0d\x0c\xeb\x80")
+
+	tests := map[string][]byte{
+		"":      []byte("a,b\n"),
+		"gzip":  gz.Bytes(),
+		"gz":    gz.Bytes(),
+		"bzip2": bz,
+		"bz2":   bz,
+		"zip":   nil,
+	}
+
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for typ, data := range tests {
+		t.Run(typ, func(t *testing.T) {
+			dr, derr := Decompress(typ, bytes.NewReader(data))
+
+			path := filepath.Join(dir, "data")
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			or, oerr := Open(path, typ)
+
+			if (derr == nil) != (oerr == nil) {
+				t.Fatalf("expected same errors, got %v and %v", derr, oerr)
+			}
+
+			if data == nil {
+				if derr == nil {
+					t.Fatal("expected unsupported compression error")
+				}
+				return
+			}
+
+			defer dr.Close()
+			defer or.Close()
+
+			db, err := ioutil.ReadAll(dr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ob, err := ioutil.ReadAll(or)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(db) != "a,b\n" || string(ob) != "a,b\n" {
+				t.Errorf("expected same decompressed output, got %q and %q", db, ob)
+			}
+		})
+	}
+}
+
+func TestSniffType(t *testing.T) {
+	tests := map[string]string{
+		"id,name\n1,Joe\n":           "csv",
+		"\xef\xbb\xbfid\n":           "csv",
+		"  [{\"id\": 1}]":            "json",
+		"\n{\"id\": 1}\n{\"id\": 2}": "ldjson",
+		"":                           "",
+		" \n":                        "",
+	}
+
+	for in, expected := range tests {
+		if got := SniffType([]byte(in)); got != expected {
+			t.Errorf("expected %q for %q, got %q", expected, in, got)
+		}
+	}
+}
+
+func TestOpenCorruptGzip(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(bytes.Repeat([]byte("id,name\n1,Joe\n"), 100))
+	gw.Close()
+
+	data := gz.Bytes()
+
+	// Flip a byte of the CRC in the trailer.
+	badCRC := append([]byte(nil), data...)
+	badCRC[len(badCRC)-8] ^= 0xff
+
+	tests := map[string][]byte{
+		"truncated": data[:len(data)-10],
+		"checksum":  badCRC,
+	}
+
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".csv.gz")
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, rerr := ioutil.ReadAll(r)
+			cerr := r.Close()
+
+			if rerr == nil && cerr == nil {
+				t.Error("expected error reading corrupt gzip")
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"data.sql", "data.sql.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+
+			w, err := Create(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w.Write([]byte("a,b\n"))
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := Open(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(b) != "a,b\n" {
+				t.Errorf("expected round trip, got %q", b)
+			}
+		})
+	}
+
+	path := filepath.Join(dir, "data.sql.bz2")
+	if _, err := Create(path, ""); err == nil {
+		t.Error("expected bzip2 output to be unsupported")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected no file to be left behind")
+	}
+
+	path = filepath.Join(dir, "level.sql.gz")
+	if _, err := CreateLevel(path, "", 12); err == nil {
+		t.Error("expected an invalid level to be rejected")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected no file to be left behind")
+	}
+}
+
+func TestTrailerReader(t *testing.T) {
+	tests := []struct {
+		in  string
+		n   int
+		exp string
+	}{
+		{"a,b\n1,2\nTOTAL,1\n", 1, "a,b\n1,2\n"},
+		{"a,b\n1,2\nTOTAL,1", 1, "a,b\n1,2\n"},
+		{"a,b\n1,2\nTOTAL,1\n\n", 1, "a,b\n1,2\n"},
+		{"a,b\n\n1,2\nEND\nTOTAL,1\n", 2, "a,b\n\n1,2\n"},
+		{"a,b\n", 1, ""},
+		{"a,b\n", 3, ""},
+	}
+
+	for _, test := range tests {
+		// Reading a byte at a time checks lines are buffered correctly.
+		b, err := ioutil.ReadAll(iotest.OneByteReader(NewTrailerReader(strings.NewReader(test.in), test.n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.exp {
+			t.Errorf("%q skipping %d: expected %q, got %q", test.in, test.n, test.exp, b)
+		}
+	}
+}
+
+func TestReaderKeepLineEndings(t *testing.T) {
+	s := "\xef\xbb\xbfid,note\n1,\"a\rb\"\n"
+
+	r, err := New(strings.NewReader(s), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.KeepLineEndings()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := s[len(bom):]; string(b) != exp {
+		t.Errorf("expected %q, got %q", exp, b)
+	}
+}
+
+func TestUniversalReaderSplitBOM(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("\xef\xbb\xbfid,name\r\n1,Joe\r\n"))
+	gw.Close()
+
+	gr, err := gzip.NewReader(&gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The decompressed BOM is returned a byte at a time.
+	cr := csv.NewReader(NewUniversalReader(iotest.OneByteReader(gr)))
+
+	header, err := cr.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header[0] != "id" {
+		t.Errorf("expected id, got %q", header[0])
+	}
+
+	// Streams starting with a part of a BOM are kept as is.
+	b, err := ioutil.ReadAll(NewUniversalReader(iotest.OneByteReader(strings.NewReader("\xef\xbbid\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "\xef\xbbid\n" {
+		t.Errorf("expected the partial BOM to be kept, got %q", b)
+	}
+}
@@ -0,0 +1,138 @@
+package reader
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+)
+
+// TarReader reads the regular files of a tar archive in turn, such as a
+// dataset of CSV files shipped as a .tar.gz.
+type TarReader struct {
+	tr     *tar.Reader
+	decomp io.Closer
+	file   *os.File
+
+	// Name of the current file.
+	name string
+}
+
+// OpenTar opens a tar archive by name with optional compression, which is
+// detected from the extension if not set.
+func OpenTar(name, compr string) (*TarReader, error) {
+	if compr == "" {
+		compr = detectCompression(name)
+	}
+
+	compr, err := normalizeCompression(compr)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The archive is binary, so line endings are not normalized.
+	dr, err := Decompress(compr, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &TarReader{
+		tr:     tar.NewReader(dr),
+		decomp: dr,
+		file:   file,
+	}, nil
+}
+
+// Next advances to the next regular file and returns its path within the
+// archive. Directories and links are skipped. io.EOF is returned at the
+// end of the archive.
+func (t *TarReader) Next() (string, error) {
+	for {
+		h, err := t.tr.Next()
+		if err != nil {
+			t.name = ""
+			return "", err
+		}
+
+		if h.Typeflag == tar.TypeReg {
+			t.name = h.Name
+			return h.Name, nil
+		}
+	}
+}
+
+// Entry returns a reader of the current file, which is decompressed if its
+// extension names a compression type. It is valid until Next is called.
+// Closing it does not close the archive.
+func (t *TarReader) Entry() (*Reader, error) {
+	r, err := New(t.tr, detectCompression(t.name))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Name = t.name
+
+	return r, nil
+}
+
+// Name returns the path of the current file within the archive.
+func (t *TarReader) Name() string {
+	return t.name
+}
+
+// Raw returns a reader of the current file as stored, without
+// decompressing it. It is valid until Next is called.
+func (t *TarReader) Raw() io.Reader {
+	return t.tr
+}
+
+// Close releases the decompressor and closes the archive.
+func (t *TarReader) Close() error {
+	var err error
+
+	if t.decomp != nil {
+		err = t.decomp.Close()
+		t.decomp = nil
+	}
+
+	if t.file != nil {
+		if ferr := t.file.Close(); err == nil {
+			err = ferr
+		}
+		t.file = nil
+	}
+
+	return err
+}
+
+// TarFiles returns the paths of the regular files of the tar archive in
+// the order they are stored.
+func TarFiles(name, compr string) ([]string, error) {
+	t, err := OpenTar(name, compr)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for {
+		n, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+
+		names = append(names, n)
+	}
+
+	return names, t.Close()
+}
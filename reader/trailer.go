@@ -0,0 +1,84 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// TrailerReader wraps an io.Reader to drop the last lines of the stream,
+// such as a trailer with the record count of a feed. Lines are held back
+// until more than the number of trailing lines that are not blank have
+// been read. Blank lines following the trailer are dropped too.
+type TrailerReader struct {
+	r *bufio.Reader
+	n int
+
+	// Lines held back and the number of them that are not blank.
+	lines    [][]byte
+	nonBlank int
+
+	// Line being returned and the error once the stream is read.
+	buf []byte
+	err error
+}
+
+// NewTrailerReader returns a reader dropping the last n lines that are not
+// blank.
+func NewTrailerReader(r io.Reader, n int) *TrailerReader {
+	return &TrailerReader{
+		r: bufio.NewReader(r),
+		n: n,
+	}
+}
+
+func (r *TrailerReader) Read(buf []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		r.fill()
+	}
+
+	n := copy(buf, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// fill reads lines until one can be returned or the stream is read.
+func (r *TrailerReader) fill() {
+	for r.nonBlank <= r.n && r.err == nil {
+		line, err := r.r.ReadBytes('\n')
+
+		if len(line) > 0 {
+			r.lines = append(r.lines, line)
+
+			if !isBlank(line) {
+				r.nonBlank++
+			}
+		}
+
+		r.err = err
+	}
+
+	// The remaining held back lines are the trailer.
+	if r.nonBlank <= r.n {
+		r.lines = nil
+		return
+	}
+
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+
+	if !isBlank(line) {
+		r.nonBlank--
+	}
+
+	r.buf = line
+}
+
+func isBlank(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0
+}
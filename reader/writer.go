@@ -0,0 +1,121 @@
+package reader
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// nopWriteCloser adds a no-op Close method to an io.Writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Compress takes a compression type and a writer and returns a writer
+// that compresses to w if the type is supported. Closing the returned
+// writer flushes the compressor, but does not close w. bzip2 is not
+// supported since the standard library only provides a decoder.
+func Compress(t string, w io.Writer) (io.WriteCloser, error) {
+	return CompressLevel(t, w, gzip.DefaultCompression)
+}
+
+// CompressLevel is Compress with the compression level, such as
+// gzip.BestSpeed or gzip.BestCompression. The level is ignored if the
+// type is not compressed.
+func CompressLevel(t string, w io.Writer, level int) (io.WriteCloser, error) {
+	t, err := normalizeCompression(t)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case "gzip":
+		return gzip.NewWriterLevel(w, level)
+
+	case "bzip2":
+		return nil, fmt.Errorf("compression type not supported for writing: %s", t)
+	}
+
+	return nopWriteCloser{w}, nil
+}
+
+// Writer encapsulates a file written with optional compression.
+type Writer struct {
+	Name        string
+	Compression string
+
+	writer io.Writer
+	comp   io.Closer
+	file   *os.File
+}
+
+// Write implements the io.Writer interface.
+func (w *Writer) Write(buf []byte) (int, error) {
+	return w.writer.Write(buf)
+}
+
+// Close implements the io.Closer interface. Closing flushes the compressor
+// and closes the file. It is safe to call more than once.
+func (w *Writer) Close() error {
+	var err error
+
+	if w.comp != nil {
+		err = w.comp.Close()
+		w.comp = nil
+	}
+
+	if w.file != nil {
+		if ferr := w.file.Close(); err == nil {
+			err = ferr
+		}
+		w.file = nil
+	}
+
+	return err
+}
+
+// Create a file by name with optional compression. The compression is
+// detected from the extension if not specified.
+func Create(name, compr string) (*Writer, error) {
+	return CreateLevel(name, compr, gzip.DefaultCompression)
+}
+
+// CreateLevel is Create with the compression level.
+func CreateLevel(name, compr string, level int) (*Writer, error) {
+	if compr == "" {
+		compr = detectCompression(name)
+	}
+
+	// Validate compression method before creating the file.
+	compr, err := normalizeCompression(compr)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cw, err := CompressLevel(compr, file, level)
+	if err != nil {
+		file.Close()
+		os.Remove(name)
+		return nil, err
+	}
+
+	w := &Writer{
+		Name:        name,
+		Compression: compr,
+		writer:      cw,
+		comp:        cw,
+		file:        file,
+	}
+
+	return w, nil
+}
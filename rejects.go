@@ -0,0 +1,121 @@
+package sqlimporter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/chop-dbhi/sql-importer/profile"
+)
+
+// RejectErrorColumn is the column of a rejects file containing the reason
+// each row was rejected.
+const RejectErrorColumn = "_error"
+
+// RejectWriter writes the rows rejected by a load as CSV with the
+// delimiter of the input, so they can be fixed and imported again. The
+// header and the fields are written as read followed by the error. It is
+// safe for concurrent use, so loads run at once by a Client can share it,
+// though their headers and rows are interleaved.
+type RejectWriter struct {
+	mu    sync.Mutex
+	csv   *csv.Writer
+	count int64
+}
+
+// NewRejectWriter returns a writer of rejected rows delimited by delim.
+func NewRejectWriter(w io.Writer, delim rune) *RejectWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = delim
+
+	return &RejectWriter{
+		csv: cw,
+	}
+}
+
+// WriteHeader writes the header of the input.
+func (r *RejectWriter) WriteHeader(header []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.write(header, RejectErrorColumn)
+}
+
+// Write writes the rejected row and the error.
+func (r *RejectWriter) Write(row []string, reason error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.write(row, reason.Error()); err != nil {
+		return err
+	}
+
+	r.count++
+
+	return nil
+}
+
+func (r *RejectWriter) write(row []string, last string) error {
+	record := make([]string, len(row)+1)
+	copy(record, row)
+	record[len(row)] = last
+
+	return r.csv.Write(record)
+}
+
+// Flush writes any buffered rows.
+func (r *RejectWriter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.csv.Flush()
+	return r.csv.Error()
+}
+
+// Count returns the number of rejected rows.
+func (r *RejectWriter) Count() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.count
+}
+
+// matchesType returns true if the value, which is not null, can be loaded
+// into the column. It mirrors the conversions of fieldValue.
+func matchesType(f *Field, v string) bool {
+	switch f.Type {
+	// Integers are profiled as 64-bit, but integer columns are 32-bit.
+	case sqlTypeMap[profile.IntType]:
+		_, err := strconv.ParseInt(v, 10, 32)
+		return err == nil
+
+	case BigInt:
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+
+	case FloatReal, FloatDouble:
+		return profile.MatchType(v, profile.FloatType)
+
+	case sqlTypeMap[profile.BoolType]:
+		return profile.MatchType(v, profile.BoolType)
+
+	case sqlTypeMap[profile.DateType]:
+		_, ok := parseTime(f.Layout, v, profile.ParseDate)
+		return ok
+
+	case sqlTypeMap[profile.DateTimeType]:
+		if _, ok := parseTime(f.Layout, v, profile.ParseDateTime); ok {
+			return true
+		}
+		return profile.MatchType(v, profile.DateType)
+	}
+
+	return true
+}
+
+// typeError reports a value that does not match the type of its column.
+func typeError(f *Field, v string, row int64) error {
+	return fmt.Errorf("invalid %s value %q in column %s at row %d", f.Type, v, f.Name, row)
+}
@@ -0,0 +1,114 @@
+package sqlimporter
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+)
+
+// DefaultRowHashColumn is the name of the row hash column if not set.
+const DefaultRowHashColumn = "_row_hash"
+
+// Hash algorithms supported for row hashes.
+var rowHashAlgorithms = map[string]func() hash.Hash{
+	"":       sha256.New,
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// RowHash configures a column containing a hash of the source values of
+// each row, such as for change data capture. The values are hashed as
+// read, each followed by a NUL byte, and the hash is stored as hex.
+type RowHash struct {
+	// Column is the name of the hash column. It defaults to
+	// DefaultRowHashColumn.
+	Column string
+
+	// Algorithm is sha256, sha1, or md5. It defaults to sha256.
+	Algorithm string
+
+	// Columns are the names of the columns hashed in the order of the
+	// schema. All columns are hashed if empty.
+	Columns []string
+}
+
+func (h *RowHash) column() string {
+	if h.Column == "" {
+		return DefaultRowHashColumn
+	}
+
+	return CleanIdentifier(h.Column)
+}
+
+// rowHasher computes the row hash of a schema.
+type rowHasher struct {
+	new     func() hash.Hash
+	indexes []int
+}
+
+// newRowHasher returns the hasher of the schema after checking the row
+// hash does not conflict with it. Nil is returned if the schema has no
+// row hash.
+func newRowHasher(tableSchema *Schema) (*rowHasher, error) {
+	h := tableSchema.RowHash
+	if h == nil {
+		return nil, nil
+	}
+
+	fn, ok := rowHashAlgorithms[h.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("row hash algorithm not supported: %s", h.Algorithm)
+	}
+
+	name := h.column()
+	if tableSchema.Identity != "" && CleanIdentifier(tableSchema.Identity) == name {
+		return nil, fmt.Errorf("row hash column conflicts with identity column: %s", name)
+	}
+
+	include := make(map[string]bool, len(h.Columns))
+	for _, col := range h.Columns {
+		include[CleanIdentifier(col)] = true
+	}
+
+	rh := &rowHasher{new: fn}
+
+	for i, f := range tableSchema.Fields {
+		col := CleanIdentifier(f.Name)
+
+		if col == name {
+			return nil, fmt.Errorf("row hash column conflicts with column: %s", name)
+		}
+
+		if len(include) == 0 || include[col] {
+			rh.indexes = append(rh.indexes, i)
+			delete(include, col)
+		}
+	}
+
+	for col := range include {
+		return nil, fmt.Errorf("row hash column does not exist: %s", col)
+	}
+
+	return rh, nil
+}
+
+// definition returns the column definition of the hash column.
+func (h *RowHash) definition(quote func(string) string) string {
+	return fmt.Sprintf("%s text not null", quote(h.column()))
+}
+
+// sum returns the hex encoded hash of the row.
+func (h *rowHasher) sum(row []string) string {
+	s := h.new()
+
+	for _, i := range h.indexes {
+		s.Write([]byte(row[i]))
+		s.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(s.Sum(nil))
+}
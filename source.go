@@ -0,0 +1,180 @@
+package sqlimporter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/chop-dbhi/sql-importer/reader"
+)
+
+// source opens the input for each pass over the data. The input is
+// profiled and loaded in separate passes, each from the start.
+type source interface {
+	Open() (io.ReadCloser, error)
+	Close() error
+}
+
+// reopenable returns true if the source can be opened again from the start
+// after a failed pass. A stream being spilled to a file cannot, since the
+// rest of the stream was not spilled.
+func reopenable(src source) bool {
+	if s, ok := src.(*streamSource); ok {
+		return s.spill == nil
+	}
+
+	return true
+}
+
+// fileSource opens a file for each pass.
+type fileSource struct {
+	path        string
+	compression string
+
+	keepLineEndings bool
+
+	// partition is the key of the partition the rows are loaded into if
+	// the table is partitioned by file name.
+	partition string
+}
+
+func (s *fileSource) Open() (io.ReadCloser, error) {
+	r, err := reader.Open(s.path, s.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.keepLineEndings {
+		r.KeepLineEndings()
+	}
+
+	return r, nil
+}
+
+func (s *fileSource) Close() error {
+	return nil
+}
+
+// tarSource opens a file of a tar archive that was spooled to a temporary
+// file, so each pass reads the file rather than the archive up to it.
+type tarSource struct {
+	fileSource
+
+	archive string
+	name    string
+}
+
+// spoolTar copies the current file of the archive as stored, compressed if
+// it is, to a file of the same name in the directory.
+func spoolTar(t *reader.TarReader, dir string) (string, error) {
+	p := filepath.Join(dir, path.Base(t.Name()))
+
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(f, t.Raw()); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return p, f.Close()
+}
+
+// streamSource reads a stream that can only be opened once. Seekable streams
+// are rewound for each pass. Other streams are spilled to a temporary file
+// during the first pass which is read by subsequent passes.
+type streamSource struct {
+	in          io.Reader
+	compression string
+
+	keepLineEndings bool
+
+	opened bool
+	offset int64
+	spill  *os.File
+}
+
+func (s *streamSource) Open() (io.ReadCloser, error) {
+	if !s.opened {
+		s.opened = true
+
+		if sk, ok := s.in.(io.Seeker); ok {
+			off, err := sk.Seek(0, io.SeekCurrent)
+			if err == nil {
+				s.offset = off
+				return s.newReader(s.in)
+			}
+		}
+
+		f, err := ioutil.TempFile("", "sqlimporter")
+		if err != nil {
+			return nil, fmt.Errorf("cannot create spill file: %s", err)
+		}
+		s.spill = f
+
+		r, err := s.newReader(io.TeeReader(s.in, f))
+		if err != nil {
+			return nil, err
+		}
+
+		return &spillReader{Reader: r, in: s.in, spill: f}, nil
+	}
+
+	if s.spill != nil {
+		if _, err := s.spill.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return s.newReader(s.spill)
+	}
+
+	if _, err := s.in.(io.Seeker).Seek(s.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return s.newReader(s.in)
+}
+
+func (s *streamSource) newReader(in io.Reader) (*reader.Reader, error) {
+	r, err := reader.New(in, s.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.keepLineEndings {
+		r.KeepLineEndings()
+	}
+
+	return r, nil
+}
+
+func (s *streamSource) Close() error {
+	if s.spill == nil {
+		return nil
+	}
+
+	s.spill.Close()
+	return os.Remove(s.spill.Name())
+}
+
+// spillReader copies the remainder of the stream to the spill file when
+// closed in case the pass did not read it fully.
+type spillReader struct {
+	*reader.Reader
+	in    io.Reader
+	spill io.Writer
+}
+
+func (r *spillReader) Close() error {
+	err := r.Reader.Close()
+
+	if _, cerr := io.Copy(r.spill, r.in); cerr != nil && err == nil {
+		err = fmt.Errorf("cannot spill input: %s", cerr)
+	}
+
+	return err
+}
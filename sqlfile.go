@@ -0,0 +1,365 @@
+package sqlimporter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Formats of the COPY data written by the SQLWriter.
+const (
+	CopyText = "text"
+	CopyCSV  = "csv"
+)
+
+// Null marker of the Postgres COPY text format.
+const copyTextNull = `\N`
+
+var copyTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+var copyCSVEscaper = strings.NewReplacer(`"`, `""`)
+
+// SQLWriter writes a SQL script that creates and loads a table when
+// replayed with psql. The data is inlined as a COPY statement.
+type SQLWriter struct {
+	// NullTokens are values written as nulls in addition to empty strings.
+	NullTokens []string
+
+	// Format of the COPY data, CopyText or CopyCSV. It defaults to text.
+	Format string
+
+	// Delimiter separates the values in the COPY data. It defaults to a
+	// tab for text and a comma for csv.
+	Delimiter string
+
+	// NullMarker is the representation of nulls in the COPY data.
+	// It defaults to \N for text and an unquoted empty string for csv.
+	NullMarker string
+
+	// Analyze controls the analyze statement written after the data.
+	Analyze AnalyzeOptions
+
+	// Owner is the role made the owner of the schema and table.
+	Owner string
+
+	// Quoting is the style of quoting of the identifiers, QuoteAlways or
+	// QuoteMinimal. Identifiers are always quoted if not set.
+	Quoting string
+
+	// Tablespace is the tablespace of the table and IndexTablespace that
+	// of the indexes of its primary key and unique columns.
+	Tablespace      string
+	IndexTablespace string
+
+	w *bufio.Writer
+}
+
+// Replace writes statements that drop and recreate the table before the data.
+func (w *SQLWriter) Replace(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return w.write(schemaName, tableName, tableSchema, cr, true)
+}
+
+// Append writes statements that create the table if it does not exist
+// before the data.
+func (w *SQLWriter) Append(schemaName, tableName string, tableSchema *Schema, cr RowReader) (int64, error) {
+	return w.write(schemaName, tableName, tableSchema, cr, false)
+}
+
+func (w *SQLWriter) quote(name string) string {
+	return quoteIdent(w.Quoting, name)
+}
+
+func (w *SQLWriter) nullMarker() string {
+	if w.NullMarker == "" && w.Format != CopyCSV {
+		return copyTextNull
+	}
+	return w.NullMarker
+}
+
+func (w *SQLWriter) delimiter() string {
+	switch {
+	case w.Delimiter != "":
+		return w.Delimiter
+	case w.Format == CopyCSV:
+		return ","
+	}
+	return "\t"
+}
+
+// copyOptions returns the options of the COPY statement after checking
+// they are consistent. Defaults of the text format are omitted.
+func (w *SQLWriter) copyOptions() (string, error) {
+	var opts []string
+
+	switch w.Format {
+	case "", CopyText:
+	case CopyCSV:
+		opts = append(opts, "format csv")
+	default:
+		return "", fmt.Errorf("copy format not supported: %s", w.Format)
+	}
+
+	delim := w.delimiter()
+	marker := w.nullMarker()
+
+	if len(delim) != 1 {
+		return "", fmt.Errorf("copy delimiter must be a single character: %q", delim)
+	}
+
+	switch {
+	case delim == "\n" || delim == "\r":
+		return "", fmt.Errorf("copy delimiter conflicts with line endings: %q", delim)
+	case delim == `\`:
+		return "", errors.New("copy delimiter cannot be a backslash")
+	case delim == `"` && w.Format == CopyCSV:
+		return "", errors.New("copy delimiter conflicts with the csv quote character")
+	case strings.Contains(marker, delim):
+		return "", fmt.Errorf("copy null marker %q contains the delimiter", marker)
+	}
+
+	if w.Format == CopyCSV || delim != "\t" {
+		opts = append(opts, "delimiter "+pq.QuoteLiteral(delim))
+	}
+
+	if w.Format == CopyCSV || marker != copyTextNull {
+		opts = append(opts, "null "+pq.QuoteLiteral(marker))
+	}
+
+	if len(opts) == 0 {
+		return "", nil
+	}
+
+	return fmt.Sprintf(" with (%s)", strings.Join(opts, ", ")), nil
+}
+
+// valueWriter returns a function writing a value that is not null in the
+// format of the COPY data.
+func (w *SQLWriter) valueWriter() func(string) {
+	// Values are quoted so they are distinct from the null marker.
+	if w.Format == CopyCSV {
+		return func(v string) {
+			w.w.WriteByte('"')
+			copyCSVEscaper.WriteString(w.w, v)
+			w.w.WriteByte('"')
+		}
+	}
+
+	// Delimiters in values are escaped with a backslash in the text format.
+	escaper := copyTextEscaper
+	if delim := w.delimiter(); delim != "\t" {
+		escaper = strings.NewReplacer(
+			`\`, `\\`,
+			"\n", `\n`,
+			"\r", `\r`,
+			delim, `\`+delim,
+		)
+	}
+
+	return func(v string) {
+		escaper.WriteString(w.w, v)
+	}
+}
+
+func (w *SQLWriter) statement(name string, data *tableData) error {
+	var b bytes.Buffer
+	if err := executeTmpl(&b, name, data, w.Quoting); err != nil {
+		return err
+	}
+
+	b.WriteString(";\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+func (w *SQLWriter) write(schemaName, tableName string, tableSchema *Schema, cr RowReader, replace bool) (int64, error) {
+	// Read and skip columns.
+	if _, err := cr.Read(); err != nil {
+		return 0, err
+	}
+
+	if tableSchema.Cstore && tableSchema.Unlogged {
+		return 0, errUnloggedCstore
+	}
+
+	if tableSchema.Cstore && (w.Tablespace != "" || w.IndexTablespace != "") {
+		return 0, errTablespaceCstore
+	}
+
+	hasher, err := newRowHasher(tableSchema)
+	if err != nil {
+		return 0, err
+	}
+
+	opts, err := w.copyOptions()
+	if err != nil {
+		return 0, err
+	}
+
+	columns, columnSchemas := columnDefinitions(tableSchema, w.IndexTablespace, w.quote)
+
+	// The script does not support partitioning wide tables.
+	if len(columns) > pgMaxColumns {
+		return 0, fmt.Errorf("sql output does not support more than %d columns", pgMaxColumns)
+	}
+
+	if tableSchema.Identity != "" {
+		identity, err := identityDefinition(tableSchema, columns, w.IndexTablespace, w.quote)
+		if err != nil {
+			return 0, err
+		}
+		columnSchemas = append([]string{identity}, columnSchemas...)
+	}
+
+	data := &tableData{
+		Schema:  schemaName,
+		Table:   tableName,
+		Columns: strings.Join(columnSchemas, ","),
+		Target:  w.Analyze.Target,
+		Verbose: w.Analyze.Verbose,
+
+		Unlogged:   tableSchema.Unlogged,
+		Tablespace: w.Tablespace,
+	}
+
+	if _, err := w.w.WriteString("begin;\n"); err != nil {
+		return 0, err
+	}
+
+	// The owner is only given schemas created by the script.
+	tmpls := []string{"createSchema"}
+	if w.Owner != "" {
+		data.Owner = w.quote(w.Owner)
+		data.Values = pq.QuoteLiteral(identName(w.Quoting, schemaName))
+		tmpls = []string{"createSchemaOwned"}
+	}
+	if replace {
+		tmpls = append(tmpls, "dropTable")
+	}
+	if tableSchema.Cstore {
+		data.StripeRows = tableSchema.StripeRows
+		tmpls = append(tmpls, "createCstoreTable")
+	} else {
+		tmpls = append(tmpls, "createTable")
+	}
+	if w.Owner != "" {
+		data.Cstore = tableSchema.Cstore
+		tmpls = append(tmpls, "tableOwner")
+	}
+
+	for _, name := range tmpls {
+		if err := w.statement(name, data); err != nil {
+			return 0, err
+		}
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = w.quote(col)
+	}
+
+	copyStmt := fmt.Sprintf("copy %s.%s (%s) from stdin%s", w.quote(schemaName), w.quote(tableName), strings.Join(quoted, ", "), opts)
+
+	if _, err := fmt.Fprintf(w.w, "%s;\n", copyStmt); err != nil {
+		return 0, err
+	}
+
+	var (
+		marker     = w.nullMarker()
+		delim      = w.delimiter()
+		writeValue = w.valueWriter()
+	)
+
+	var n int64
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("error reading record: %w", err)
+		}
+
+		for i, v := range row {
+			if i > 0 {
+				w.w.WriteString(delim)
+			}
+
+			f := tableSchema.Fields[i]
+
+			if x := fieldValue(f, v, w.NullTokens); x == nil {
+				if !f.Nullable {
+					return 0, notNullError(f, n+1)
+				}
+				w.w.WriteString(marker)
+			} else {
+				writeValue(x.(string))
+			}
+		}
+
+		if hasher != nil {
+			w.w.WriteString(delim)
+			writeValue(hasher.sum(row))
+		}
+
+		if _, err := w.w.WriteString("\n"); err != nil {
+			return 0, err
+		}
+
+		n++
+	}
+
+	if _, err := w.w.WriteString("\\.\n"); err != nil {
+		return 0, err
+	}
+
+	// Nulls are not defaulted by the copy. Rows of an existing table
+	// are left as is.
+	if replace {
+		fill := &tableData{
+			Schema: schemaName,
+			Table:  tableName,
+		}
+
+		fill.Columns, fill.Filter = fillClauses(w.quote, columnDefaults(tableSchema), columns)
+
+		if fill.Columns != "" {
+			if err := w.statement("fillDefaults", fill); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if data.Target > 0 {
+		if err := w.statement("statisticsTarget", data); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := w.statement("analyzeTable", data); err != nil {
+		return 0, err
+	}
+
+	if _, err := w.w.WriteString("commit;\n"); err != nil {
+		return 0, err
+	}
+
+	return n, w.w.Flush()
+}
+
+func NewSQLWriter(w io.Writer) *SQLWriter {
+	return &SQLWriter{
+		w: bufio.NewWriter(w),
+	}
+}
@@ -0,0 +1,177 @@
+package sqlimporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestSQLWriterNull(t *testing.T) {
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text", Nullable: true},
+		},
+	}
+
+	cr := csv.NewReader(strings.NewReader("id,name\n1,Joe\n2,\\N\n3,\n4,a\tb\n"))
+
+	var b bytes.Buffer
+	w := NewSQLWriter(&b)
+	w.NullTokens = []string{`\N`}
+
+	n, err := w.Replace("public", "people", schema, cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4 {
+		t.Errorf("expected 4 rows, got %d", n)
+	}
+
+	out := b.String()
+
+	for _, exp := range []string{
+		`copy "public"."people" ("id", "name") from stdin;` + "\n",
+		"1\tJoe\n",
+		"2\t\\N\n",
+		"3\t\\N\n",
+		"4\ta\\tb\n",
+		"\\.\n",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("expected output to contain %q\n%s", exp, out)
+		}
+	}
+}
+
+func TestSQLWriterCopyOptions(t *testing.T) {
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+			{Name: "name", Type: "text", Nullable: true},
+		},
+	}
+
+	tests := []struct {
+		format, delim, null string
+
+		stmt string
+		rows []string
+	}{
+		{
+			CopyText, "|", "NULL",
+			`from stdin with (delimiter '|', null 'NULL');`,
+			[]string{"1|a\\|b\n", "2|NULL\n"},
+		},
+		{
+			CopyCSV, "", "",
+			`from stdin with (format csv, delimiter ',', null '');`,
+			[]string{"\"1\",\"a|b\"\n", "\"2\",\n"},
+		},
+		{
+			CopyCSV, ";", "NA",
+			`from stdin with (format csv, delimiter ';', null 'NA');`,
+			[]string{"\"1\";\"a|b\"\n", "\"2\";NA\n", "\"3\";\"say \"\"hi\"\"\"\n"},
+		},
+	}
+
+	for _, test := range tests {
+		cr := csv.NewReader(strings.NewReader("id,name\n1,a|b\n2,\n3,\"say \"\"hi\"\"\"\n"))
+
+		var b bytes.Buffer
+		w := NewSQLWriter(&b)
+		w.Format = test.format
+		w.Delimiter = test.delim
+		w.NullMarker = test.null
+
+		if _, err := w.Replace("public", "people", schema, cr); err != nil {
+			t.Fatal(err)
+		}
+
+		out := b.String()
+
+		for _, exp := range append([]string{test.stmt}, test.rows...) {
+			if !strings.Contains(out, exp) {
+				t.Errorf("%s %q %q: expected output to contain %q\n%s", test.format, test.delim, test.null, exp, out)
+			}
+		}
+	}
+
+	// Options that make the data ambiguous.
+	for _, w := range []*SQLWriter{
+		{Format: "binary"},
+		{Delimiter: "||"},
+		{Delimiter: `\`},
+		{Delimiter: "\n"},
+		{Format: CopyCSV, Delimiter: `"`},
+		{Delimiter: ",", NullMarker: "a,b"},
+	} {
+		w.w = bufio.NewWriter(&bytes.Buffer{})
+		cr := csv.NewReader(strings.NewReader("id,name\n1,Joe\n"))
+
+		if _, err := w.Replace("public", "people", schema, cr); err == nil {
+			t.Errorf("expected error for format %q, delimiter %q, and null %q", w.Format, w.Delimiter, w.NullMarker)
+		}
+	}
+}
+
+func TestSQLWriterOwner(t *testing.T) {
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+		},
+	}
+
+	var b bytes.Buffer
+	w := NewSQLWriter(&b)
+	w.Owner = "etl_service"
+
+	if _, err := w.Replace("public", "people", schema, csv.NewReader(strings.NewReader("id\n1\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a schema created by the script is given the owner.
+	for _, stmt := range []string{
+		`if not exists (select 1 from pg_namespace where nspname = 'public') then create schema "public" authorization "etl_service"; end if;`,
+		`alter table "public"."people" owner to "etl_service";`,
+	} {
+		if !strings.Contains(b.String(), stmt) {
+			t.Errorf("expected %s in:\n%s", stmt, b.String())
+		}
+	}
+}
+
+func TestSQLWriterQuoteMinimal(t *testing.T) {
+	schema := &Schema{
+		Fields: []*Field{
+			{Name: "id", Type: "integer"},
+			{Name: "order", Type: "text", Nullable: true},
+			{Name: "2nd_visit", Type: "date", Nullable: true},
+		},
+	}
+
+	var b bytes.Buffer
+	w := NewSQLWriter(&b)
+	w.Quoting = QuoteMinimal
+	w.Owner = "etl_service"
+
+	if _, err := w.Replace("public", "Visits", schema, csv.NewReader(strings.NewReader("id,order,2nd_visit\n1,a,\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mixed case names are lowercased, and keywords and names starting
+	// with a digit are still quoted.
+	for _, stmt := range []string{
+		`create schema public authorization etl_service;`,
+		`create table if not exists public.visits ( id integer not null,"order" text,"2nd_visit" date );`,
+		`copy public.visits (id, "order", "2nd_visit") from stdin;`,
+		`analyze public.visits;`,
+	} {
+		if !strings.Contains(b.String(), stmt) {
+			t.Errorf("expected %s in:\n%s", stmt, b.String())
+		}
+	}
+}
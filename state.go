@@ -0,0 +1,103 @@
+package sqlimporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State records the files that were imported successfully so an interrupted
+// run can be resumed without loading them again. A file is considered
+// changed, and imported again, if its size or modification time differ
+// from when it was recorded.
+type State struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]stateEntry
+}
+
+type stateEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// LoadState reads the state file at the path. An empty state is returned
+// if the file does not exist.
+func LoadState(path string) (*State, error) {
+	s := &State{
+		path:  path,
+		files: make(map[string]stateEntry),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state: %s", err)
+	}
+
+	if err := json.Unmarshal(b, &s.files); err != nil {
+		return nil, fmt.Errorf("cannot decode state: %s", err)
+	}
+
+	return s, nil
+}
+
+// Done returns true if the file was recorded and has not changed since.
+func (s *State) Done(path string, info os.FileInfo) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.files[path]
+	if !ok {
+		return false
+	}
+
+	return e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+// Mark records the file as imported and writes the state file.
+func (s *State) Mark(path string, info os.FileInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[path] = stateEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	b, err := json.MarshalIndent(s.files, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename so a crash does not
+	// leave a partially written state.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".sqlimporter-state")
+	if err != nil {
+		return fmt.Errorf("cannot write state: %s", err)
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write state: %s", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write state: %s", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write state: %s", err)
+	}
+
+	return nil
+}
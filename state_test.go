@@ -0,0 +1,56 @@
+package sqlimporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateResume(t *testing.T) {
+	a := writeTempFile(t, "a.csv", "id\n1\n")
+	b := writeTempFile(t, "b.csv", "id\n2\n")
+	statePath := filepath.Join(filepath.Dir(a), "state.json")
+
+	ai, _ := os.Stat(a)
+	bi, _ := os.Stat(b)
+
+	s, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// First run loads a, then crashes before b.
+	if s.Done(a, ai) {
+		t.Fatal("expected a to not be done")
+	}
+
+	if err := s.Mark(a, ai); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rerun.
+	s, err = LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Done(a, ai) {
+		t.Error("expected a to be skipped")
+	}
+
+	if s.Done(b, bi) {
+		t.Error("expected b to be loaded")
+	}
+
+	// Changing a file causes it to be loaded again.
+	if err := ioutil.WriteFile(a, []byte("id\n1\n3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ai, _ = os.Stat(a)
+
+	if s.Done(a, ai) {
+		t.Error("expected changed a to be loaded")
+	}
+}
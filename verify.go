@@ -0,0 +1,146 @@
+package sqlimporter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Verification is the result of verifying an existing table against a
+// file without loading it.
+type Verification struct {
+	// Result of profiling the file. It has no rows.
+	*Result
+
+	// Diff of the columns of the file and the table.
+	Diff Diff
+
+	// Rows of the file and the table if VerifyRows is set.
+	Counted   bool
+	FileRows  int64
+	TableRows int64
+}
+
+// Match returns true if the table has the columns and types of the file
+// and, if counted, the same number of rows.
+func (v *Verification) Match() bool {
+	return v.Diff.Empty() && (!v.Counted || v.FileRows == v.TableRows)
+}
+
+// String returns the discrepancies between the file and the table.
+func (v *Verification) String() string {
+	var parts []string
+
+	if !v.Diff.Empty() {
+		parts = append(parts, v.Diff.String())
+	}
+
+	if v.Counted && v.FileRows != v.TableRows {
+		parts = append(parts, fmt.Sprintf("rows: %d in file, %d in table", v.FileRows, v.TableRows))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Verify profiles the input of the request and compares it against the
+// existing table of the request, such as to reconcile a file with the
+// table it was loaded into. Nothing is loaded. An error is returned if
+// the table does not exist, not if it does not match.
+func Verify(r *Request) (*Verification, error) {
+	db, err := openDB(r)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return verifyDB(db, r)
+}
+
+func verifyDB(db *sql.DB, r *Request) (*Verification, error) {
+	res, err := Profile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(db)
+
+	diff, err := c.DiffSchema(r.Schema, r.Table, res.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verification{
+		Result: res,
+		Diff:   diff,
+	}
+
+	if r.VerifyRows {
+		if v.TableRows, err = c.RowCount(r.Schema, r.Table); err != nil {
+			return nil, err
+		}
+
+		v.Counted = true
+		v.FileRows = res.Profile.RecordCount
+	}
+
+	return v, nil
+}
+
+// ErrCountMismatch is returned if CheckCount is set and a loaded table
+// does not have the rows that were read.
+var ErrCountMismatch = errors.New("row count mismatch")
+
+// rowQuerier runs queries returning a single row, such as a transaction.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// RowCount returns the number of rows of the table or view.
+func (c *Client) RowCount(schemaName, tableName string) (int64, error) {
+	if c.tx != nil {
+		return c.countRows(c.tx, schemaName, tableName)
+	}
+
+	return c.countRows(c.db, schemaName, tableName)
+}
+
+func (c *Client) countRows(q rowQuerier, schemaName, tableName string) (int64, error) {
+	var n int64
+
+	sql := fmt.Sprintf("select count(*) from %s.%s", c.quote(schemaName), c.quote(tableName))
+	if err := q.QueryRow(sql).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting rows: %s", err)
+	}
+
+	return n, nil
+}
+
+// checkCount returns an error wrapping ErrCountMismatch if the table does
+// not have the expected rows.
+func (c *Client) checkCount(q rowQuerier, schemaName, tableName string, exp int64) error {
+	n, err := c.countRows(q, schemaName, tableName)
+	if err != nil {
+		return err
+	}
+
+	if n != exp {
+		return fmt.Errorf("%w: %d rows in %s.%s, expected %d", ErrCountMismatch, n, schemaName, tableName, exp)
+	}
+
+	return nil
+}
+
+// checkViewCount checks the rows of the view of a split table if
+// CheckCount is set.
+func (c *Client) checkViewCount(schemaName, tableName string, tableSchema *Schema, splits [][]string, exp int64) error {
+	if !c.CheckCount || !hasPartitionView(tableSchema, splits) {
+		return nil
+	}
+
+	if c.tx != nil {
+		return c.checkCount(c.tx, schemaName, tableName, exp)
+	}
+
+	return c.checkCount(c.db, schemaName, tableName, exp)
+}
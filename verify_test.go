@@ -0,0 +1,58 @@
+package sqlimporter
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	db, b := newFakeDB(t)
+
+	b.query = func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "information_schema.columns"):
+			return []string{"column_name", "data_type", "udt_name"}, [][]driver.Value{
+				{"id", "integer", "int4"},
+				{"name", "text", "text"},
+			}, nil
+
+		case strings.HasPrefix(query, "select count(*)"):
+			return []string{"count"}, [][]driver.Value{{int64(2)}}, nil
+		}
+
+		return nil, nil, fmt.Errorf("unexpected query: %s", query)
+	}
+
+	r := &Request{
+		Path:       writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n"),
+		Schema:     "public",
+		Delimiter:  ",",
+		Header:     true,
+		VerifyRows: true,
+	}
+
+	v, err := verifyDB(db, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Match() {
+		t.Errorf("expected match, got %s", v)
+	}
+
+	if stmts := b.executed(""); len(stmts) != 0 {
+		t.Errorf("expected nothing to be executed, got %v", stmts)
+	}
+
+	r.Path = writeTempFile(t, "people.csv", "id,name\n1,Joe\n2,Sue\n3,Bob\n")
+
+	if v, err = verifyDB(db, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Match() || v.String() != "rows: 3 in file, 2 in table" {
+		t.Errorf("expected row count mismatch, got %q", v)
+	}
+}